@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/collector"
+	"go.uber.org/zap"
+)
+
+// agentOptions are the flags for running as an agent that pushes its
+// results to an aggregator, or as the aggregator
+type agentOptions struct {
+	Aggregate  bool
+	StaleAfter time.Duration
+	ReportTo   string
+	Name       string
+	Token      string
+}
+
+func addAgentFlags(fs *flag.FlagSet) *agentOptions {
+	name, _ := os.Hostname()
+
+	o := &agentOptions{}
+	fs.BoolVar(&o.Aggregate, "aggregate", false, "Run as an aggregator that exports the results pushed by agents instead of collecting repos")
+	fs.DurationVar(&o.StaleAfter, "agent-stale-after", 26*time.Hour, "Report agents as down if they haven't reported for this long")
+	fs.StringVar(&o.ReportTo, "report-to", "", "Run as an agent that pushes results to the aggregator at this base URL")
+	fs.StringVar(&o.Name, "agent-name", name, "Name of this agent, used as the site label by the aggregator")
+	fs.StringVar(&o.Token, "agent-token", "", "Bearer token shared by agents and the aggregator")
+	return o
+}
+
+// Register pushes the results of every collection of c to the
+// aggregator if running as an agent
+func (o *agentOptions) Register(logger *zap.Logger, c *collector.ResticCollector) {
+	if o.ReportTo == "" {
+		return
+	}
+	c.OnCollected(collector.NewAgentReporter(logger, o.ReportTo, o.Name, o.Token).Report)
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"code.crute.us/mcrute/golib/secrets"
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/logctx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// defaultCommand is run when no command is given. This also keeps
+// invocations from before commands existed working.
+const defaultCommand = "serve"
+
+// app holds the global options and the state shared by all commands,
+// which is the logger and the Vault client.
+type app struct {
+	configFiles         stringSliceFlag
+	noVaultAutodiscover bool
+	disableVault        bool
+	noJournald          bool
+	syslogURI           string
+	lokiURI             string
+	logLevel            string
+	logFormat           string
+	showVersion         bool
+
+	lcfg      zap.Config
+	logger    *zap.Logger
+	baseLevel zapcore.Level
+
+	scOnce sync.Once
+	sc     secrets.ClientManager
+	scErr  error
+}
+
+// newApp creates the app with a logger that's used until the command
+// line has been parsed and logging can be configured
+func newApp() *app {
+	lcfg := zap.NewProductionConfig()
+	logger, _ := lcfg.Build()
+
+	return &app{
+		logLevel:  "info",
+		logFormat: "json",
+		lcfg:      lcfg,
+		logger:    logger,
+	}
+}
+
+// envPrefix is the prefix for environment variables that set flags
+const envPrefix = "RESTIC_REPORTER_"
+
+// flagEnvName returns the name of the environment variable for a flag,
+// for example --log-level is RESTIC_REPORTER_LOG_LEVEL
+func flagEnvName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv sets flags from their environment variables. This must be
+// called before parsing so that flags on the command line take
+// precedence. Flags that may be repeated accept a comma separated list.
+func applyEnv(fs *flag.FlagSet) error {
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := flagEnvName(f.Name)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+
+		values := []string{v}
+		if _, ok := f.Value.(*stringSliceFlag); ok {
+			values = strings.Split(v, ",")
+		}
+
+		for _, value := range values {
+			if err := f.Value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("Invalid value for %s: %w", name, err))
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// addGlobalFlags registers the options shared by all commands. These
+// are registered on both the top level flags and those of each command
+// so they can be given before or after the command name. The current
+// values are used as defaults so that registering the flags a second
+// time doesn't reset values that have already been parsed.
+func (a *app) addGlobalFlags(fs *flag.FlagSet) {
+	fs.Var(&a.configFiles, "config", "Path to configuration file, may be repeated to merge the repos of several files (default: search standard locations)")
+	fs.BoolVar(&a.noVaultAutodiscover, "no-discover-vault", a.noVaultAutodiscover, "Disable autodiscovery of Vault host")
+	fs.BoolVar(&a.disableVault, "no-vault", a.disableVault, "Disable usage of Vault")
+	fs.BoolVar(&a.noJournald, "no-journald", a.noJournald, "Disable logging to the systemd journal when running under systemd")
+	fs.StringVar(&a.syslogURI, "syslog", a.syslogURI, "Also send logs to a syslog server (udp://host:port or tcp://host:port)")
+	fs.StringVar(&a.lokiURI, "loki", a.lokiURI, "Also push logs to a Loki server (e.g. http://loki:3100)")
+	fs.StringVar(&a.logLevel, "log-level", a.logLevel, "Log level (debug, info, warn, error)")
+	fs.StringVar(&a.logFormat, "log-format", a.logFormat, "Log format for stdout (json, console)")
+	fs.BoolVar(&a.showVersion, "version", a.showVersion, "Show application version and exit")
+}
+
+// setupLogging builds the logger and adds the log outputs that were
+// requested by flags
+func (a *app) setupLogging() error {
+	level, err := zapcore.ParseLevel(a.logLevel)
+	if err != nil {
+		return err
+	}
+	a.baseLevel = level
+	a.lcfg.Level.SetLevel(level)
+
+	// Outputs other than stdout always use the production encoder config
+	// so only stdout gets colors
+	cfg := a.lcfg
+	switch a.logFormat {
+	case "json":
+	case "console":
+		cfg.Encoding = "console"
+		cfg.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	default:
+		return fmt.Errorf("Unsupported log format %q", a.logFormat)
+	}
+
+	if a.logger, err = cfg.Build(); err != nil {
+		return err
+	}
+
+	if !a.noJournald && journaldAvailable() {
+		l, err := withJournald(a.logger, a.lcfg)
+		if err != nil {
+			return fmt.Errorf("Error configuring journald: %w", err)
+		}
+		a.logger = l
+	}
+
+	if a.syslogURI != "" {
+		l, err := withSyslog(a.logger, a.lcfg, a.syslogURI)
+		if err != nil {
+			return fmt.Errorf("Error configuring syslog: %w", err)
+		}
+		a.logger = l
+	}
+
+	if a.lokiURI != "" {
+		l, err := withLoki(a.logger, a.lcfg, a.lokiURI)
+		if err != nil {
+			return fmt.Errorf("Error configuring Loki: %w", err)
+		}
+		a.logger = l
+	}
+
+	return nil
+}
+
+// configSearchPaths returns the locations that are searched, in order,
+// for a configuration file if one isn't given on the command line. Only
+// config.json is searched for since configuration files are JSON.
+func configSearchPaths() []string {
+	paths := []string{
+		"config.json",
+		"/etc/restic-reporter/config.json",
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "restic-reporter", "config.json"))
+	}
+	return paths
+}
+
+// findConfigFiles sets the configuration file to the first file in the
+// search path that exists if none were given on the command line. If
+// none exist then the first location is used so that errors refer to
+// the historical default. Files given more than once are only used
+// once, which also happens when a legacy invocation is parsed twice.
+func (a *app) findConfigFiles() {
+	if len(a.configFiles) > 0 {
+		var files stringSliceFlag
+		for _, f := range a.configFiles {
+			if !slices.Contains(files, f) {
+				files = append(files, f)
+			}
+		}
+		a.configFiles = files
+		return
+	}
+
+	paths := configSearchPaths()
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			a.logger.Info("Using configuration file", zap.String("file", path))
+			a.configFiles = stringSliceFlag{path}
+			return
+		}
+
+		// YAML files aren't supported, a config.yaml found instead of a
+		// config.json is most likely a mistake
+		yaml := strings.TrimSuffix(path, ".json") + ".yaml"
+		if _, err := os.Stat(yaml); err == nil {
+			a.logger.Warn("Ignoring configuration file, only JSON is supported", zap.String("file", yaml))
+		}
+	}
+
+	a.configFiles = stringSliceFlag{paths[0]}
+}
+
+// LogLevel returns a handler that reports the current log level on GET
+// and changes it on PUT with a body like {"level":"debug"}
+func (a *app) LogLevel() http.Handler {
+	return a.lcfg.Level
+}
+
+// ToggleDebug switches between the debug log level and the level set
+// on the command line
+func (a *app) ToggleDebug() zapcore.Level {
+	level := zapcore.DebugLevel
+	if a.lcfg.Level.Level() == zapcore.DebugLevel {
+		level = a.baseLevel
+	}
+	a.lcfg.Level.SetLevel(level)
+	return level
+}
+
+// Secrets returns the Vault client, setting it up on first use. It
+// returns nil if Vault is disabled. Commands that don't need secrets
+// never call this and so never need Vault to be reachable.
+func (a *app) Secrets(ctx context.Context) (secrets.ClientManager, error) {
+	a.scOnce.Do(func() {
+		if a.disableVault {
+			a.logger.Warn("Vault is disabled")
+			return
+		}
+
+		var sc secrets.ClientManager
+		var err error
+		if a.noVaultAutodiscover {
+			sc, err = secrets.NewVaultClient(nil)
+		} else {
+			sc, err = secrets.NewAutodiscoverVaultClient(ctx)
+		}
+		if err != nil {
+			a.scErr = fmt.Errorf("Error configuring vault: %w", err)
+			return
+		}
+
+		if err := sc.Authenticate(ctx); err != nil {
+			a.scErr = fmt.Errorf("Error authenticating vault: %w", err)
+			return
+		}
+
+		go sc.Run(ctx, &sync.WaitGroup{})
+		a.sc = sc
+	})
+	return a.sc, a.scErr
+}
+
+// SecretProviders returns the providers for secret references in the
+// configuration, setting up Vault if it's enabled
+func (a *app) SecretProviders(ctx context.Context) (config.SecretProviders, error) {
+	sc, err := a.Secrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return config.NewSecretProviders(sc), nil
+}
+
+// LoadConfig loads the configuration files and resolves all secrets
+func (a *app) LoadConfig(ctx context.Context) (config.File, error) {
+	providers, err := a.SecretProviders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return config.LoadAll(ctx, a.configFiles, providers)
+}
+
+// command is a single CLI command. Flags holds the command specific
+// flags which are bound to variables captured by Run.
+type command struct {
+	Name  string
+	Args  string
+	Help  string
+	Flags *flag.FlagSet
+	Run   func(ctx context.Context, a *app, args []string) error
+}
+
+func newCommand(name, args, help string) *command {
+	return &command{
+		Name:  name,
+		Args:  args,
+		Help:  help,
+		Flags: flag.NewFlagSet(name, flag.ExitOnError),
+	}
+}
+
+// errUsage is returned by commands that were called with the wrong
+// arguments. The command usage is printed.
+var errUsage = errors.New("Invalid arguments")
+
+func commands() map[string]*command {
+	all := map[string]*command{}
+	for _, cmd := range []*command{
+		serveCommand(),
+		collectCommand(),
+		validateCommand(),
+		listReposCommand(),
+		resolveSecretsCommand(),
+		checkRepoCommand(),
+		snapshotsCommand(),
+		generateConfigCommand(),
+		migrateConfigCommand(),
+		printConfigCommand(),
+		printCRDCommand(),
+	} {
+		all[cmd.Name] = cmd
+	}
+	return all
+}
+
+func printUsage(w io.Writer, global *flag.FlagSet, cmds map[string]*command) {
+	fmt.Fprintf(w, "Usage: %s [global flags] [command] [flags] [args]\n\n", os.Args[0])
+	fmt.Fprintf(w, "Commands (default %s):\n", defaultCommand)
+
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-16s %s\n", name, cmds[name].Help)
+	}
+
+	fmt.Fprintf(w, "\nGlobal flags:\n")
+	global.SetOutput(w)
+	global.PrintDefaults()
+	fmt.Fprintf(w, "\nRun '%s <command> -help' for command flags\n", os.Args[0])
+}
+
+// Run parses the command line, sets up logging, and runs a command. It
+// returns the exit code for the process.
+func (a *app) Run(args []string) int {
+	cmds := commands()
+
+	global := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	a.addGlobalFlags(global)
+	global.SetOutput(io.Discard)
+
+	if err := applyEnv(global); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	// If the global flags can't be parsed then this is likely a legacy
+	// invocation with server flags and no command. In that case all of
+	// the arguments are passed to the default command.
+	name, cmdArgs := defaultCommand, args
+	switch err := global.Parse(args); {
+	case errors.Is(err, flag.ErrHelp):
+		printUsage(os.Stderr, global, cmds)
+		return 0
+	case err == nil && global.NArg() > 0:
+		name, cmdArgs = global.Arg(0), global.Args()[1:]
+	case err == nil:
+		cmdArgs = nil
+	}
+
+	if name == "help" {
+		printUsage(os.Stdout, global, cmds)
+		return 0
+	}
+
+	cmd, ok := cmds[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		printUsage(os.Stderr, global, cmds)
+		return 2
+	}
+
+	// Global flags were already set from the environment so must only be
+	// added after applying the environment, otherwise the environment
+	// would override global flags given before the command
+	if err := applyEnv(cmd.Flags); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	a.addGlobalFlags(cmd.Flags)
+	cmd.Flags.Usage = func() {
+		fmt.Fprintf(cmd.Flags.Output(), "Usage: %s %s [flags] %s\n\n%s\n\nFlags:\n", os.Args[0], cmd.Name, cmd.Args, cmd.Help)
+		cmd.Flags.PrintDefaults()
+	}
+	cmd.Flags.Parse(cmdArgs)
+
+	if a.showVersion {
+		fmt.Printf("Version: %s\n", version)
+		return 0
+	}
+
+	if err := a.setupLogging(); err != nil {
+		a.logger.Error("Error setting up logging", zap.Error(err))
+		return 1
+	}
+	defer a.logger.Sync()
+
+	a.findConfigFiles()
+
+	ctx, cancel := context.WithCancel(logctx.With(context.Background(), a.logger))
+	defer cancel()
+
+	if err := cmd.Run(ctx, a, cmd.Flags.Args()); err != nil {
+		if errors.Is(err, errUsage) {
+			cmd.Flags.Usage()
+			return 2
+		}
+		a.logger.Error("Command failed", zap.String("command", cmd.Name), zap.Error(err))
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/restic/restic/reporter/pkg/collector"
+	"go.uber.org/zap"
+)
+
+// onceOutputs are the destinations for the results of a one-shot
+// collection by the collect command. Empty values are skipped.
+type onceOutputs struct {
+	Textfile       string
+	JSONFile       string
+	Pushgateway    string
+	PushgatewayJob string
+}
+
+// writeFileAtomic writes a file by writing to a temporary file in the
+// same directory and renaming it over the destination so that readers
+// never see a partial file. A name of "-" writes to stdout.
+func writeFileAtomic(name string, data []byte) error {
+	if name == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	fd, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fd.Name())
+
+	if _, err := fd.Write(data); err != nil {
+		fd.Close()
+		return err
+	}
+
+	if err := fd.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(fd.Name(), name)
+}
+
+// collectOnce collects all repos a single time and writes the results
+// to all configured outputs. An error is returned if any repo failed to
+// collect or any output failed to write, but all outputs are written
+// regardless.
+func collectOnce(ctx context.Context, logger *zap.Logger, c *collector.ResticCollector, out onceOutputs) error {
+	c.GatherMetrics(ctx)
+	c.Shutdown()
+
+	status := c.Status()
+	if status == nil {
+		return errors.New("Collection did not complete")
+	}
+
+	var errs []error
+	if status.Errors > 0 {
+		errs = append(errs, fmt.Errorf("%d repos failed to collect", status.Errors))
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+
+	if out.Textfile != "" {
+		if err := prometheus.WriteToTextfile(out.Textfile, reg); err != nil {
+			errs = append(errs, fmt.Errorf("Error writing textfile: %w", err))
+		}
+	}
+
+	if out.JSONFile != "" {
+		data, err := json.MarshalIndent(status, "", "    ")
+		if err == nil {
+			err = writeFileAtomic(out.JSONFile, append(data, '\n'))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error writing JSON output: %w", err))
+		}
+	}
+
+	if out.Pushgateway != "" {
+		err := push.New(out.Pushgateway, out.PushgatewayJob).Gatherer(reg).PushContext(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error pushing to pushgateway: %w", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	logger.Info("Collection succeeded", zap.Int("repos", len(status.Stats)))
+	return nil
+}
+
+func collectCommand() *command {
+	cmd := newCommand("collect", "", "Collect all repos once, write outputs, and exit non-zero if any repo failed")
+
+	var out onceOutputs
+	cmd.Flags.StringVar(&out.Textfile, "textfile", "", "Write metrics to this file in the textfile collector format")
+	cmd.Flags.StringVar(&out.JSONFile, "json-output", "", "Write the collection status as JSON to this file (- for stdout)")
+	cmd.Flags.StringVar(&out.Pushgateway, "pushgateway", "", "Push metrics to this pushgateway URL")
+	cmd.Flags.StringVar(&out.PushgatewayJob, "pushgateway-job", "restic_reporter", "Job name used when pushing to the pushgateway")
+	notifyOpts := addNotifyFlags(cmd.Flags)
+	metricOpts := addMetricFlags(cmd.Flags)
+
+	cmd.Run = func(ctx context.Context, a *app, args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		if err := metricOpts.Validate(); err != nil {
+			return err
+		}
+
+		providers, err := a.SecretProviders(ctx)
+		if err != nil {
+			return err
+		}
+
+		c := collector.NewResticCollector(a.logger)
+		c.SetMetricOptions(*metricOpts)
+		if err := c.ReloadConfig(ctx, a.configFiles, providers); err != nil {
+			return err
+		}
+
+		if err := notifyOpts.Register(a.logger, c); err != nil {
+			return fmt.Errorf("Error configuring notifications: %w", err)
+		}
+
+		return collectOnce(ctx, a.logger, c, out)
+	}
+
+	return cmd
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/collector"
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/logctx"
+	"github.com/restic/restic/reporter/pkg/snapshots"
+	"go.uber.org/zap"
+)
+
+// secretState describes a secret without revealing its value
+func secretState(v string) string {
+	if v == "" {
+		return "missing"
+	}
+	return "set"
+}
+
+// listRepos prints the effective list of configured repos. Secrets are
+// never printed, only whether they're set.
+func listRepos(w io.Writer, cfg config.File, defaultSchedule string) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tREPO\tBACKEND\tSCHEDULE\tENABLED\tPASSWORD\tBACKEND CREDENTIALS")
+
+	for _, entry := range cfg {
+		creds := "-"
+		switch entry.Backend() {
+		case "azure":
+			creds = secretState(entry.AzureAccountKey + entry.AzureAccountSAS)
+		case "b2":
+			creds = secretState(entry.B2Key)
+		case "gs":
+			creds = secretState(entry.GSCredentials)
+			if entry.GSCredentials == "" {
+				creds = "default"
+			}
+		case "rest":
+			if entry.RESTPassword != "" || entry.RESTToken != "" {
+				creds = "set"
+			}
+		case "swift":
+			creds = secretState(entry.SwiftKey)
+		case "s3":
+			creds = secretState(entry.AWSSecretAccessKey)
+			if entry.AWSIAMRole {
+				creds = "iam role"
+			}
+		}
+		if creds == "missing" && entry.EnvCredentials() {
+			creds = "env"
+		}
+
+		schedule := defaultSchedule
+		if entry.Schedule != "" {
+			schedule = entry.Schedule
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%t\t%s\t%s\n",
+			entry.Label(),
+			config.RedactRepo(entry.Repo),
+			entry.Backend(),
+			schedule,
+			!entry.Disabled,
+			secretState(entry.Password),
+			creds,
+		)
+	}
+
+	return tw.Flush()
+}
+
+// resolveSecrets resolves every secret reference in the configuration
+// and reports the result for each. Secret values are never printed. An
+// error is returned if any secret failed to resolve.
+func resolveSecrets(ctx context.Context, w io.Writer, cfg config.File, providers config.SecretProviders) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPO\tSECRET\tSOURCE\tREFERENCE\tRESULT")
+
+	failed := 0
+	for _, entry := range cfg {
+		for _, res := range entry.ResolveSecrets(ctx, providers) {
+			result := "ok"
+			if res.Err != nil {
+				result = "error: " + res.Err.Error()
+				failed++
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+				config.RedactRepo(entry.Repo), res.Name, res.Source, res.Ref, result)
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d secrets failed to resolve", failed)
+	}
+	return nil
+}
+
+// collectConfiguredRepo opens a single configured repo and collects its
+// snapshots. Disabled repos are collected anyway since this is used by
+// diagnostic commands.
+func collectConfiguredRepo(ctx context.Context, cfg config.File, name string) (snapshots.Collection, error) {
+	entry := cfg.Find(name)
+	if entry == nil {
+		return nil, fmt.Errorf("No repo %q in configuration", name)
+	}
+
+	ctx, logger := logctx.WithFields(ctx, zap.String("repo", config.ScrubRepo(entry.Repo)), zap.String("backend", entry.Backend()))
+	if entry.Disabled {
+		logger.Warn("Repo is disabled, opening anyway")
+	}
+
+	info, err := collector.DefaultReader{}.ReadSnapshots(ctx, entry, entry.GroupByOr(snapshots.DefaultGroupBy), entry.SnapshotFilter())
+	return info.Snapshots, err
+}
+
+// checkRepo opens a single repo with step by step logging and lists its
+// snapshots. This is used to diagnose why a single repo fails to collect
+// without collecting any of the others.
+func checkRepo(ctx context.Context, cfg config.File, name string) error {
+	col, err := collectConfiguredRepo(ctx, cfg, name)
+	if err != nil {
+		return err
+	}
+
+	logctx.From(ctx).Info("Repo check succeeded", zap.String("repo", config.ScrubRepo(name)), zap.Int("backup_sets", len(col)))
+	return nil
+}
+
+// printSnapshots prints a table of the backup sets in a single repo as
+// the exporter sees them.
+func printSnapshots(ctx context.Context, w io.Writer, cfg config.File, name string) error {
+	col, err := collectConfiguredRepo(ctx, cfg, name)
+	if err != nil {
+		return err
+	}
+
+	sets := make([]*snapshots.Info, 0, len(col))
+	for _, set := range col {
+		sets = append(sets, set)
+	}
+	// Sets are sorted by everything that can tell them apart, sets split
+	// by tag or path share a host and user
+	sort.Slice(sets, func(i, j int) bool {
+		a, b := sets[i], sets[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Username != b.Username {
+			return a.Username < b.Username
+		}
+		if a.Tags != b.Tags {
+			return a.Tags < b.Tags
+		}
+		return a.Paths < b.Paths
+	})
+
+	now := time.Now()
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tUSER\tTAGS\tPATHS\tCOUNT\tNEWEST\tAGE (DAYS)")
+	for _, set := range sets {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%d\n",
+			set.Host, set.Username, orNone(set.Tags), orNone(set.Paths),
+			set.Count, set.Time.Format(time.RFC3339), set.DayAge(now))
+	}
+
+	return tw.Flush()
+}
+
+// orNone returns s, or "-" when it's empty so that the table columns
+// stay aligned
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func listReposCommand() *command {
+	cmd := newCommand("list-repos", "", "Print the effective repo list with secrets redacted")
+	cronExpression := cmd.Flags.String("cron", defaultCron, "Default schedule used by the server, for display")
+
+	cmd.Run = func(ctx context.Context, a *app, args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		cfg, err := a.LoadConfig(ctx)
+		if err != nil {
+			return err
+		}
+		return listRepos(os.Stdout, cfg, *cronExpression)
+	}
+
+	return cmd
+}
+
+func resolveSecretsCommand() *command {
+	cmd := newCommand("resolve-secrets", "", "Resolve every secret reference and report the result without printing values")
+
+	cmd.Run = func(ctx context.Context, a *app, args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		cfg, _, err := config.ReadAll(a.configFiles)
+		if err != nil {
+			return err
+		}
+		providers, err := a.SecretProviders(ctx)
+		if err != nil {
+			return err
+		}
+		return resolveSecrets(ctx, os.Stdout, cfg, providers)
+	}
+
+	return cmd
+}
+
+func checkRepoCommand() *command {
+	cmd := newCommand("check-repo", "<repo>", "Open a single repo with step by step logging")
+
+	cmd.Run = func(ctx context.Context, a *app, args []string) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		cfg, err := a.LoadConfig(ctx)
+		if err != nil {
+			return err
+		}
+		return checkRepo(ctx, cfg, args[0])
+	}
+
+	return cmd
+}
+
+func snapshotsCommand() *command {
+	cmd := newCommand("snapshots", "<repo>", "Print the backup sets in a single repo as the exporter sees them")
+
+	cmd.Run = func(ctx context.Context, a *app, args []string) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		cfg, err := a.LoadConfig(ctx)
+		if err != nil {
+			return err
+		}
+		return printSnapshots(ctx, os.Stdout, cfg, args[0])
+	}
+
+	return cmd
+}
+
+func validateCommand() *command {
+	cmd := newCommand("validate", "", "Check the configuration file for errors without resolving secrets")
+
+	cmd.Run = func(ctx context.Context, a *app, args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		cfg, version, err := config.ReadAll(a.configFiles)
+		if err != nil {
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		if version < config.CurrentVersion {
+			a.logger.Warn("Configuration uses a legacy format, run migrate-config to update it")
+		}
+		a.logger.Info("Configuration is valid", zap.Int("repos", len(cfg)))
+		return nil
+	}
+
+	return cmd
+}
+
+func generateConfigCommand() *command {
+	cmd := newCommand("generate-config", "", "Print a commented example configuration")
+	interactive := cmd.Flags.Bool("interactive", false, "Prompt for the details of a first repo")
+
+	cmd.Run = func(ctx context.Context, a *app, args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		return generateConfig(os.Stdout, *interactive, os.Stdin, os.Stderr)
+	}
+
+	return cmd
+}
+
+func migrateConfigCommand() *command {
+	cmd := newCommand("migrate-config", "", "Print the configuration file converted to the current format")
+
+	cmd.Run = func(ctx context.Context, a *app, args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		if len(a.configFiles) != 1 {
+			return fmt.Errorf("migrate-config converts a single configuration file")
+		}
+		return config.Migrate(a.configFiles[0], os.Stdout)
+	}
+
+	return cmd
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/restic/restic/reporter/pkg/config"
+)
+
+// configAPIPath serves the effective configuration of a running server
+const configAPIPath = "/api/v1/config"
+
+// effectiveConfig is the configuration after defaults, the environment,
+// the command line and the configuration file have been merged. Secrets
+// are always redacted.
+type effectiveConfig struct {
+	ConfigFile  string         `json:"config_file"` // the first of ConfigFiles
+	ConfigFiles []string       `json:"config_files"`
+	Flags       map[string]any `json:"flags"`
+	Repos       config.File    `json:"repos"`
+}
+
+// secretFlags are flags whose values are always redacted
+var secretFlags = map[string]bool{
+	"agent-token":       true,
+	"discover-b2-key":   true,
+	"discover-password": true,
+}
+
+// newEffectiveConfig builds the effective configuration from a parsed
+// flag set, which includes the global flags, and the loaded repos.
+func newEffectiveConfig(a *app, fs *flag.FlagSet, cfg config.File) *effectiveConfig {
+	out := &effectiveConfig{
+		ConfigFile:  a.configFiles[0],
+		ConfigFiles: a.configFiles,
+		Flags:       map[string]any{},
+		Repos:       make(config.File, 0, len(cfg)),
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if secretFlags[f.Name] {
+			if f.Value.String() != "" {
+				out.Flags[f.Name] = config.RedactedValue
+			} else {
+				out.Flags[f.Name] = ""
+			}
+			return
+		}
+		if v, ok := f.Value.(*stringSliceFlag); ok {
+			values := make([]string, 0, len(*v))
+			for _, s := range *v {
+				values = append(values, redactURL(s))
+			}
+			out.Flags[f.Name] = values
+			return
+		}
+		out.Flags[f.Name] = redactURL(f.Value.String())
+	})
+
+	for _, entry := range cfg {
+		out.Repos = append(out.Repos, entry.Redacted())
+	}
+
+	return out
+}
+
+// redactURL replaces the password of any URL in a string, such as the
+// value of a flag, which may not itself be a URL. Strings that don't
+// contain a URL with a password are returned unchanged.
+func redactURL(v string) string {
+	scheme, rest, ok := strings.Cut(v, "://")
+	if !ok {
+		return v
+	}
+
+	userinfo, host, ok := strings.Cut(rest, "@")
+	if !ok || strings.Contains(userinfo, "/") {
+		return v
+	}
+
+	user, _, ok := strings.Cut(userinfo, ":")
+	if !ok {
+		return v
+	}
+
+	return scheme + "://" + user + ":" + config.RedactedValue + "@" + host
+}
+
+func writeEffectiveConfig(w io.Writer, cfg *effectiveConfig) error {
+	out, err := json.MarshalIndent(cfg, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", out)
+	return err
+}
+
+func printConfigCommand() *command {
+	cmd := newCommand("print-config", "", "Print the effective configuration with all secrets redacted")
+
+	cmd.Run = func(ctx context.Context, a *app, args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+
+		// Secrets aren't resolved since they would be redacted anyway and
+		// this should work even if Vault is unreachable
+		cfg, _, err := config.ReadAll(a.configFiles)
+		if err != nil {
+			return err
+		}
+
+		return writeEffectiveConfig(os.Stdout, newEffectiveConfig(a, cmd.Flags, cfg))
+	}
+
+	return cmd
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/restic/restic/reporter/pkg/collector"
+	"github.com/restic/restic/reporter/pkg/snapshots"
+)
+
+// stringSliceFlag is a flag.Value that can be passed multiple times,
+// accumulating each value.
+type stringSliceFlag []string
+
+func (f *stringSliceFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringSliceFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// groupByFlag is a flag.Value for a snapshots.GroupBy
+type groupByFlag struct {
+	g *snapshots.GroupBy
+}
+
+func (f groupByFlag) String() string {
+	if f.g == nil {
+		return ""
+	}
+	return f.g.String()
+}
+
+func (f groupByFlag) Set(v string) error {
+	g, err := snapshots.ParseGroupBy(v)
+	if err != nil {
+		return err
+	}
+	*f.g = g
+	return nil
+}
+
+// addMetricFlags registers the flags that control the names and labels
+// of exported metrics, which are shared by the serve and collect
+// commands
+func addMetricFlags(fs *flag.FlagSet) *collector.MetricOptions {
+	opts := collector.DefaultMetricOptions()
+	fs.StringVar(&opts.Namespace, "metric-namespace", opts.Namespace, "Namespace prefix of all exported metrics")
+	fs.StringVar(&opts.RepoLabel, "metric-repo-label", opts.RepoLabel, "Name of the metric label holding the repo")
+	fs.BoolVar(&opts.Legacy, "metric-legacy-names", opts.Legacy, "Also export all metrics with the default namespace and repo label while migrating")
+	fs.Var(groupByFlag{&opts.GroupBy}, "group-by", "Comma separated fields that identify a backup set (host, user, tags, paths)")
+	fs.StringVar(&opts.Compat, "metric-compat", opts.Compat, "Also export the metrics of another restic exporter while migrating (ngosang)")
+	fs.IntVar(&opts.SeriesWarn, "series-warn-threshold", opts.SeriesWarn, "Warn about repos that export more than this many series, 0 to disable")
+	fs.DurationVar(&opts.RepoTimeout, "repo-timeout", opts.RepoTimeout, "How long reading a single repo may take before it's reported as a timeout, 0 disables the limit")
+	fs.BoolVar(&opts.Histograms, "snapshot-histograms", opts.Histograms, "Export histograms of the ages and sizes of the snapshots and the ages of the backup sets of each repo, native with classic buckets as a fallback")
+	fs.Func("repo-labels", "Comma separated names of labels that repos may set with labels in their configuration (e.g. criticality,owner)", func(v string) error {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				opts.RepoLabels = append(opts.RepoLabels, name)
+			}
+		}
+		return nil
+	})
+	return &opts
+}
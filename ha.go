@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/collector"
+	"github.com/restic/restic/reporter/pkg/leader"
+	"go.uber.org/zap"
+)
+
+// haOptions are the flags for running several replicas of the server of
+// which only the elected leader collects repos
+type haOptions struct {
+	Lock          string
+	Identity      string
+	LeaseDuration time.Duration
+	StateFile     string
+}
+
+func addHAFlags(fs *flag.FlagSet) *haOptions {
+	identity, _ := os.Hostname()
+
+	o := &haOptions{}
+	fs.StringVar(&o.Lock, "ha-lock", "", "Elect a leader with file:<path> or kubernetes:[<namespace>/]<lease>, only the leader collects repos")
+	fs.StringVar(&o.Identity, "ha-identity", identity, "Identity of this replica for leader election, must be unique")
+	fs.DurationVar(&o.LeaseDuration, "ha-lease-duration", 30*time.Second, "How long leadership lasts without being renewed")
+	fs.StringVar(&o.StateFile, "ha-state-file", "", "File on shared storage where the leader persists results for standby replicas to serve")
+	return o
+}
+
+// Setup configures leader election for c, returning nil if it isn't
+// enabled. A first election is held before returning so that only the
+// leader collects at startup. The elector must be run by the caller.
+func (o *haOptions) Setup(ctx context.Context, logger *zap.Logger, c *collector.ResticCollector) (*leader.Elector, error) {
+	if o.Lock == "" {
+		return nil, nil
+	}
+
+	lock, err := leader.ParseLock(o.Lock)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := leader.NewElector(logger, lock, o.Identity, o.LeaseDuration)
+	if err != nil {
+		return nil, err
+	}
+	c.SetLeader(e.IsLeader)
+
+	if o.StateFile != "" {
+		c.OnCollected(func(ctx context.Context, metrics *collector.AllRepoMetrics) {
+			if err := writeStateFile(o.StateFile, metrics); err != nil {
+				logger.Error("Error persisting results for standby replicas", zap.Error(err))
+			}
+		})
+		go o.followLeader(ctx, logger, e, c)
+	}
+
+	e.Step(ctx)
+	if !e.IsLeader() {
+		o.restore(logger, c)
+	}
+
+	return e, nil
+}
+
+// followLeader periodically restores the results persisted by the leader
+// for as long as this replica is a standby
+func (o *haOptions) followLeader(ctx context.Context, logger *zap.Logger, e *leader.Elector, c *collector.ResticCollector) {
+	ticker := time.NewTicker(o.LeaseDuration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !e.IsLeader() {
+				o.restore(logger, c)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// restore loads the persisted results if they're newer than the current
+// results
+func (o *haOptions) restore(logger *zap.Logger, c *collector.ResticCollector) {
+	metrics, err := readStateFile(o.StateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("Error reading persisted results", zap.Error(err))
+		}
+		return
+	}
+
+	if current := c.Status(); current == nil || metrics.Time.After(current.Time) {
+		logger.Debug("Restoring persisted results", zap.Time("time", metrics.Time))
+		c.RestoreStatus(metrics)
+	}
+}
+
+// writeStateFile persists metrics to a file, with repos named by their
+// label so that the credentials in their URIs aren't written, see
+// collector.AllRepoMetrics.Persisted
+func writeStateFile(name string, metrics *collector.AllRepoMetrics) error {
+	data, err := json.Marshal(metrics.Persisted())
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+func readStateFile(name string) (*collector.AllRepoMetrics, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics collector.AllRepoMetrics
+	if err := json.Unmarshal(data, &metrics); err != nil {
+		return nil, err
+	}
+	return &metrics, nil
+}
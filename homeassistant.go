@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/restic/restic/reporter/pkg/snapshots"
+)
+
+// haDevice groups all of the entities for a backup set into a single
+// device in Home Assistant.
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// haEntity is a Home Assistant MQTT discovery config payload. Only the
+// fields used by the exporter are included.
+//
+// See https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery
+type haEntity struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	StateTopic        string   `json:"state_topic"`
+	ValueTemplate     string   `json:"value_template"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	StateClass        string   `json:"state_class,omitempty"`
+	UnitOfMeasurement string   `json:"unit_of_measurement,omitempty"`
+	PayloadOn         string   `json:"payload_on,omitempty"`
+	PayloadOff        string   `json:"payload_off,omitempty"`
+	Icon              string   `json:"icon,omitempty"`
+	Device            haDevice `json:"device"`
+}
+
+// discoveryMessages builds the Home Assistant discovery messages for a
+// backup set. Each backup set becomes a device with sensors for age,
+// last snapshot time, and snapshot count and a problem binary sensor
+// that turns on when the set is overdue. The entities read their state
+// from the retained status message for the set so no additional state
+// messages are needed.
+func (p *MQTTPublisher) discoveryMessages(repo string, set *snapshots.Info) []mqttMessage {
+	id := fmt.Sprintf("restic_reporter_%s_%s_%s",
+		mqttTopicSegment(repo), mqttTopicSegment(set.Host), mqttTopicSegment(set.Username))
+
+	device := haDevice{
+		Identifiers:  []string{id},
+		Name:         fmt.Sprintf("Backup %s@%s", set.Username, set.Host),
+		Manufacturer: "restic-reporter",
+		Model:        repo,
+	}
+
+	stateTopic := p.setTopic(repo, set)
+
+	entities := map[string]haEntity{
+		"sensor/" + id + "_age": {
+			Name:              "Backup age",
+			UniqueID:          id + "_age",
+			StateTopic:        stateTopic,
+			ValueTemplate:     "{{ value_json.age_days }}",
+			DeviceClass:       "duration",
+			StateClass:        "measurement",
+			UnitOfMeasurement: "d",
+			Device:            device,
+		},
+		"sensor/" + id + "_last_snapshot": {
+			Name:          "Last snapshot",
+			UniqueID:      id + "_last_snapshot",
+			StateTopic:    stateTopic,
+			ValueTemplate: "{{ value_json.last_snapshot }}",
+			DeviceClass:   "timestamp",
+			Device:        device,
+		},
+		"sensor/" + id + "_count": {
+			Name:          "Snapshot count",
+			UniqueID:      id + "_count",
+			StateTopic:    stateTopic,
+			ValueTemplate: "{{ value_json.count }}",
+			StateClass:    "measurement",
+			Icon:          "mdi:backup-restore",
+			Device:        device,
+		},
+		"binary_sensor/" + id + "_overdue": {
+			Name:          "Backup overdue",
+			UniqueID:      id + "_overdue",
+			StateTopic:    stateTopic,
+			ValueTemplate: "{{ value_json.status }}",
+			DeviceClass:   "problem",
+			PayloadOn:     "overdue",
+			PayloadOff:    "ok",
+			Device:        device,
+		},
+	}
+
+	msgs := make([]mqttMessage, 0, len(entities))
+	for path, entity := range entities {
+		payload, err := json.Marshal(entity)
+		if err != nil {
+			continue
+		}
+		msgs = append(msgs, mqttMessage{
+			Topic:   fmt.Sprintf("%s/%s/config", p.discoveryPrefix, path),
+			Payload: payload,
+			Retain:  true,
+		})
+	}
+
+	return msgs
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/restic/restic/reporter/pkg/collector"
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/schedule"
+	"go.uber.org/zap"
+)
+
+// defaultJob is the name of the job that collects every repo without its
+// own schedule
+const defaultJob = "default"
+
+// repoJobName is the name of the job for a repo with its own schedule
+func repoJobName(repo string) string {
+	return "repo:" + repo
+}
+
+// verifyJobName is the name of the job that verifies the data of a repo
+func verifyJobName(repo string) string {
+	return "verify:" + repo
+}
+
+// canaryJobName is the name of the job that runs the restore canary of
+// a repo
+func canaryJobName(repo string) string {
+	return "restore:" + repo
+}
+
+// repoJob is a job that's kept for a repo
+type repoJob struct {
+	repo     string
+	schedule string
+}
+
+// repoJobs keeps a scheduler job for every repo that has its own
+// schedule, and for every repo with a verify_schedule or restore_canary
+// if verifier or canary are set, in sync with the configuration
+type repoJobs struct {
+	sched    schedule.Scheduler
+	c        *collector.ResticCollector
+	verifier *collector.Verifier
+	canary   *collector.RestoreCanary
+	logger   *zap.Logger
+
+	mu   sync.Mutex
+	jobs map[string]repoJob // job name to job
+}
+
+func newRepoJobs(sched schedule.Scheduler, c *collector.ResticCollector, verifier *collector.Verifier, canary *collector.RestoreCanary, logger *zap.Logger) *repoJobs {
+	return &repoJobs{sched: sched, c: c, verifier: verifier, canary: canary, logger: logger, jobs: map[string]repoJob{}}
+}
+
+// AddDefault adds the job that collects every repo without its own
+// schedule
+func (j *repoJobs) AddDefault(ctx context.Context, spec schedule.Spec) error {
+	return j.sched.Add(defaultJob, spec, func() {
+		j.c.GatherRepos(ctx, func(e *config.Entry) bool {
+			return e.Schedule == ""
+		})
+	})
+}
+
+// Sync adds, updates and removes jobs to match the configuration. Jobs
+// that are unchanged keep their schedule.
+func (j *repoJobs) Sync(ctx context.Context, cfg config.File) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	seen := map[string]bool{}
+
+	for _, entry := range cfg {
+		if entry.Disabled {
+			continue
+		}
+		repo := entry.Repo
+
+		if entry.Schedule != "" {
+			name := repoJobName(repo)
+			seen[name] = true
+			if err := j.add(name, repo, entry.Schedule, "Scheduled repo", func() {
+				j.c.GatherRepos(ctx, func(e *config.Entry) bool {
+					return e.Repo == repo
+				})
+			}); err != nil {
+				return err
+			}
+		}
+
+		if entry.VerifySchedule != "" && j.verifier != nil {
+			name := verifyJobName(repo)
+			seen[name] = true
+			if err := j.add(name, repo, entry.VerifySchedule, "Scheduled repo verification", func() {
+				j.verifier.Verify(ctx, repo)
+			}); err != nil {
+				return err
+			}
+		}
+
+		if entry.RestoreCanary != nil && j.canary != nil {
+			name := canaryJobName(repo)
+			seen[name] = true
+			if err := j.add(name, repo, entry.RestoreCanary.Schedule, "Scheduled restore canary", func() {
+				j.canary.Restore(ctx, repo)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, job := range j.jobs {
+		if seen[name] {
+			continue
+		}
+		if err := j.sched.Remove(name); err != nil {
+			return err
+		}
+		j.logger.Info("Unscheduled job", zap.String("job", name), zap.String("repo", config.ScrubRepo(job.repo)))
+		delete(j.jobs, name)
+	}
+
+	return nil
+}
+
+// add adds or updates the job name unless it already has spec
+func (j *repoJobs) add(name, repo, spec, msg string, fn func()) error {
+	if j.jobs[name].schedule == spec {
+		return nil
+	}
+
+	parsed, err := schedule.Parse(spec)
+	if err != nil {
+		return fmt.Errorf("Error parsing schedule for %s: %w", config.RedactRepo(repo), err)
+	}
+	if err := j.sched.Add(name, parsed, fn); err != nil {
+		return err
+	}
+
+	j.logger.Info(msg, zap.String("repo", config.ScrubRepo(repo)), zap.Stringer("schedule", parsed))
+	j.jobs[name] = repoJob{repo: repo, schedule: spec}
+	return nil
+}
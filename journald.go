@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// journaldAvailable indicates if the process was started by systemd with
+// its output connected to the journal and the native journal socket is
+// available for logging.
+func journaldAvailable() bool {
+	if os.Getenv("JOURNAL_STREAM") == "" {
+		return false
+	}
+	_, err := os.Stat(journalSocket)
+	return err == nil
+}
+
+// journaldCore is a zapcore.Core that writes entries to the systemd
+// journal using the native protocol. Each zap field becomes a journal
+// field with an upper-cased name so that they can be used for filtering
+// with journalctl (e.g. journalctl -u restic-reporter REPO=...).
+//
+// See https://systemd.io/JOURNAL_NATIVE_PROTOCOL/ for protocol details.
+// Entries larger than the maximum datagram size will fail to send,
+// which is fine for the size of entries this exporter produces.
+type journaldCore struct {
+	zapcore.LevelEnabler
+	conn       *net.UnixConn
+	addr       *net.UnixAddr
+	identifier string
+	fields     []zapcore.Field
+}
+
+func newJournaldCore(lvl zapcore.LevelEnabler) (zapcore.Core, error) {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &journaldCore{
+		LevelEnabler: lvl,
+		conn:         conn,
+		addr:         &net.UnixAddr{Name: journalSocket, Net: "unixgram"},
+		identifier:   filepath.Base(os.Args[0]),
+	}, nil
+}
+
+func (c *journaldCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	clone.fields = append(clone.fields, c.fields...)
+	clone.fields = append(clone.fields, fields...)
+	return &clone
+}
+
+func (c *journaldCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *journaldCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", ent.Message)
+	writeJournalField(&b, "PRIORITY", fmt.Sprintf("%d", syslogSeverity(ent.Level)))
+	writeJournalField(&b, "SYSLOG_IDENTIFIER", c.identifier)
+	if ent.LoggerName != "" {
+		writeJournalField(&b, "LOGGER", ent.LoggerName)
+	}
+	if ent.Caller.Defined {
+		writeJournalField(&b, "CODE_FILE", ent.Caller.File)
+		writeJournalField(&b, "CODE_LINE", fmt.Sprintf("%d", ent.Caller.Line))
+	}
+
+	for k, v := range enc.Fields {
+		var value string
+		switch tv := v.(type) {
+		case string:
+			value = tv
+		case fmt.Stringer:
+			value = tv.String()
+		default:
+			if out, err := json.Marshal(v); err == nil {
+				value = string(out)
+			} else {
+				value = fmt.Sprint(v)
+			}
+		}
+		writeJournalField(&b, journalFieldName(k), value)
+	}
+
+	_, err := c.conn.WriteToUnix(b.Bytes(), c.addr)
+	return err
+}
+
+func (c *journaldCore) Sync() error {
+	return nil
+}
+
+// journalFieldName converts a zap field key into a valid journal field
+// name. Journal field names may only contain upper case letters,
+// numbers, and underscores and may not start with an underscore (those
+// are reserved for trusted fields).
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	return strings.TrimLeft(name, "_0123456789")
+}
+
+// writeJournalField serializes a single field. Values containing
+// newlines must use the binary length-prefixed form.
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	if name == "" {
+		return
+	}
+
+	if !strings.ContainsRune(value, '\n') {
+		fmt.Fprintf(b, "%s=%s\n", name, value)
+		return
+	}
+
+	b.WriteString(name)
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/kube"
+	"github.com/restic/restic/reporter/pkg/operator"
+	"go.uber.org/zap"
+)
+
+// kubeOptions are the flags for building the repos to collect from
+// ResticRepository resources instead of the configuration file, or for
+// discovering repos from annotated objects
+type kubeOptions struct {
+	Operator   bool
+	Discover   string
+	Namespaces string
+	Resync     time.Duration
+
+	client *kube.Client
+}
+
+func addKubeFlags(fs *flag.FlagSet) *kubeOptions {
+	o := &kubeOptions{}
+	fs.BoolVar(&o.Operator, "kubernetes-operator", false, "Collect the repos of ResticRepository resources in the cluster instead of the configuration file")
+	fs.StringVar(&o.Discover, "kubernetes-discover", "", "Comma separated kinds of annotated objects to discover repos from (secrets, pods)")
+	fs.StringVar(&o.Namespaces, "kubernetes-namespaces", "", "Comma separated namespaces to watch for resources and annotated objects (default: all)")
+	fs.DurationVar(&o.Resync, "kubernetes-resync", time.Minute, "How often to list ResticRepository resources for changes")
+	return o
+}
+
+// splitList splits a comma separated flag value, dropping empty values
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// kubeClient returns the in-cluster client, which is shared by the
+// operator and discovery
+func (o *kubeOptions) kubeClient() (*kube.Client, error) {
+	if o.client == nil {
+		client, err := kube.InCluster()
+		if err != nil {
+			return nil, err
+		}
+		o.client = client
+	}
+	return o.client, nil
+}
+
+// NewOperator creates the operator, returning nil if it isn't enabled
+func (o *kubeOptions) NewOperator(logger *zap.Logger) (*operator.Operator, error) {
+	if !o.Operator {
+		return nil, nil
+	}
+
+	client, err := o.kubeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return operator.New(logger, client, splitList(o.Namespaces)), nil
+}
+
+// NewDiscovery creates the discovery, returning nil if it isn't enabled
+func (o *kubeOptions) NewDiscovery(logger *zap.Logger) (*operator.Discovery, error) {
+	kinds := splitList(o.Discover)
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+
+	client, err := o.kubeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return operator.NewDiscovery(logger, client, splitList(o.Namespaces), kinds)
+}
+
+func printCRDCommand() *command {
+	cmd := newCommand("print-crd", "", "Print the Kubernetes CustomResourceDefinition used by --kubernetes-operator")
+
+	cmd.Run = func(ctx context.Context, a *app, args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		_, err := fmt.Fprint(os.Stdout, operator.CRD)
+		return err
+	}
+
+	return cmd
+}
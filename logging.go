@@ -0,0 +1,63 @@
+package main
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// withSyslog returns a logger that sends all log entries to a syslog
+// server in addition to the outputs already configured on logger. The
+// syslog messages carry the same structured JSON body as stdout minus
+// the timestamp and level which are part of the syslog header.
+func withSyslog(logger *zap.Logger, lcfg zap.Config, uri string) (*zap.Logger, error) {
+	w, err := newSyslogWriter(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	ecfg := lcfg.EncoderConfig
+	ecfg.TimeKey = zapcore.OmitKey
+	ecfg.LevelKey = zapcore.OmitKey
+
+	sc := newSyslogCore(zapcore.NewJSONEncoder(ecfg), w, lcfg.Level)
+
+	return logger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(c, sc)
+	})), nil
+}
+
+// withJournald returns a logger that writes to the systemd journal
+// using structured fields instead of writing JSON to stdout.
+func withJournald(logger *zap.Logger, lcfg zap.Config) (*zap.Logger, error) {
+	jc, err := newJournaldCore(lcfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	return logger.WithOptions(zap.WrapCore(func(zapcore.Core) zapcore.Core {
+		return jc
+	})), nil
+}
+
+// withLoki returns a logger that pushes all log entries to Loki in
+// addition to the outputs already configured on logger. Entries are
+// labeled with job and, where present, the repo and run_id fields.
+func withLoki(logger *zap.Logger, lcfg zap.Config, uri string) (*zap.Logger, error) {
+	p, err := newLokiPusher(uri, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	ecfg := lcfg.EncoderConfig
+	ecfg.TimeKey = zapcore.OmitKey
+
+	lc := newLokiCore(zapcore.NewJSONEncoder(ecfg), p, lcfg.Level, map[string]string{
+		"job": "restic-reporter",
+	})
+
+	return logger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(c, lc)
+	})), nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// lokiLabelFields are the log fields that are promoted to Loki stream
+// labels. All other fields remain in the JSON log line. These are kept
+// deliberately small to avoid creating high cardinality streams.
+var lokiLabelFields = []string{"repo", "run_id"}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// lokiPusher batches log lines by stream and pushes them to the Loki
+// push API. Batches are sent periodically and whenever Flush is called.
+type lokiPusher struct {
+	url     string
+	user    *url.Userinfo
+	client  *http.Client
+	streams map[string]*lokiStream
+	sync.Mutex
+}
+
+// newLokiPusher creates a lokiPusher for a Loki server. If the URI has
+// no path then the standard push API path is used. Credentials in the
+// URI are sent as HTTP basic auth.
+func newLokiPusher(uri string, interval time.Duration) (*lokiPusher, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Unsupported Loki scheme %q, must be http or https", u.Scheme)
+	}
+
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/loki/api/v1/push"
+	}
+
+	user := u.User
+	u.User = nil
+
+	p := &lokiPusher{
+		url:     u.String(),
+		user:    user,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		streams: map[string]*lokiStream{},
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			p.Flush()
+		}
+	}()
+
+	return p, nil
+}
+
+func (p *lokiPusher) Add(labels map[string]string, ts time.Time, line string) {
+	key := fmt.Sprintf("%v", labels)
+
+	p.Lock()
+	defer p.Unlock()
+
+	s := p.streams[key]
+	if s == nil {
+		s = &lokiStream{Stream: labels}
+		p.streams[key] = s
+	}
+	s.Values = append(s.Values, [2]string{strconv.FormatInt(ts.UnixNano(), 10), line})
+}
+
+// Flush sends all buffered lines to Loki. Failed batches are dropped
+// and reported on stderr since there's nowhere else to log them.
+func (p *lokiPusher) Flush() error {
+	p.Lock()
+	if len(p.streams) == 0 {
+		p.Unlock()
+		return nil
+	}
+
+	body := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{Streams: make([]*lokiStream, 0, len(p.streams))}
+
+	for _, s := range p.streams {
+		body.Streams = append(body.Streams, s)
+	}
+	p.streams = map[string]*lokiStream{}
+	p.Unlock()
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if p.user != nil {
+		pass, _ := p.user.Password()
+		req.SetBasicAuth(p.user.Username(), pass)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error pushing logs to Loki: %s\n", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		err = fmt.Errorf("Loki returned status %s", res.Status)
+		fmt.Fprintf(os.Stderr, "Error pushing logs to Loki: %s\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// lokiCore is a zapcore.Core that encodes entries as JSON and buffers
+// them for pushing to Loki. Fields named in lokiLabelFields are used as
+// stream labels in addition to the static labels.
+type lokiCore struct {
+	zapcore.LevelEnabler
+	enc    zapcore.Encoder
+	p      *lokiPusher
+	labels map[string]string
+}
+
+func newLokiCore(enc zapcore.Encoder, p *lokiPusher, lvl zapcore.LevelEnabler, labels map[string]string) zapcore.Core {
+	return &lokiCore{LevelEnabler: lvl, enc: enc, p: p, labels: labels}
+}
+
+func (c *lokiCore) withLabels(fields []zapcore.Field) map[string]string {
+	labels := make(map[string]string, len(c.labels)+len(lokiLabelFields))
+	for k, v := range c.labels {
+		labels[k] = v
+	}
+	for _, f := range fields {
+		for _, name := range lokiLabelFields {
+			if f.Key == name && f.Type == zapcore.StringType {
+				labels[name] = f.String
+			}
+		}
+	}
+	return labels
+}
+
+func (c *lokiCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &lokiCore{LevelEnabler: c.LevelEnabler, enc: enc, p: c.p, labels: c.withLabels(fields)}
+}
+
+func (c *lokiCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *lokiCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	labels := c.withLabels(fields)
+	labels["level"] = ent.Level.String()
+
+	c.p.Add(labels, ent.Time, string(bytes.TrimRight(buf.Bytes(), "\n")))
+	return nil
+}
+
+func (c *lokiCore) Sync() error {
+	return c.p.Flush()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/restic/restic/reporter/pkg/collector"
+	"github.com/restic/restic/reporter/pkg/notify"
+	"go.uber.org/zap"
+)
+
+// notifyOptions are the flags for sending notifications about
+// collection runs, which are shared by the serve and collect commands
+type notifyOptions struct {
+	URIs   stringSliceFlag
+	Events string
+}
+
+func addNotifyFlags(fs *flag.FlagSet) *notifyOptions {
+	var defaults []string
+	for _, t := range notify.DefaultEvents {
+		defaults = append(defaults, string(t))
+	}
+
+	o := &notifyOptions{}
+	fs.Var(&o.URIs, "notify", "Send notifications to type:url where type is webhook, slack, or ntfy, may be repeated")
+	fs.StringVar(&o.Events, "notify-events", strings.Join(defaults, ","), "Comma separated notification events to send (run_completed, repo_collected, repo_failed)")
+	return o
+}
+
+// Register sends notifications for every collection run of c if any
+// notifiers were configured
+func (o *notifyOptions) Register(logger *zap.Logger, c *collector.ResticCollector) error {
+	if len(o.URIs) == 0 {
+		return nil
+	}
+
+	var events []notify.EventType
+	for _, v := range strings.Split(o.Events, ",") {
+		t, err := notify.ParseEventType(strings.TrimSpace(v))
+		if err != nil {
+			return err
+		}
+		events = append(events, t)
+	}
+
+	d := notify.NewDispatcher(logger, events)
+	for _, uri := range o.URIs {
+		n, err := notify.New(uri)
+		if err != nil {
+			return err
+		}
+		d.Add(n)
+	}
+
+	c.OnCollected(d.Collected)
+	return nil
+}
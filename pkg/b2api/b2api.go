@@ -0,0 +1,150 @@
+// Package b2api is a minimal client for the parts of the native B2 API
+// that the exporter uses directly, rather than through restic, such as
+// discovering repos in a bucket and measuring what a bucket stores.
+package b2api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// AuthorizeURL is the B2 API endpoint that returns the URL and token
+// used for all other calls
+const AuthorizeURL = "https://api.backblazeb2.com/b2api/v2/b2_authorize_account"
+
+// Session is an authorized connection to the B2 API
+type Session struct {
+	client    *http.Client
+	apiURL    string
+	token     string
+	accountID string
+}
+
+// File is a file, file version or folder returned by the list calls
+type File struct {
+	FileName      string `json:"fileName"`
+	FileID        string `json:"fileId"`
+	Action        string `json:"action"`
+	ContentLength int64  `json:"contentLength"`
+}
+
+// Authorize creates a session for an account. The account ID may also be
+// the ID of an application key.
+func Authorize(ctx context.Context, client *http.Client, accountID, key string) (*Session, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, AuthorizeURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(accountID, key)
+
+	var out struct {
+		AccountID          string `json:"accountId"`
+		APIURL             string `json:"apiUrl"`
+		AuthorizationToken string `json:"authorizationToken"`
+	}
+	if err := do(client, req, &out); err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		client:    client,
+		apiURL:    out.APIURL,
+		token:     out.AuthorizationToken,
+		accountID: out.AccountID,
+	}, nil
+}
+
+// BucketID returns the ID of a bucket by its name
+func (s *Session) BucketID(ctx context.Context, name string) (string, error) {
+	var out struct {
+		Buckets []struct {
+			BucketID   string `json:"bucketId"`
+			BucketName string `json:"bucketName"`
+		} `json:"buckets"`
+	}
+	in := map[string]string{"accountId": s.accountID, "bucketName": name}
+	if err := s.call(ctx, "b2_list_buckets", in, &out); err != nil {
+		return "", err
+	}
+
+	for _, bucket := range out.Buckets {
+		if bucket.BucketName == name {
+			return bucket.BucketID, nil
+		}
+	}
+	return "", fmt.Errorf("No such bucket")
+}
+
+// ListFileNames lists files and, if delimiter is set, folders in a
+// bucket. The name to start the next page from is returned, which is
+// empty for the last page.
+func (s *Session) ListFileNames(ctx context.Context, bucketID, prefix, delimiter, start string, max int) ([]File, string, error) {
+	in := map[string]any{
+		"bucketId":     bucketID,
+		"prefix":       prefix,
+		"maxFileCount": max,
+	}
+	if delimiter != "" {
+		in["delimiter"] = delimiter
+	}
+	if start != "" {
+		in["startFileName"] = start
+	}
+
+	var out struct {
+		Files        []File  `json:"files"`
+		NextFileName *string `json:"nextFileName"`
+	}
+	if err := s.call(ctx, "b2_list_file_names", in, &out); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if out.NextFileName != nil {
+		next = *out.NextFileName
+	}
+	return out.Files, next, nil
+}
+
+// call calls a B2 API operation with a JSON body
+func (s *Session) call(ctx context.Context, op string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.apiURL+"/b2api/v2/"+op, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", s.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	return do(s.client, req, out)
+}
+
+// do sends a request and decodes the JSON response, or the error
+// message of a failed request
+func do(client *http.Client, req *http.Request, out any) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var e struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(res.Body).Decode(&e) == nil && e.Message != "" {
+			return fmt.Errorf("%s: %s (%s)", res.Status, e.Message, e.Code)
+		}
+		return fmt.Errorf("%s", res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,119 @@
+package b2api
+
+import "context"
+
+// Usage is what B2 stores under a prefix of a bucket, which is what's
+// billed. This includes what restic can't see: old versions of files
+// that are kept by the lifecycle rules of the bucket after restic
+// deletes them, and the parts of large files whose upload didn't finish.
+type Usage struct {
+	// Bytes and Files are every stored version of every file, including
+	// hidden versions and unfinished large files
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+
+	// HiddenBytes and HiddenFiles are the versions that aren't the
+	// current version of a file, such as files deleted by a prune
+	HiddenBytes int64 `json:"hidden_bytes"`
+	HiddenFiles int64 `json:"hidden_files"`
+
+	// UnfinishedBytes and UnfinishedFiles are the uploaded parts of large
+	// files that were started but never finished
+	UnfinishedBytes int64 `json:"unfinished_bytes"`
+	UnfinishedFiles int64 `json:"unfinished_files"`
+}
+
+// Usage lists every file version under prefix in a bucket and measures
+// what is stored. This is a paged list of the whole prefix so it's as
+// slow as listing the repo.
+func (s *Session) Usage(ctx context.Context, bucketID, prefix string) (Usage, error) {
+	var u Usage
+	var lastName string
+	startName, startID := "", ""
+	for {
+		in := map[string]any{
+			"bucketId":     bucketID,
+			"prefix":       prefix,
+			"maxFileCount": 1000,
+		}
+		if startName != "" {
+			in["startFileName"] = startName
+			in["startFileId"] = startID
+		}
+
+		var out struct {
+			Files        []File  `json:"files"`
+			NextFileName *string `json:"nextFileName"`
+			NextFileID   *string `json:"nextFileId"`
+		}
+		if err := s.call(ctx, "b2_list_file_versions", in, &out); err != nil {
+			return Usage{}, err
+		}
+
+		// Versions are listed by name and then newest first, so every
+		// version after the first of a name is hidden. A deleted file's
+		// first version is a hide marker, so all of its uploads are.
+		for _, f := range out.Files {
+			first := f.FileName != lastName
+			lastName = f.FileName
+
+			switch f.Action {
+			case "upload":
+				u.Bytes += f.ContentLength
+				u.Files++
+				if !first {
+					u.HiddenBytes += f.ContentLength
+					u.HiddenFiles++
+				}
+			case "start":
+				parts, err := s.partsSize(ctx, f.FileID)
+				if err != nil {
+					return Usage{}, err
+				}
+				u.Bytes += parts
+				u.Files++
+				u.UnfinishedBytes += parts
+				u.UnfinishedFiles++
+			}
+		}
+
+		if out.NextFileName == nil {
+			return u, nil
+		}
+		startName = *out.NextFileName
+		if out.NextFileID != nil {
+			startID = *out.NextFileID
+		}
+	}
+}
+
+// partsSize returns the total size of the uploaded parts of an
+// unfinished large file
+func (s *Session) partsSize(ctx context.Context, fileID string) (int64, error) {
+	var size int64
+	start := 0
+	for {
+		in := map[string]any{"fileId": fileID, "maxPartCount": 1000}
+		if start > 0 {
+			in["startPartNumber"] = start
+		}
+
+		var out struct {
+			Parts []struct {
+				ContentLength int64 `json:"contentLength"`
+			} `json:"parts"`
+			NextPartNumber *int `json:"nextPartNumber"`
+		}
+		if err := s.call(ctx, "b2_list_parts", in, &out); err != nil {
+			return 0, err
+		}
+
+		for _, p := range out.Parts {
+			size += p.ContentLength
+		}
+		if out.NextPartNumber == nil {
+			return size, nil
+		}
+		start = *out.NextPartNumber
+	}
+}
@@ -0,0 +1,227 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// AgentReportAPIPath is the path, followed by the agent name, to which
+// agents push the results of every collection to an aggregator
+const AgentReportAPIPath = "/api/v1/agents/"
+
+// agentStatus is the last report received from an agent
+type agentStatus struct {
+	site     *FederatedSite
+	reported time.Time
+}
+
+// AggregatorCollector re-exports the results pushed by agents with a
+// site label holding the agent name. It's the push equivalent of the
+// FederationCollector for sites that the aggregator can't reach. Agents
+// don't need to be configured, they're added when they first report.
+type AggregatorCollector struct {
+	metricSets []*metricSet
+	staleAfter time.Duration
+	token      string
+	logger     *zap.Logger
+	reg        prometheus.Registerer
+
+	mu     sync.Mutex
+	agents map[string]*agentStatus
+}
+
+// NewAggregatorCollector creates an aggregator that reports agents as
+// down if they haven't reported within staleAfter. If token isn't empty
+// agents must send it as a bearer token.
+func NewAggregatorCollector(logger *zap.Logger, staleAfter time.Duration, token string) *AggregatorCollector {
+	c := &AggregatorCollector{
+		staleAfter: staleAfter,
+		token:      token,
+		logger:     logger,
+		agents:     map[string]*agentStatus{},
+	}
+	c.SetMetricOptions(DefaultMetricOptions())
+	return c
+}
+
+// SetMetricOptions changes the names of the exported metrics. This must
+// be called before Register.
+func (c *AggregatorCollector) SetMetricOptions(opts MetricOptions) {
+	c.metricSets = opts.metricSets()
+}
+
+// Register registers the collector with the registerer, which is also
+// used to register a collector for each agent when it first reports
+func (c *AggregatorCollector) Register(reg prometheus.Registerer) error {
+	c.reg = reg
+	return reg.Register(c)
+}
+
+// Report stores the results pushed by an agent
+func (c *AggregatorCollector) Report(name string, metrics *AllRepoMetrics) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	agent, ok := c.agents[name]
+	if !ok {
+		site := &FederatedSite{Name: name, metricSets: c.metricSets}
+		wrapped := prometheus.WrapRegistererWith(prometheus.Labels{"site": name}, c.reg)
+		if err := wrapped.Register(site); err != nil {
+			return fmt.Errorf("Error registering agent %s: %w", name, err)
+		}
+
+		c.logger.Info("New agent reported", zap.String("agent", name))
+		agent = &agentStatus{site: site}
+		c.agents[name] = agent
+	}
+
+	agent.site.metrics.Store(metrics)
+	agent.reported = time.Now()
+	return nil
+}
+
+// ServeHTTP accepts a report from an agent, which is a POST of the same
+// JSON document as served by the status API to AgentReportAPIPath
+// followed by the agent name
+func (c *AggregatorCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if c.token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(c.token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, AgentReportAPIPath)
+	if name == "" || strings.Contains(name, "/") {
+		http.Error(w, "Invalid agent name", http.StatusBadRequest)
+		return
+	}
+
+	var metrics AllRepoMetrics
+	if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
+		http.Error(w, "Invalid report", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.Report(name, &metrics); err != nil {
+		c.logger.Error("Error storing agent report", zap.String("agent", name), zap.Error(err))
+		http.Error(w, "Error storing report", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// up returns true if the agent reported within the stale duration
+func (c *AggregatorCollector) up(agent *agentStatus) bool {
+	return time.Since(agent.reported) < c.staleAfter
+}
+
+// GatherMetrics doesn't collect anything since agents push their
+// results, it logs agents that have stopped reporting
+func (c *AggregatorCollector) GatherMetrics(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, agent := range c.agents {
+		if !c.up(agent) {
+			c.logger.Error("Agent has stopped reporting", zap.String("agent", name), zap.Time("last_report", agent.reported))
+		}
+	}
+}
+
+func (c *AggregatorCollector) Shutdown() {}
+
+func (c *AggregatorCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.metricSets {
+		ch <- m.federationSiteUp
+	}
+}
+
+func (c *AggregatorCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, agent := range c.agents {
+		var up float64
+		if c.up(agent) {
+			up = 1
+		}
+		for _, m := range c.metricSets {
+			ch <- prometheus.MustNewConstMetric(
+				m.federationSiteUp, prometheus.GaugeValue, up, name,
+			)
+		}
+	}
+}
+
+// AgentReporter pushes the results of every collection to an aggregator
+type AgentReporter struct {
+	url    string
+	token  string
+	client *http.Client
+	logger *zap.Logger
+}
+
+// NewAgentReporter creates a reporter that reports as name to the
+// aggregator at the base URL aggregator
+func NewAgentReporter(logger *zap.Logger, aggregator, name, token string) *AgentReporter {
+	return &AgentReporter{
+		url:    strings.TrimRight(aggregator, "/") + AgentReportAPIPath + url.PathEscape(name),
+		token:  token,
+		client: &http.Client{Timeout: time.Minute},
+		logger: logger,
+	}
+}
+
+// Report pushes the results of a collection. Failures are logged, the
+// results are pushed again after the next collection.
+func (r *AgentReporter) Report(ctx context.Context, metrics *AllRepoMetrics) {
+	if err := r.report(ctx, metrics); err != nil {
+		r.logger.Error("Error reporting to aggregator", zap.Error(err))
+	}
+}
+
+func (r *AgentReporter) report(ctx context.Context, metrics *AllRepoMetrics) error {
+	body, err := json.Marshal(metrics.Scrubbed())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Report request returned %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/repoerr"
+	"github.com/restic/restic/reporter/pkg/resticrepo"
+)
+
+// The results of probing whether a repo allows deleting files, see
+// probeDelete
+const (
+	deleteForbidden = "forbidden"
+	deleteAllowed   = "allowed"
+	deleteUnknown   = "unknown"
+)
+
+// probeDelete probes whether the credentials of a rest-server repo can
+// delete files, which they can't if rest-server runs with --append-only.
+// A file with a random name that can't exist is deleted so nothing is
+// ever removed: rest-server in append-only mode refuses every delete
+// other than of locks before looking for the file, otherwise it looks
+// for the file and doesn't find it. The requests are sent like restic
+// sends them, see resticrepo.RESTClient.
+//
+// rest-server also refuses requests with 401 or 403 when the credentials
+// are wrong or, with --private-repos, belong to another user, so the
+// repo config is read first and a refused delete only means append-only
+// when it could be read.
+func probeDelete(ctx context.Context, entry *config.Entry) (string, error) {
+	client, u, err := resticrepo.RESTClient(entry.Repo, entry.ExtraConfig())
+	if err != nil {
+		return deleteUnknown, err
+	}
+	client.Timeout = 30 * time.Second
+
+	base := u.String()
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+
+	res, err := probeRequest(ctx, client, http.MethodHead, base+"config")
+	if err != nil {
+		return deleteUnknown, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return deleteUnknown, fmt.Errorf("Unexpected response to reading the repo config: %s", res.Status)
+	}
+
+	id := make([]byte, 32)
+	rand.Read(id)
+
+	res, err = probeRequest(ctx, client, http.MethodDelete, base+"data/"+hex.EncodeToString(id))
+	if err != nil {
+		return deleteUnknown, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusForbidden:
+		return deleteForbidden, nil
+	case http.StatusNotFound:
+		return deleteAllowed, nil
+	default:
+		return deleteUnknown, fmt.Errorf("Unexpected response to delete probe: %s", res.Status)
+	}
+}
+
+// probeRequest sends a request without a body and discards the body of
+// the response
+func probeRequest(ctx context.Context, client *http.Client, method, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, repoerr.Scrub(err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, repoerr.Scrub(err)
+	}
+	res.Body.Close()
+	return res, nil
+}
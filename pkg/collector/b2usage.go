@@ -0,0 +1,39 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/b2api"
+	"github.com/restic/restic/reporter/pkg/config"
+)
+
+// readB2Usage measures what B2 stores for a B2 repo, which is under the
+// path of the repo in its bucket
+func readB2Usage(ctx context.Context, entry *config.Entry) (*b2api.Usage, error) {
+	_, location, _ := strings.Cut(entry.Repo, ":")
+	bucket, prefix, _ := strings.Cut(location, ":")
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	s, err := b2api.Authorize(ctx, client, entry.B2AccountId, entry.B2Key)
+	if err != nil {
+		return nil, err
+	}
+
+	bucketID, err := s.BucketID(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := s.Usage(ctx, bucketID, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/repoerr"
+	"github.com/restic/restic/reporter/pkg/resticrepo"
+	"go.uber.org/zap"
+)
+
+// RestoreFunc restores and verifies a file of a repo
+type RestoreFunc func(ctx context.Context, entry *config.Entry, opts resticrepo.RestoreOptions) (resticrepo.RestoreResult, error)
+
+// DefaultRestore opens a repo and restores a file with
+// resticrepo.Repo.RestoreFile
+func DefaultRestore(ctx context.Context, entry *config.Entry, opts resticrepo.RestoreOptions) (resticrepo.RestoreResult, error) {
+	repo, ctx, err := resticrepo.Open(ctx, entry.Repo, entry.Password, entry.ExtraConfig())
+	if err != nil {
+		return resticrepo.RestoreResult{}, err
+	}
+	defer repo.Close()
+	return repo.RestoreFile(ctx, opts)
+}
+
+// canaryResult is the result of the most recent restore canary of a
+// repo. bytes is only set if it succeeded.
+type canaryResult struct {
+	success  bool
+	bytes    int64
+	duration time.Duration
+	time     time.Time
+}
+
+// RestoreCanary restores a file from the newest snapshot of the repos
+// with a restore_canary on its schedule and verifies it, since backups
+// that can't be restored are only noticed when they're needed. Canaries
+// are run by the scheduler of the exporter, see Restore.
+type RestoreCanary struct {
+	*repoResults[canaryResult]
+	restore RestoreFunc
+}
+
+// NewRestoreCanary creates a canary for the repos that config returns,
+// which is usually ResticCollector.Config
+func NewRestoreCanary(logger *zap.Logger, opts MetricOptions, config func() config.File, restore RestoreFunc) *RestoreCanary {
+	return &RestoreCanary{
+		repoResults: newRepoResults[canaryResult](logger, opts, config),
+		restore:     restore,
+	}
+}
+
+// Restore restores a file from a repo if it still has a restore_canary
+func (c *RestoreCanary) Restore(ctx context.Context, repo string) {
+	entry := c.entry(c.config(), repo)
+	if entry == nil {
+		return
+	}
+
+	ctx, logger := withRepo(ctx, c.logger, entry)
+	logger.Info("Running restore canary")
+
+	start := time.Now()
+	res, err := c.restore(ctx, entry, entry.RestoreCanary.Options())
+	result := canaryResult{success: err == nil, duration: time.Since(start), time: time.Now()}
+	if err != nil {
+		logger.Error("Restore canary failed", zap.String("snapshot", res.Snapshot), zap.String("path", res.Path),
+			zap.String("error_class", repoerr.Class(err)), zap.Error(err))
+	} else {
+		result.bytes = res.Bytes
+		logger.Info("Restore canary succeeded", zap.String("snapshot", res.Snapshot), zap.String("path", res.Path),
+			zap.Int64("bytes", res.Bytes), zap.Duration("duration", result.duration))
+	}
+
+	c.set(repo, result)
+}
+
+// enabled excludes repos that no longer have a restore_canary
+func (canaryResult) enabled(entry *config.Entry) bool {
+	return entry.RestoreCanary != nil
+}
+
+func (canaryResult) describe(m *metricSet) []*prometheus.Desc {
+	return []*prometheus.Desc{m.canarySuccess, m.canaryDuration, m.canaryBytes, m.canaryTime}
+}
+
+func (res canaryResult) collect(ch chan<- prometheus.Metric, m *metricSet, name []string) {
+	var success float64
+	if res.success {
+		success = 1
+		ch <- prometheus.MustNewConstMetric(m.canaryBytes, prometheus.GaugeValue, float64(res.bytes), name...)
+	}
+	ch <- prometheus.MustNewConstMetric(m.canarySuccess, prometheus.GaugeValue, success, name...)
+	ch <- prometheus.MustNewConstMetric(m.canaryDuration, prometheus.GaugeValue, res.duration.Seconds(), name...)
+	ch <- prometheus.MustNewConstMetric(m.canaryTime, prometheus.GaugeValue, float64(res.time.Unix()), name...)
+}
@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/repoerr"
+	"github.com/restic/restic/reporter/pkg/resticrepo"
+	"go.uber.org/zap"
+)
+
+// CheckFunc checks the structure of a repo
+type CheckFunc func(ctx context.Context, entry *config.Entry) (resticrepo.CheckResult, error)
+
+// DefaultCheck opens a repo and checks it with resticrepo.Repo.Check
+func DefaultCheck(ctx context.Context, entry *config.Entry) (resticrepo.CheckResult, error) {
+	repo, ctx, err := resticrepo.Open(ctx, entry.Repo, entry.Password, entry.ExtraConfig())
+	if err != nil {
+		return resticrepo.CheckResult{}, err
+	}
+	defer repo.Close()
+	return repo.Check(ctx)
+}
+
+// checkResult is the result of the most recent check of a repo. errors
+// is -1 if the check couldn't be run.
+type checkResult struct {
+	errors   int
+	duration time.Duration
+	time     time.Time
+}
+
+// RepoChecker checks the structure of the repos with check enabled, like
+// restic check without --read-data, so that a corrupt repo is noticed
+// before a restore is needed. Checks read the whole index and every tree
+// so they're much more expensive than a collection, and repos are
+// checked one at a time. Repos read by plugins aren't checked.
+type RepoChecker struct {
+	*repoResults[checkResult]
+	check CheckFunc
+}
+
+// NewRepoChecker creates a checker for the repos that config returns,
+// which is usually ResticCollector.Config
+func NewRepoChecker(logger *zap.Logger, opts MetricOptions, config func() config.File, check CheckFunc) *RepoChecker {
+	return &RepoChecker{
+		repoResults: newRepoResults[checkResult](logger, opts, config),
+		check:       check,
+	}
+}
+
+// CheckAll checks every enabled repo with check in turn. Results are
+// recorded as each repo is checked.
+func (c *RepoChecker) CheckAll(ctx context.Context) {
+	for _, entry := range c.config() {
+		if entry.Disabled || entry.Plugin != "" || !entry.Check {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		ctx, logger := withRepo(ctx, c.logger, entry)
+		logger.Info("Checking repo")
+
+		start := time.Now()
+		res, err := c.check(ctx, entry)
+		result := checkResult{errors: len(res.Errors), duration: time.Since(start), time: time.Now()}
+		switch {
+		case err != nil:
+			logger.Error("Error checking repo", zap.String("error_class", repoerr.Class(err)), zap.Error(err))
+			result.errors = -1
+		case len(res.Errors) > 0:
+			logger.Error("Repo check found errors", zap.Int("errors", len(res.Errors)), zap.Error(res.Errors[0]))
+		default:
+			logger.Info("Repo check found no errors", zap.Int("hints", res.Hints), zap.Duration("duration", result.duration))
+		}
+
+		c.set(entry.Repo, result)
+	}
+}
+
+// Run checks repos every interval until ctx is done
+func (c *RepoChecker) Run(ctx context.Context, interval time.Duration) {
+	runEvery(ctx, interval, c.CheckAll)
+}
+
+// enabled excludes repos that are no longer checked
+func (checkResult) enabled(entry *config.Entry) bool {
+	return entry.Check
+}
+
+func (checkResult) describe(m *metricSet) []*prometheus.Desc {
+	return []*prometheus.Desc{m.checkSuccess, m.checkErrors, m.checkDuration, m.checkTime}
+}
+
+func (res checkResult) collect(ch chan<- prometheus.Metric, m *metricSet, name []string) {
+	var success float64
+	if res.errors == 0 {
+		success = 1
+	}
+	ch <- prometheus.MustNewConstMetric(m.checkSuccess, prometheus.GaugeValue, success, name...)
+	if res.errors >= 0 {
+		ch <- prometheus.MustNewConstMetric(m.checkErrors, prometheus.GaugeValue, float64(res.errors), name...)
+	}
+	ch <- prometheus.MustNewConstMetric(m.checkDuration, prometheus.GaugeValue, res.duration.Seconds(), name...)
+	ch <- prometheus.MustNewConstMetric(m.checkTime, prometheus.GaugeValue, float64(res.time.Unix()), name...)
+}
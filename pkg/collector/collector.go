@@ -0,0 +1,670 @@
+// Package collector collects the status of restic repos and exports it
+// as Prometheus metrics, either by collecting the repos directly or by
+// federating the status of other instances.
+package collector
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/restic/restic/reporter/pkg/b2api"
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/logctx"
+	"github.com/restic/restic/reporter/pkg/repoerr"
+	"github.com/restic/restic/reporter/pkg/resticrepo"
+	"github.com/restic/restic/reporter/pkg/snapshots"
+	"go.uber.org/zap"
+)
+
+// AllRepoMetrics is the result of a collection run. It's also the
+// document served by the status API so changes to the JSON form must be
+// backwards compatible with older federated instances.
+type AllRepoMetrics struct {
+	Time   time.Time   `json:"time"`
+	Errors int         `json:"errors"`
+	Stats  []RepoStats `json:"stats"`
+}
+
+// Scrubbed returns a copy of the results with the credentials removed
+// from repo names, see config.ScrubRepo. Results must be scrubbed
+// before they leave the process.
+func (m *AllRepoMetrics) Scrubbed() *AllRepoMetrics {
+	out := *m
+	out.Stats = make([]RepoStats, len(m.Stats))
+	for i, stats := range m.Stats {
+		stats.Name = config.ScrubRepo(stats.Name)
+		stats.Aliases = slices.Clone(stats.Aliases)
+		for j := range stats.Aliases {
+			stats.Aliases[j].Name = config.ScrubRepo(stats.Aliases[j].Name)
+		}
+		out.Stats[i] = stats
+	}
+	return &out
+}
+
+// Persisted returns a scrubbed copy of the results in which repos are
+// named by their label, which is unique, rather than by their URI, which
+// may contain credentials. Results must be persisted in this form, see
+// ResticCollector.RestoreStatus.
+func (m *AllRepoMetrics) Persisted() *AllRepoMetrics {
+	out := m.Scrubbed()
+	for i := range out.Stats {
+		out.Stats[i].Name = m.Stats[i].RepoLabel()
+	}
+	return out
+}
+
+// RepoStats is the result of collecting a single repo. ErrorClass is
+// the repoerr class of the error if the repo failed to collect. Time is
+// when the repo was collected, which may be before the time of the
+// collection run if the repo has its own schedule.
+type RepoStats struct {
+	Name       string               `json:"name"`
+	Label      string               `json:"label,omitempty"`
+	Time       time.Time            `json:"time,omitempty"`
+	ReadErrors int                  `json:"read_errors"`
+	ErrorClass string               `json:"error_class,omitempty"`
+	Stats      snapshots.Collection `json:"sets"`
+
+	// MinSnapshots is the number of snapshots that every backup set
+	// should have, see config.Entry.MinSnapshots
+	MinSnapshots int `json:"min_snapshots,omitempty"`
+
+	// LegacyDays and StaleDays are the ages in days after which backup
+	// sets are legacy and stale, see config.Entry.LegacyDays. Zero is
+	// snapshots.DefaultLegacyDays.
+	LegacyDays int `json:"legacy_days,omitempty"`
+	StaleDays  int `json:"stale_days,omitempty"`
+
+	// Aliases are previous names of the repo that are also exported
+	// until they expire, see config.PreviousName
+	Aliases []RepoAlias `json:"aliases,omitempty"`
+
+	// SizeBytes is the space used by the repo and SizeBudget what it may
+	// use, both zero unless the repo has a size budget. SizeHistory are
+	// recent sizes for measuring its growth.
+	SizeBytes   int64        `json:"size_bytes,omitempty"`
+	SizeBudget  int64        `json:"size_budget_bytes,omitempty"`
+	SizeHistory []SizeSample `json:"size_history,omitempty"`
+
+	// Index is the totals of the index of a repo with stats, see
+	// resticrepo.IndexStats
+	Index *resticrepo.IndexStats `json:"index,omitempty"`
+
+	// Forgettable is the number of snapshots that the forget_policy of
+	// the repo would remove, see resticrepo.Repo.Forgettable
+	Forgettable *int `json:"forgettable,omitempty"`
+
+	// Locks are the locks held on the repo by other processes when it
+	// was collected and LocksTime when they were read, zero if they
+	// weren't, see LockChecker
+	Locks     []resticrepo.LockInfo `json:"locks,omitempty"`
+	LocksTime time.Time             `json:"locks_time,omitempty"`
+
+	// IndexFiles are the shortened IDs of the index files of the repo
+	// when it was collected and LastPrune when it was first collected
+	// after a prune, zero if none has been seen, see lastPrune
+	IndexFiles []string  `json:"index_files,omitempty"`
+	LastPrune  time.Time `json:"last_prune,omitempty"`
+
+	// Keys is the number of key files of the repo, zero if they
+	// weren't listed
+	Keys int `json:"keys,omitempty"`
+
+	// Version is the format version of the repo, zero if it's unknown
+	Version uint `json:"version,omitempty"`
+
+	// B2Usage is what B2 stores for a B2 repo with b2_usage, see
+	// b2api.Usage
+	B2Usage *b2api.Usage `json:"b2_usage,omitempty"`
+
+	// S3StorageClasses is what S3 stores for an S3 repo with
+	// s3_storage_classes by storage class
+	S3StorageClasses map[string]resticrepo.S3StorageClass `json:"s3_storage_classes,omitempty"`
+
+	// DeleteAccess is whether an append_only repo allows deletes, one
+	// of forbidden, allowed or unknown
+	DeleteAccess string `json:"delete_access,omitempty"`
+
+	// GroupBy is the grouping of the backup sets of the repo in the
+	// format of snapshots.ParseGroupBy
+	GroupBy string `json:"group_by,omitempty"`
+
+	// Hosts and Users are the number of distinct hosts and users with
+	// snapshots in the repo, counted before the label policy is applied
+	Hosts int `json:"hosts,omitempty"`
+	Users int `json:"users,omitempty"`
+
+	// ExpectedHosts is whether each of the hosts that the repo is
+	// expected to have snapshots of has any, keyed by the host label
+	// after the label policy is applied
+	ExpectedHosts map[string]bool `json:"expected_hosts,omitempty"`
+
+	// Ages are the ages of the snapshots in the repo when it was
+	// collected, nil unless exporting histograms
+	Ages *snapshots.Distribution `json:"ages,omitempty"`
+
+	// Team and Environment are the team and environment of the repo in
+	// the configuration, see config.Entry.Team
+	Team        string `json:"team,omitempty"`
+	Environment string `json:"environment,omitempty"`
+
+	// Labels are the labels of the repo in the configuration, see
+	// config.Entry.Labels
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// RepoAlias is a previous name of a repo
+type RepoAlias struct {
+	Name  string    `json:"name"`
+	Until time.Time `json:"until"`
+}
+
+// RepoLabel returns the name that the repo is exported as, the name in
+// its configuration if it has one and otherwise its scrubbed URI, see
+// config.Entry.Label
+func (s RepoStats) RepoLabel() string {
+	if s.Label != "" {
+		return s.Label
+	}
+	return config.ScrubRepo(s.Name)
+}
+
+// names returns the names that the repo is exported as at now, which
+// is its label followed by the aliases that haven't expired, all
+// scrubbed
+func (s RepoStats) names(now time.Time) []string {
+	names := []string{s.RepoLabel()}
+	for _, alias := range s.Aliases {
+		if now.Before(alias.Until) {
+			names = append(names, config.ScrubRepo(alias.Name))
+		}
+	}
+	return names
+}
+
+// repoAliases converts the previous names of a repo into aliases. The
+// configuration has already been validated so invalid times are ignored.
+func repoAliases(cfg *config.Entry) []RepoAlias {
+	var aliases []RepoAlias
+	for _, p := range cfg.PreviousNames {
+		if until, err := p.Expiry(); err == nil {
+			aliases = append(aliases, RepoAlias{Name: p.Name, Until: until})
+		}
+	}
+	return aliases
+}
+
+// ResticCollector collects the repos in a configuration file and
+// exports the results of the most recent collection as metrics.
+type ResticCollector struct {
+	config      atomic.Pointer[config.File]
+	metrics     atomic.Pointer[AllRepoMetrics]
+	wait        *sync.WaitGroup // held by gatherOne to prevent leaving stale locks
+	logger      *zap.Logger
+	reader      RepoReader
+	metricSets  []*metricSet
+	groupBy     snapshots.GroupBy
+	seriesWarn  int
+	histograms  bool
+	repoTimeout time.Duration
+	onCollected []func(context.Context, *AllRepoMetrics)
+	isLeader    func() bool // nil unless running with leader election
+
+	mu      sync.Mutex      // protects running and merging results
+	running map[string]bool // repos currently being collected
+	hooksMu sync.Mutex      // held while calling onCollected, see runHooks
+	pending atomic.Int64    // len(running), which Collect reads without mu
+	active  atomic.Int64    // number of running gatherOne calls
+
+	// Collection runs that completed, that were skipped entirely since
+	// all of their repos were already being collected, and the repos
+	// that were skipped
+	rounds        atomic.Uint64
+	roundsSkipped atomic.Uint64
+	reposSkipped  atomic.Uint64
+}
+
+func NewResticCollector(logger *zap.Logger) *ResticCollector {
+	return NewResticCollectorWithReader(logger, DefaultReader{})
+}
+
+// NewResticCollectorWithReader creates a collector that reads repos
+// with reader instead of from restic
+func NewResticCollectorWithReader(logger *zap.Logger, reader RepoReader) *ResticCollector {
+	return &ResticCollector{
+		wait:        &sync.WaitGroup{},
+		logger:      logger,
+		reader:      reader,
+		metricSets:  DefaultMetricOptions().metricSets(),
+		groupBy:     snapshots.DefaultGroupBy,
+		repoTimeout: DefaultRepoTimeout,
+		running:     map[string]bool{},
+	}
+}
+
+// SetConfig replaces the configuration used for collections without
+// loading a configuration file
+func (c *ResticCollector) SetConfig(cfg config.File) {
+	c.config.Store(&cfg)
+}
+
+func (c *ResticCollector) ReloadConfig(ctx context.Context, filenames []string, providers config.SecretProviders) error {
+	cfg, err := config.LoadAll(ctx, filenames, providers)
+	if err != nil {
+		return err
+	}
+	c.SetConfig(cfg)
+	return nil
+}
+
+// Config returns the configuration currently used for collections
+func (c *ResticCollector) Config() config.File {
+	if cfg := c.config.Load(); cfg != nil {
+		return *cfg
+	}
+	return nil
+}
+
+// OnCollected registers a function to be called with the results of
+// every collection run once it has completed. The results include the
+// most recent results of repos that weren't part of the run. Functions
+// are called in the order in which they were registered, each with a
+// context that's cancelled after hookTimeout, see runHooks. This must
+// not be called once collections have started.
+func (c *ResticCollector) OnCollected(fn func(context.Context, *AllRepoMetrics)) {
+	c.onCollected = append(c.onCollected, fn)
+}
+
+// SetLeader skips all collections while isLeader returns false, so that
+// only one of several replicas collects repos. The others serve the
+// results restored with RestoreStatus. This must not be called once
+// collections have started.
+func (c *ResticCollector) SetLeader(isLeader func() bool) {
+	c.isLeader = isLeader
+}
+
+// RestoreStatus replaces the results of the most recent collection, such
+// as with results persisted by another replica, see
+// AllRepoMetrics.Persisted. Repos are found in the configuration by
+// label, or by URI in results persisted before they were named by
+// label, and repos that aren't configured are dropped.
+func (c *ResticCollector) RestoreStatus(metrics *AllRepoMetrics) {
+	var cfg config.File
+	if p := c.config.Load(); p != nil {
+		cfg = *p
+	}
+
+	out := *metrics
+	out.Stats = make([]RepoStats, 0, len(metrics.Stats))
+	for _, stats := range metrics.Stats {
+		entry := cfg.Find(stats.Name)
+		if entry == nil {
+			continue
+		}
+		stats.Name = entry.Repo
+		out.Stats = append(out.Stats, stats)
+	}
+	c.metrics.Store(&out)
+}
+
+func (c *ResticCollector) gatherOne(ctx context.Context, cfg *config.Entry, done chan RepoStats) {
+	c.wait.Add(1)
+	defer c.wait.Done()
+	c.active.Add(1)
+	defer c.active.Add(-1)
+
+	ctx, logger := logctx.WithFields(ctx, zap.String("repo", config.ScrubRepo(cfg.Repo)), zap.String("backend", cfg.Backend()))
+	groupBy := cfg.GroupByOr(c.groupBy)
+
+	for name := range cfg.Labels {
+		if !slices.Contains(c.metricSets[0].extraLabels, name) {
+			logger.Warn("Repo label isn't exported since the exporter wasn't started with it", zap.String("label", name))
+		}
+	}
+
+	// A repo that hangs, such as on a backend that stopped responding,
+	// must not hold the collection run forever
+	readCtx := ctx
+	if c.repoTimeout > 0 {
+		var cancel context.CancelFunc
+		readCtx, cancel = context.WithTimeout(ctx, c.repoTimeout)
+		defer cancel()
+	}
+
+	info, err := c.reader.ReadSnapshots(readCtx, cfg, groupBy, cfg.SnapshotFilter())
+	if err != nil {
+		// Plugins report errors of their own, which may include URLs
+		err = repoerr.Scrub(err)
+		if errors.Is(readCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			err = repoerr.Wrap(repoerr.ErrTimeout, err)
+		}
+		class := repoerr.Class(err)
+		logger.Error("Error reading repo", zap.String("error_class", class), zap.Error(err))
+		done <- RepoStats{Name: cfg.Repo, Time: time.Now(), ReadErrors: 1, ErrorClass: class, MinSnapshots: cfg.MinSnapshots, Aliases: repoAliases(cfg), SizeBudget: cfg.SizeBudgetBytes()}
+		return
+	}
+	col := info.Snapshots
+
+	// Hosts are counted, paths are checked and max ages are set before
+	// the label policy might drop or hash the host
+	hosts, users := col.Hosts(), col.Users()
+	var expectedHosts map[string]bool
+	if len(cfg.ExpectedHosts) > 0 && !groupBy.Host {
+		logger.Warn("Expected hosts can't be checked unless backup sets are grouped by host")
+	} else if len(cfg.ExpectedHosts) > 0 {
+		expectedHosts = map[string]bool{}
+		for host, found := range col.HasHosts(cfg.ExpectedHosts) {
+			if !found {
+				logger.Warn("Expected host has no snapshots", zap.String("host", host))
+			}
+			expectedHosts[cfg.HostLabel(host)] = found
+		}
+	}
+	if len(cfg.ExpectedPaths) > 0 {
+		col.CheckPaths(cfg.ExpectedPathsFor)
+		for _, set := range col {
+			if len(set.MissingPaths) > 0 {
+				logger.Warn("Newest snapshot is missing expected paths",
+					zap.String("host", set.Host), zap.String("user", set.Username), zap.Strings("missing_paths", set.MissingPaths))
+			}
+		}
+	}
+
+	if cfg.MaxAgeHours > 0 || len(cfg.HostMaxAgeHours) > 0 {
+		col.SetMaxAge(cfg.MaxAgeFor)
+	}
+
+	col = cfg.ApplyLabelPolicy(col)
+
+	var ladder snapshots.Ladder
+	if cfg.RetentionLadder != nil {
+		ladder = *cfg.RetentionLadder
+	}
+	now := time.Now()
+	var ages *snapshots.Distribution
+	if c.histograms {
+		ages = col.Ages(now)
+	}
+	col.CheckDaily(now, cfg.CoverageDays)
+	col.CheckCadence()
+	col.CheckCoverage(now, ladder)
+	col.KeepRecent(cfg.SnapshotMetrics)
+
+	if series := len(col) * (seriesPerSet + cfg.SnapshotMetrics) * len(c.metricSets); c.seriesWarn > 0 && series > c.seriesWarn {
+		logger.Warn("Repo exports more series than the warning threshold, consider a label_policy",
+			zap.Int("series", series), zap.Int("backup_sets", len(col)), zap.Int("threshold", c.seriesWarn))
+	}
+
+	done <- RepoStats{
+		Name:             cfg.Repo,
+		Time:             time.Now(),
+		Stats:            col,
+		MinSnapshots:     cfg.MinSnapshots,
+		Aliases:          repoAliases(cfg),
+		SizeBytes:        info.SizeBytes,
+		SizeBudget:       cfg.SizeBudgetBytes(),
+		Index:            info.Index,
+		Forgettable:      info.Forgettable,
+		Locks:            info.Locks,
+		LocksTime:        info.LocksTime,
+		IndexFiles:       shortIndexIDs(info.IndexFiles),
+		Keys:             info.Keys,
+		Version:          info.Version,
+		B2Usage:          info.B2Usage,
+		S3StorageClasses: info.S3StorageClasses,
+		DeleteAccess:     info.DeleteAccess,
+		GroupBy:          groupBy.String(),
+		Hosts:            hosts,
+		Users:            users,
+		ExpectedHosts:    expectedHosts,
+		Ages:             ages,
+	}
+}
+
+// GatherMetrics collects all enabled repos
+func (c *ResticCollector) GatherMetrics(ctx context.Context) {
+	c.GatherRepos(ctx, nil)
+}
+
+// GatherRepos collects the enabled repos for which include returns true,
+// or all enabled repos if include is nil. The results are merged with
+// those of previous collections of other repos so that repos can be
+// collected on different schedules. Repos that are already being
+// collected are skipped.
+func (c *ResticCollector) GatherRepos(ctx context.Context, include func(*config.Entry) bool) {
+	if c.isLeader != nil && !c.isLeader() {
+		c.logger.Debug("Not the leader, skipping collection")
+		return
+	}
+
+	cfg := c.Config()
+
+	// Every log line for a collection run carries the same run_id so
+	// that logs for a run can be correlated in the log store. The logger
+	// is carried in the context so that this includes the backend.
+	ctx, logger := logctx.WithFields(logctx.With(ctx, c.logger), zap.String("run_id", newRunID()))
+
+	var todo []*config.Entry
+	var skipped uint64
+	c.mu.Lock()
+	for _, entry := range cfg {
+		if entry.Disabled || (include != nil && !include(entry)) {
+			continue
+		}
+		if c.running[entry.Repo] {
+			logger.Warn("Repo is already being collected, skipping", zap.String("repo", config.ScrubRepo(entry.Repo)))
+			skipped++
+			continue
+		}
+		c.running[entry.Repo] = true
+		todo = append(todo, entry)
+	}
+	c.pending.Store(int64(len(c.running)))
+	c.mu.Unlock()
+
+	c.reposSkipped.Add(skipped)
+	if len(todo) == 0 {
+		if skipped > 0 {
+			c.roundsSkipped.Add(1)
+		}
+		logger.Debug("No repos to collect")
+		return
+	}
+
+	done := make(chan RepoStats, len(todo))
+	for _, entry := range todo {
+		logger.Debug("Collecting repo", zap.String("repo", config.ScrubRepo(entry.Repo)))
+		go c.gatherOne(ctx, entry, done)
+	}
+
+	fresh := map[string]RepoStats{}
+	for range todo {
+		stats := <-done
+		logger.Debug("Finished collecting repo", zap.String("repo", config.ScrubRepo(stats.Name)))
+		fresh[stats.Name] = stats
+	}
+	logger.Debug("All jobs done")
+
+	c.mu.Lock()
+	for _, entry := range todo {
+		delete(c.running, entry.Repo)
+	}
+	c.pending.Store(int64(len(c.running)))
+	c.metrics.Store(mergeRepoStats(cfg, c.metrics.Load(), fresh))
+	c.rounds.Add(1)
+	c.mu.Unlock()
+
+	c.runHooks(ctx)
+	logger.Sync()
+}
+
+// hookTimeout is how long each function registered with OnCollected may
+// take before its context is cancelled
+const hookTimeout = time.Minute
+
+// runHooks calls the functions registered with OnCollected with the most
+// recent results. They publish over the network or write files, so
+// they're run without holding mu so that they don't block scrapes or
+// other collections, and one collection run at a time. Runs that finish
+// together may see the same results since each gets the most recent
+// ones, which is never older than its own.
+func (c *ResticCollector) runHooks(ctx context.Context) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+
+	metrics := c.metrics.Load()
+	for _, fn := range c.onCollected {
+		hctx, cancel := context.WithTimeout(ctx, hookTimeout)
+		fn(hctx, metrics)
+		cancel()
+	}
+}
+
+// mergeRepoStats combines the results of a collection with the previous
+// results for repos that weren't collected. The stats are in the order
+// of the configuration and repos no longer in the configuration, or that
+// are disabled, are dropped.
+func mergeRepoStats(cfg config.File, prev *AllRepoMetrics, fresh map[string]RepoStats) *AllRepoMetrics {
+	old := map[string]RepoStats{}
+	if prev != nil {
+		for _, stats := range prev.Stats {
+			old[stats.Name] = stats
+		}
+	}
+
+	metrics := &AllRepoMetrics{
+		Time:  time.Now(),
+		Stats: make([]RepoStats, 0, len(cfg)),
+	}
+
+	for _, entry := range cfg {
+		stats, ok := fresh[entry.Repo]
+		if ok {
+			// A repo that couldn't be read keeps the backup sets of its
+			// previous collection, and with them their new snapshot
+			// counters, rather than dropping every series until it can
+			// be read again. Sets can only be missing if the repo could
+			// be read, and those of excluded hosts and users are
+			// forgotten.
+			if stats.ReadErrors > 0 {
+				stats.Stats = old[entry.Repo].Stats
+			} else {
+				stats.Stats.CountNew(old[entry.Repo].Stats)
+				stats.Stats.CarryMissing(old[entry.Repo].Stats.DropIgnored(entry.SnapshotFilter()), stats.Time)
+			}
+
+			// Growth is measured across collections, a size that
+			// couldn't be read keeps the history for the next one
+			if stats.SizeBytes > 0 {
+				stats.SizeHistory = addSizeSample(old[entry.Repo].SizeHistory, stats.Time, stats.SizeBytes)
+			} else {
+				stats.SizeHistory = old[entry.Repo].SizeHistory
+			}
+
+			// Prunes are also detected across collections
+			if stats.IndexFiles != nil {
+				stats.LastPrune = lastPrune(old[entry.Repo].IndexFiles, stats.IndexFiles, old[entry.Repo].LastPrune, stats.Time)
+			} else {
+				stats.IndexFiles, stats.LastPrune = old[entry.Repo].IndexFiles, old[entry.Repo].LastPrune
+			}
+		} else {
+			stats, ok = old[entry.Repo]
+		}
+		if !ok || entry.Disabled {
+			continue
+		}
+
+		// The configuration may have changed since the repo was
+		// collected
+		stats.Label, stats.Team, stats.Environment = entry.Name, entry.Team, entry.Environment
+		stats.Labels = entry.Labels
+		stats.LegacyDays, stats.StaleDays = entry.LegacyDaysOr(), entry.StaleDaysOr()
+		if entry.DropAfterDays > 0 {
+			stats.Stats = stats.Stats.DropAgedOut(metrics.Time, entry.DropAfterDays)
+		}
+		if entry.MissingTTLDays > 0 {
+			stats.Stats = stats.Stats.DropMissing(metrics.Time, time.Duration(entry.MissingTTLDays)*24*time.Hour)
+		}
+
+		metrics.Stats = append(metrics.Stats, stats)
+		if stats.ReadErrors > 0 {
+			metrics.Errors += 1
+		}
+	}
+
+	return metrics
+}
+
+// newRunID generates a short random identifier for a collection run
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (c *ResticCollector) Shutdown() {
+	c.wait.Wait()
+}
+
+// SetMetricOptions changes the names of the exported metrics. This must
+// be called before the collector is registered.
+func (c *ResticCollector) SetMetricOptions(opts MetricOptions) {
+	c.metricSets = opts.metricSets()
+	c.groupBy = opts.GroupBy
+	c.seriesWarn = opts.SeriesWarn
+	c.histograms = opts.Histograms
+	c.repoTimeout = opts.RepoTimeout
+}
+
+func (c *ResticCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.metricSets {
+		m.describeRepoMetrics(ch)
+		ch <- m.haLeader
+		ch <- m.activeCollections
+		ch <- m.reposPending
+		ch <- m.rounds
+		ch <- m.roundsSkipped
+		ch <- m.reposSkipped
+	}
+}
+
+// Status returns the results of the most recent collection run. It will
+// be nil if no collection has completed.
+func (c *ResticCollector) Status() *AllRepoMetrics {
+	return c.metrics.Load()
+}
+
+func (c *ResticCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics := c.metrics.Load()
+	pending := c.pending.Load()
+
+	for _, m := range c.metricSets {
+		ch <- prometheus.MustNewConstMetric(m.activeCollections, prometheus.GaugeValue, float64(c.active.Load()))
+		ch <- prometheus.MustNewConstMetric(m.reposPending, prometheus.GaugeValue, float64(pending))
+		ch <- prometheus.MustNewConstMetric(m.rounds, prometheus.CounterValue, float64(c.rounds.Load()))
+		ch <- prometheus.MustNewConstMetric(m.roundsSkipped, prometheus.CounterValue, float64(c.roundsSkipped.Load()))
+		ch <- prometheus.MustNewConstMetric(m.reposSkipped, prometheus.CounterValue, float64(c.reposSkipped.Load()))
+
+		// A standby may not have any results until the leader persists
+		// some
+		if metrics != nil {
+			m.collectRepoMetrics(ch, metrics)
+		}
+
+		if c.isLeader != nil {
+			var leader float64
+			if c.isLeader() {
+				leader = 1
+			}
+			ch <- prometheus.MustNewConstMetric(m.haLeader, prometheus.GaugeValue, leader)
+		}
+	}
+}
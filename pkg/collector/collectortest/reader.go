@@ -0,0 +1,124 @@
+// Package collectortest provides an in-memory collector.RepoReader so
+// that collectors can be exercised without any real repos.
+package collectortest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/collector"
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/snapshots"
+)
+
+// Repo is the canned result of reading a single repo
+type Repo struct {
+	Snapshots snapshots.Collection
+	Err       error
+
+	// SizeBytes is returned as the size of the repo, see
+	// collector.RepoInfo
+	SizeBytes int64
+
+	// Delay is how long reading the repo takes. Reads return early with
+	// the context error if the context is done first.
+	Delay time.Duration
+}
+
+// Reader is a collector.RepoReader that returns canned results keyed by
+// repo URI. Reading a repo that isn't in Repos fails. Repos must not be
+// modified once reads have started.
+type Reader struct {
+	Repos map[string]Repo
+
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+// NewReader creates a reader with no repos
+func NewReader() *Reader {
+	return &Reader{Repos: map[string]Repo{}}
+}
+
+// allFields groups by every field so that no detail of the canned
+// snapshots is lost before they're grouped when read
+var allFields = snapshots.GroupBy{Host: true, User: true, Tags: true, Paths: true}
+
+// Add adds the canned result for a repo. The snapshots are added to the
+// backup sets in a new collection as if they had been read from restic.
+func (r *Reader) Add(uri string, sets ...snapshots.Info) {
+	col := snapshots.Collection{}
+	for _, set := range sets {
+		for i := 0; i < max(set.Count, 1); i++ {
+			col.AddSnapshot(allFields, snapshot(&set))
+		}
+	}
+	r.Repos[uri] = Repo{Snapshots: col}
+}
+
+// snapshot is a snapshot in a canned backup set
+func snapshot(set *snapshots.Info) snapshots.Snapshot {
+	sn := snapshots.Snapshot{Username: set.Username, Hostname: set.Host, Time: set.Time}
+	if set.Tags != "" {
+		sn.Tags = strings.Split(set.Tags, ",")
+	}
+	if set.Paths != "" {
+		sn.Paths = strings.Split(set.Paths, ",")
+	}
+	return sn
+}
+
+// Fail makes reading a repo return err
+func (r *Reader) Fail(uri string, err error) {
+	r.Repos[uri] = Repo{Err: err}
+}
+
+// Reads returns the number of times a repo has been read
+func (r *Reader) Reads(uri string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reads[uri]
+}
+
+func (r *Reader) ReadSnapshots(ctx context.Context, entry *config.Entry, groupBy snapshots.GroupBy, filter snapshots.Filter) (collector.RepoInfo, error) {
+	r.mu.Lock()
+	if r.reads == nil {
+		r.reads = map[string]int{}
+	}
+	r.reads[entry.Repo]++
+	r.mu.Unlock()
+
+	repo, ok := r.Repos[entry.Repo]
+	if !ok {
+		return collector.RepoInfo{}, fmt.Errorf("No such repo %q", entry.Repo)
+	}
+
+	if repo.Delay > 0 {
+		select {
+		case <-time.After(repo.Delay):
+		case <-ctx.Done():
+			return collector.RepoInfo{}, ctx.Err()
+		}
+	}
+
+	if repo.Err != nil {
+		return collector.RepoInfo{}, repo.Err
+	}
+
+	// Callers own the returned collection so it must be a copy. The
+	// canned sets are regrouped as they would be when read from restic.
+	out := snapshots.Collection{}
+	for _, set := range repo.Snapshots {
+		sn := snapshot(set)
+		if filter.Ignored(sn) {
+			continue
+		}
+		for i := 0; i < max(set.Count, 1); i++ {
+			out.AddSnapshot(groupBy, sn)
+		}
+	}
+	return collector.RepoInfo{Snapshots: out, SizeBytes: repo.SizeBytes}, nil
+}
@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CompatNgosang exports the metrics of ngosang/restic-exporter in
+// addition to the native metrics
+const CompatNgosang = "ngosang"
+
+// compatMetrics are the metrics of another restic exporter, computed
+// from the same results as the native metrics, so that dashboards and
+// alerts built for it keep working while migrating. Only the metrics
+// that can be computed from snapshot listings are exported.
+type compatMetrics struct {
+	snapshotsTotal       *prometheus.Desc
+	backupTimestamp      *prometheus.Desc
+	backupSnapshotsTotal *prometheus.Desc
+}
+
+// validateCompat checks that the name of a compatibility mode is known
+func validateCompat(name string) error {
+	switch name {
+	case "", CompatNgosang:
+		return nil
+	default:
+		return fmt.Errorf("Unknown metric compatibility mode %q, must be %s", name, CompatNgosang)
+	}
+}
+
+// newNgosangMetrics creates the metrics of ngosang/restic-exporter. It
+// only reads a single repo so its metrics have no repo label, the repo
+// label is added so that series from several repos don't collide.
+func newNgosangMetrics(repoLabel string) *compatMetrics {
+	setLabels := []string{repoLabel, "client_hostname", "client_username", "snapshot_tags", "snapshot_paths"}
+
+	return &compatMetrics{
+		snapshotsTotal: prometheus.NewDesc(
+			"restic_snapshots_total",
+			"Total number of snapshots",
+			[]string{repoLabel}, nil,
+		),
+		backupTimestamp: prometheus.NewDesc(
+			"restic_backup_timestamp",
+			"Timestamp of the last backup",
+			setLabels, nil,
+		),
+		backupSnapshotsTotal: prometheus.NewDesc(
+			"restic_backup_snapshots_total",
+			"Total number of snapshots",
+			setLabels, nil,
+		),
+	}
+}
+
+func (m *compatMetrics) describe(ch chan<- *prometheus.Desc) {
+	ch <- m.snapshotsTotal
+	ch <- m.backupTimestamp
+	ch <- m.backupSnapshotsTotal
+}
+
+func (m *compatMetrics) collect(ch chan<- prometheus.Metric, stats RepoStats) {
+	// Repos that failed to read have no snapshots to report, which is
+	// reported by the native read error metrics
+	if stats.ReadErrors > 0 {
+		return
+	}
+
+	total := 0
+	for _, set := range stats.Stats {
+		total += set.Count
+
+		ch <- prometheus.MustNewConstMetric(
+			m.backupTimestamp, prometheus.GaugeValue, float64(set.Time.Unix()),
+			stats.Name, set.Host, set.Username, set.Tags, set.Paths,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			m.backupSnapshotsTotal, prometheus.CounterValue, float64(set.Count),
+			stats.Name, set.Host, set.Username, set.Tags, set.Paths,
+		)
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		m.snapshotsTotal, prometheus.CounterValue, float64(total),
+		stats.Name,
+	)
+}
@@ -0,0 +1,177 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// StatusAPIPath is the path of the JSON status document served by every
+// instance and consumed by federating instances.
+const StatusAPIPath = "/api/v1/status"
+
+// FederatedSite is a remote restic-reporter instance whose status is
+// re-exported by a federating instance.
+type FederatedSite struct {
+	Name       string
+	URL        string
+	metricSets []*metricSet
+	up         atomic.Bool
+	metrics    atomic.Pointer[AllRepoMetrics]
+}
+
+// ParseFederatedSite parses a site in the form name=url where url is the
+// base URL of the remote instance.
+func ParseFederatedSite(v string) (*FederatedSite, error) {
+	name, url, ok := strings.Cut(v, "=")
+	if !ok || name == "" || url == "" {
+		return nil, fmt.Errorf("Invalid federated site %q, must be name=url", v)
+	}
+	return &FederatedSite{Name: name, URL: strings.TrimRight(url, "/")}, nil
+}
+
+// Describe and Collect export the metrics from the last successful
+// fetch of the site. The site label is applied by wrapping the
+// registerer in FederationCollector.Register.
+func (s *FederatedSite) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range s.metricSets {
+		m.describeRepoMetrics(ch)
+	}
+}
+
+func (s *FederatedSite) Collect(ch chan<- prometheus.Metric) {
+	if metrics := s.metrics.Load(); metrics != nil {
+		for _, m := range s.metricSets {
+			m.collectRepoMetrics(ch, metrics)
+		}
+	}
+}
+
+// FederationCollector fetches the status of several remote instances
+// and re-exports their metrics with a site label. This allows a central
+// Prometheus to monitor sites that it can't reach directly without each
+// site needing to be able to reach every repository.
+type FederationCollector struct {
+	sites      []*FederatedSite
+	metricSets []*metricSet
+	client     *http.Client
+	logger     *zap.Logger
+	sync.Mutex // prevents concurrent collections
+}
+
+func NewFederationCollector(logger *zap.Logger, sites []*FederatedSite) *FederationCollector {
+	c := &FederationCollector{
+		sites:  sites,
+		client: &http.Client{Timeout: time.Minute},
+		logger: logger,
+	}
+	c.SetMetricOptions(DefaultMetricOptions())
+	return c
+}
+
+// SetMetricOptions changes the names of the exported metrics for the
+// collector and all sites. This must be called before Register.
+func (c *FederationCollector) SetMetricOptions(opts MetricOptions) {
+	c.metricSets = opts.metricSets()
+	for _, site := range c.sites {
+		site.metricSets = c.metricSets
+	}
+}
+
+// Register registers the collector and one collector per site with the
+// registerer.
+func (c *FederationCollector) Register(reg prometheus.Registerer) error {
+	if err := reg.Register(c); err != nil {
+		return err
+	}
+	for _, site := range c.sites {
+		wrapped := prometheus.WrapRegistererWith(prometheus.Labels{"site": site.Name}, reg)
+		if err := wrapped.Register(site); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *FederationCollector) fetchOne(ctx context.Context, site *FederatedSite) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, site.URL+StatusAPIPath, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Status request returned %s", res.Status)
+	}
+
+	var metrics AllRepoMetrics
+	if err := json.NewDecoder(res.Body).Decode(&metrics); err != nil {
+		return err
+	}
+	site.metrics.Store(&metrics)
+
+	return nil
+}
+
+// GatherMetrics fetches the status of all sites concurrently. Sites that
+// fail to respond continue to export the last status that was fetched
+// from them and are reported as down.
+func (c *FederationCollector) GatherMetrics(ctx context.Context) {
+	if !c.TryLock() {
+		c.logger.Error("GatherMetrics already running, can not start another instance")
+		return
+	}
+	defer c.Unlock()
+
+	wg := &sync.WaitGroup{}
+	for _, site := range c.sites {
+		wg.Add(1)
+		go func(site *FederatedSite) {
+			defer wg.Done()
+
+			c.logger.Debug("Fetching federated site", zap.String("site", site.Name))
+			if err := c.fetchOne(ctx, site); err != nil {
+				c.logger.Error("Error fetching federated site", zap.String("site", site.Name), zap.Error(err))
+				site.up.Store(false)
+				return
+			}
+			site.up.Store(true)
+		}(site)
+	}
+	wg.Wait()
+}
+
+func (c *FederationCollector) Shutdown() {}
+
+func (c *FederationCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.metricSets {
+		ch <- m.federationSiteUp
+	}
+}
+
+func (c *FederationCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, site := range c.sites {
+		var up float64
+		if site.up.Load() {
+			up = 1
+		}
+		for _, m := range c.metricSets {
+			ch <- prometheus.MustNewConstMetric(
+				m.federationSiteUp, prometheus.GaugeValue, up, site.Name,
+			)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/restic/restic/reporter/pkg/snapshots"
+)
+
+// distributionMetric exports a snapshots.Distribution as a histogram
+// with both native and classic buckets. Scrapers that negotiate native
+// histograms use the native buckets and others, including every text
+// format, fall back to the classic buckets with bounds.
+func distributionMetric(desc *prometheus.Desc, d *snapshots.Distribution, bounds []float64, created time.Time, labels ...string) prometheus.Metric {
+	return &dualHistogram{
+		native: prometheus.MustNewConstNativeHistogram(
+			desc, d.Count, d.Sum, d.Native, nil, d.Zero, snapshots.NativeSchema, 0, created,
+			labels...,
+		),
+		classic: prometheus.MustNewConstHistogram(desc, d.Count, d.Sum, d.Cumulative(bounds), labels...),
+	}
+}
+
+// dualHistogram is a native histogram that also has the buckets of a
+// classic histogram, which client_golang has no constant metric for
+type dualHistogram struct {
+	native  prometheus.Metric
+	classic prometheus.Metric
+}
+
+func (h *dualHistogram) Desc() *prometheus.Desc {
+	return h.native.Desc()
+}
+
+func (h *dualHistogram) Write(out *dto.Metric) error {
+	var classic dto.Metric
+	if err := h.classic.Write(&classic); err != nil {
+		return err
+	}
+	if err := h.native.Write(out); err != nil {
+		return err
+	}
+	out.Histogram.Bucket = classic.Histogram.Bucket
+	return nil
+}
@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SchedulerCollector exports how long ago the scheduler last ran a job
+// so that a scheduler that has silently stopped can be alerted on, and
+// when the exporter started. It's separate from the other collectors
+// since every mode has a scheduler.
+type SchedulerCollector struct {
+	lastRun    func() time.Time
+	blackout   func() bool // nil unless there is a blackout calendar
+	started    time.Time
+	metricSets []*metricSet
+}
+
+// NewSchedulerCollector creates a collector for a scheduler, lastRun is
+// usually schedule.Scheduler.LastRun. The exporter is considered started
+// when this is called.
+func NewSchedulerCollector(opts MetricOptions, lastRun func() time.Time) *SchedulerCollector {
+	return &SchedulerCollector{lastRun: lastRun, started: time.Now(), metricSets: opts.metricSets()}
+}
+
+// SetBlackout also exports whether scheduled jobs are being skipped,
+// which active returns. This must be called before the collector is
+// registered.
+func (c *SchedulerCollector) SetBlackout(active func() bool) {
+	c.blackout = active
+}
+
+func (c *SchedulerCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.metricSets {
+		ch <- m.startTime
+		ch <- m.schedulerIdle
+		ch <- m.schedulerBlackout
+	}
+}
+
+func (c *SchedulerCollector) Collect(ch chan<- prometheus.Metric) {
+	var blackout float64
+	if c.blackout != nil && c.blackout() {
+		blackout = 1
+	}
+
+	for _, m := range c.metricSets {
+		ch <- prometheus.MustNewConstMetric(m.startTime, prometheus.GaugeValue, float64(c.started.UnixNano())/1e9)
+		if c.blackout != nil {
+			ch <- prometheus.MustNewConstMetric(m.schedulerBlackout, prometheus.GaugeValue, blackout)
+		}
+	}
+
+	// Not started yet
+	last := c.lastRun()
+	if last.IsZero() {
+		return
+	}
+
+	for _, m := range c.metricSets {
+		ch <- prometheus.MustNewConstMetric(m.schedulerIdle, prometheus.GaugeValue, time.Since(last).Seconds())
+	}
+}
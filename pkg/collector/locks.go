@@ -0,0 +1,152 @@
+package collector
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/repoerr"
+	"github.com/restic/restic/reporter/pkg/resticrepo"
+	"go.uber.org/zap"
+)
+
+// LockFunc returns the locks held on a repo
+type LockFunc func(ctx context.Context, entry *config.Entry) ([]resticrepo.LockInfo, error)
+
+// DefaultLocks reads the locks of a repo with resticrepo.Locks
+func DefaultLocks(ctx context.Context, entry *config.Entry) ([]resticrepo.LockInfo, error) {
+	return resticrepo.Locks(ctx, entry.Repo, entry.Password, entry.ExtraConfig())
+}
+
+// lockResult is the most recent read of the locks of a repo
+type lockResult struct {
+	locks []resticrepo.LockInfo
+	time  time.Time
+}
+
+// LockChecker exports the locks held on repos, which are read by every
+// collection, see Collected, and can be checked more often than repos
+// are collected, so that an exclusive lock left by a hung prune, which
+// blocks every backup to the repo, is noticed within minutes. Checks
+// only list and decrypt the locks so they're much cheaper than a
+// collection. Repos read by plugins aren't checked. Repos whose locks
+// can't be read are logged and have no lock metrics.
+type LockChecker struct {
+	*repoResults[lockResult]
+	locks LockFunc
+}
+
+// NewLockChecker creates a checker for the repos that config returns,
+// which is usually ResticCollector.Config
+func NewLockChecker(logger *zap.Logger, opts MetricOptions, config func() config.File, locks LockFunc) *LockChecker {
+	return &LockChecker{
+		repoResults: newRepoResults[lockResult](logger, opts, config),
+		locks:       locks,
+	}
+}
+
+// CheckAll checks the locks of every enabled repo concurrently
+func (c *LockChecker) CheckAll(ctx context.Context) {
+	type result struct {
+		locks []resticrepo.LockInfo
+		err   error
+	}
+
+	now := time.Now()
+	all := checkRepos(ctx, c.logger, c.config(), func(ctx context.Context, logger *zap.Logger, entry *config.Entry) result {
+		locks, err := c.locks(ctx, entry)
+		if err != nil {
+			logger.Warn("Error checking repo locks", zap.String("error_class", repoerr.Class(err)), zap.Error(err))
+		}
+		for _, lock := range locks {
+			if lock.Exclusive {
+				logger.Info("Repo is exclusively locked", zap.String("host", lock.Hostname), zap.Int("pid", lock.PID), zap.Time("since", lock.Time))
+			}
+		}
+		return result{locks, err}
+	})
+
+	c.update(func(results map[string]lockResult) {
+		for repo, res := range all {
+			if res.err == nil {
+				results[repo] = lockResult{res.locks, now}
+			} else {
+				delete(results, repo)
+			}
+		}
+	})
+}
+
+// Collected records the locks read by a collection run if they're newer
+// than those already checked. It's registered with
+// ResticCollector.OnCollected. Repos that were collected without
+// reading their locks have no lock metrics until they're read again.
+func (c *LockChecker) Collected(_ context.Context, metrics *AllRepoMetrics) {
+	c.update(func(results map[string]lockResult) {
+		for _, stats := range metrics.Stats {
+			if stats.Time.Before(results[stats.Name].time) {
+				continue
+			}
+			if stats.LocksTime.IsZero() {
+				delete(results, stats.Name)
+			} else {
+				results[stats.Name] = lockResult{stats.Locks, stats.LocksTime}
+			}
+		}
+	})
+}
+
+// Run checks locks every interval until ctx is done
+func (c *LockChecker) Run(ctx context.Context, interval time.Duration) {
+	runEvery(ctx, interval, c.CheckAll)
+}
+
+func (lockResult) enabled(*config.Entry) bool {
+	return true
+}
+
+func (lockResult) describe(m *metricSet) []*prometheus.Desc {
+	return []*prometheus.Desc{m.lockCount, m.exclusiveLocked, m.oldestLockAge, m.lockInfo}
+}
+
+func (res lockResult) collect(ch chan<- prometheus.Metric, m *metricSet, name []string) {
+	var exclusive, shared float64
+	var oldest time.Time
+	seen := map[string]bool{}
+	for _, lock := range res.locks {
+		typ := "shared"
+		if lock.Exclusive {
+			exclusive++
+			typ = "exclusive"
+		} else {
+			shared++
+		}
+
+		// A process that holds several locks at once is only exported
+		// once
+		info := []string{lock.Hostname, lock.Username, strconv.Itoa(lock.PID), typ, lock.Time.UTC().Format(time.RFC3339)}
+		if key := strings.Join(info, "\x00"); !seen[key] {
+			seen[key] = true
+			ch <- prometheus.MustNewConstMetric(m.lockInfo, prometheus.GaugeValue, 1, append(slices.Clone(name), info...)...)
+		}
+
+		if oldest.IsZero() || lock.Time.Before(oldest) {
+			oldest = lock.Time
+		}
+	}
+
+	var locked float64
+	if exclusive > 0 {
+		locked = 1
+	}
+	ch <- prometheus.MustNewConstMetric(m.exclusiveLocked, prometheus.GaugeValue, locked, name...)
+	ch <- prometheus.MustNewConstMetric(m.lockCount, prometheus.GaugeValue, exclusive, append(slices.Clone(name), "exclusive")...)
+	ch <- prometheus.MustNewConstMetric(m.lockCount, prometheus.GaugeValue, shared, append(slices.Clone(name), "shared")...)
+	if !oldest.IsZero() {
+		ch <- prometheus.MustNewConstMetric(m.oldestLockAge, prometheus.GaugeValue, time.Since(oldest).Seconds(), name...)
+	}
+}
@@ -0,0 +1,994 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/snapshots"
+)
+
+const (
+	// DefaultNamespace and DefaultRepoLabel are the metric namespace and
+	// the name of the label holding the repo that have always been used,
+	// so existing dashboards and alerts depend on them
+	DefaultNamespace = "backup"
+	DefaultRepoLabel = "url"
+
+	// DefaultSeriesWarn is the number of series for a single repo above
+	// which a warning is logged
+	DefaultSeriesWarn = 1000
+
+	// DefaultRepoTimeout is how long reading a single repo may take
+	// before it's abandoned
+	DefaultRepoTimeout = time.Hour
+)
+
+// seriesPerSet is the number of series exported for each backup set
+const seriesPerSet = 8
+
+var validMetricName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// MetricOptions controls the names of the exported metrics
+type MetricOptions struct {
+	Namespace string
+	RepoLabel string
+
+	// Legacy also exports every series with the default namespace and
+	// repo label so that dashboards and alerts can be migrated to new
+	// names before the old ones are dropped
+	Legacy bool
+
+	// GroupBy decides how snapshots are grouped into backup sets for
+	// repos without their own group_by. Every backup set has all of the
+	// labels of the fields that it could be grouped by, which are empty
+	// for those it isn't.
+	GroupBy snapshots.GroupBy
+
+	// SeriesWarn logs a warning for repos that export more than this
+	// many series, zero disables the warning
+	SeriesWarn int
+
+	// Compat also exports the metrics of another exporter, see
+	// CompatNgosang
+	Compat string
+
+	// Histograms exports the distributions of the ages and sizes of the
+	// snapshots of every repo, see distributionMetric
+	Histograms bool
+
+	// RepoTimeout is how long reading a single repo may take before it's
+	// abandoned and reported as a timeout, zero disables the limit
+	RepoTimeout time.Duration
+
+	// RepoLabels are the names of the labels that repos may set in
+	// their configuration, see config.Entry.Labels. Every repo metric
+	// has them, empty for repos that don't set them.
+	RepoLabels []string
+}
+
+// reservedLabels are the labels of repo metrics other than the repo
+// label, which repo labels must not replace
+var reservedLabels = []string{
+	"team", "environment", "class", "compression", "created", "delete",
+	"hostname", "isLegacy", "le", "period", "pid", "site", "snapshot_id",
+	"snapshot_tags", "state", "type", "username", "version",
+}
+
+// DefaultMetricOptions returns the options for the original metric names
+func DefaultMetricOptions() MetricOptions {
+	return MetricOptions{
+		Namespace:   DefaultNamespace,
+		RepoLabel:   DefaultRepoLabel,
+		GroupBy:     snapshots.DefaultGroupBy,
+		SeriesWarn:  DefaultSeriesWarn,
+		RepoTimeout: DefaultRepoTimeout,
+	}
+}
+
+// Validate checks that the options produce valid metric and label names
+func (o MetricOptions) Validate() error {
+	if !validMetricName.MatchString(o.Namespace) {
+		return fmt.Errorf("Invalid metric namespace %q", o.Namespace)
+	}
+	if !validMetricName.MatchString(o.RepoLabel) {
+		return fmt.Errorf("Invalid repo label name %q", o.RepoLabel)
+	}
+	if slices.Contains(setLabelFields.Labels(), o.RepoLabel) || o.RepoLabel == "team" || o.RepoLabel == "environment" {
+		return fmt.Errorf("Repo label name %q conflicts with a backup set or repo label", o.RepoLabel)
+	}
+	for i, name := range o.RepoLabels {
+		switch {
+		case !validMetricName.MatchString(name) || strings.HasPrefix(name, "__"):
+			return fmt.Errorf("Invalid repo label name %q", name)
+		case name == o.RepoLabel || name == DefaultRepoLabel || slices.Contains(reservedLabels, name) || slices.Contains(setLabelFields.Labels(), name):
+			return fmt.Errorf("Repo label name %q conflicts with a label of the exporter", name)
+		case slices.Contains(o.RepoLabels[:i], name):
+			return fmt.Errorf("Duplicate repo label name %q", name)
+		}
+	}
+	return validateCompat(o.Compat)
+}
+
+// metricSets returns the metrics to export, which is two sets of
+// metrics when exporting legacy names alongside changed names. The
+// metrics of other exporters are only in the first set.
+func (o MetricOptions) metricSets() []*metricSet {
+	sets := []*metricSet{newMetricSet(o.Namespace, o.RepoLabel, o.RepoLabels, o.Histograms)}
+	if o.Compat == CompatNgosang {
+		sets[0].compat = newNgosangMetrics(o.RepoLabel)
+	}
+	if o.Legacy && (o.Namespace != DefaultNamespace || o.RepoLabel != DefaultRepoLabel) {
+		sets = append(sets, newMetricSet(DefaultNamespace, DefaultRepoLabel, o.RepoLabels, o.Histograms))
+	}
+	return sets
+}
+
+// metricSet holds the descriptions of all metrics for one naming scheme
+type metricSet struct {
+	histograms bool
+
+	// extraLabels are the labels that repos set in their
+	// configuration, see MetricOptions.RepoLabels
+	extraLabels []string
+
+	lastSuccessTime  *prometheus.Desc
+	jobErrorCount    *prometheus.Desc
+	readErrorCount   *prometheus.Desc
+	readErrorClass   *prometheus.Desc
+	snapshotCount    *prometheus.Desc
+	newestTimestamp  *prometheus.Desc
+	backupSetDayAge  *prometheus.Desc
+	backupSetAge     *prometheus.Desc
+	newSnapshots     *prometheus.Desc
+	belowMinimum     *prometheus.Desc
+	futureSnapshots  *prometheus.Desc
+	setMissing       *prometheus.Desc
+	overdue          *prometheus.Desc
+	setStale         *prometheus.Desc
+	intervalMean     *prometheus.Desc
+	intervalMax      *prometheus.Desc
+	backupDuration   *prometheus.Desc
+	snapshotAges     *prometheus.Desc
+	setAges          *prometheus.Desc
+	snapshotSizes    *prometheus.Desc
+	repoSize         *prometheus.Desc
+	sizeBudget       *prometheus.Desc
+	rawDataSize      *prometheus.Desc
+	blobCount        *prometheus.Desc
+	packCount        *prometheus.Desc
+	budgetUsed       *prometheus.Desc
+	daysToFull       *prometheus.Desc
+	forgettable      *prometheus.Desc
+	lastPrune        *prometheus.Desc
+	keyCount         *prometheus.Desc
+	formatInfo       *prometheus.Desc
+	b2Bytes          *prometheus.Desc
+	b2Files          *prometheus.Desc
+	s3Bytes          *prometheus.Desc
+	s3Objects        *prometheus.Desc
+	deleteAccess     *prometheus.Desc
+	pathsMissing     *prometheus.Desc
+	ladderCovered    *prometheus.Desc
+	ladderMissing    *prometheus.Desc
+	dailyCoverage    *prometheus.Desc
+	restoreSize      *prometheus.Desc
+	dataAdded        *prometheus.Desc
+	filesProcessed   *prometheus.Desc
+	bytesProcessed   *prometheus.Desc
+	backupStart      *prometheus.Desc
+	backupEnd        *prometheus.Desc
+	snapshotTime     *prometheus.Desc
+	repoHosts        *prometheus.Desc
+	repoUsers        *prometheus.Desc
+	hostMissing      *prometheus.Desc
+	repoReachable    *prometheus.Desc
+	probeDuration    *prometheus.Desc
+	probeErrorClass  *prometheus.Desc
+	lockCount        *prometheus.Desc
+	exclusiveLocked  *prometheus.Desc
+	oldestLockAge    *prometheus.Desc
+	lockInfo         *prometheus.Desc
+	checkSuccess     *prometheus.Desc
+	checkErrors      *prometheus.Desc
+	checkDuration    *prometheus.Desc
+	checkTime        *prometheus.Desc
+	verifySuccess    *prometheus.Desc
+	verifyErrors     *prometheus.Desc
+	verifyBytes      *prometheus.Desc
+	verifiedBytes    *prometheus.Desc
+	verifyTime       *prometheus.Desc
+	canarySuccess    *prometheus.Desc
+	canaryDuration   *prometheus.Desc
+	canaryBytes      *prometheus.Desc
+	canaryTime       *prometheus.Desc
+	federationSiteUp *prometheus.Desc
+	haLeader         *prometheus.Desc
+
+	// Internals of the exporter itself
+	activeCollections *prometheus.Desc
+	reposPending      *prometheus.Desc
+	rounds            *prometheus.Desc
+	roundsSkipped     *prometheus.Desc
+	reposSkipped      *prometheus.Desc
+	schedulerIdle     *prometheus.Desc
+	schedulerBlackout *prometheus.Desc
+	startTime         *prometheus.Desc
+
+	compat *compatMetrics // nil unless exporting another exporter's metrics
+}
+
+// setLabelFields are the fields whose labels identify a backup set.
+// Repos can each be grouped by any of them, or split by path or tag, but
+// labels must be the same for every repo. An empty label is the same as
+// no label in Prometheus so the labels of the fields that a repo isn't
+// grouped by don't change its series.
+var setLabelFields = snapshots.GroupBy{Host: true, User: true, Tags: true, Paths: true}
+
+func newMetricSet(namespace, repoLabel string, extraLabels []string, histograms bool) *metricSet {
+	repoLabels := append([]string{repoLabel, "team", "environment"}, extraLabels...)
+	setLabels := append(slices.Clone(repoLabels), setLabelFields.Labels()...)
+
+	return &metricSet{
+		histograms:  histograms,
+		extraLabels: extraLabels,
+		lastSuccessTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "job_last_success_unixtime"),
+			"Last time a batch job successfully finished",
+			nil, nil,
+		),
+		jobErrorCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "job_error_count"),
+			"Number of errors encountered by backup monitoring job",
+			nil, nil,
+		),
+		readErrorCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "read_error_count"),
+			"Number of errors encountered when reading backup",
+			repoLabels, nil,
+		),
+		readErrorClass: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "read_error_class"),
+			"Class of the error encountered when reading backup, always 1",
+			append(slices.Clone(repoLabels), "class"), nil,
+		),
+		// See note on snapshots.Info.IsLegacy for more info about isLegacy
+		snapshotCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "snapshot_count"),
+			"Number of snapshots in a backup set",
+			append(slices.Clone(setLabels), "isLegacy"), nil,
+		),
+		newestTimestamp: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "newest_timestamp"),
+			"Most recent snapshot timestamp in backup set",
+			append(slices.Clone(setLabels), "isLegacy"), nil,
+		),
+		backupSetDayAge: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "days_age"),
+			"Age in days since the most recent backup in a backup set",
+			setLabels, nil,
+		),
+		backupSetAge: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "age_seconds"),
+			"Age in seconds since the most recent backup in a backup set",
+			setLabels, nil,
+		),
+		newSnapshots: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "new_snapshots_total"),
+			"Number of snapshots added to a backup set between collections",
+			setLabels, nil,
+		),
+		belowMinimum: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "snapshots_below_minimum"),
+			"Whether a backup set has fewer snapshots than the minimum configured for the repo",
+			setLabels, nil,
+		),
+		futureSnapshots: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "future_snapshots"),
+			"Number of snapshots in a backup set that are dated in the future",
+			setLabels, nil,
+		),
+		setMissing: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "set_missing"),
+			"Whether a backup set that was seen before no longer has any snapshots",
+			setLabels, nil,
+		),
+		overdue: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "overdue"),
+			"Whether the newest snapshot in a backup set is older than the max age configured for it",
+			setLabels, nil,
+		),
+		setStale: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "set_stale"),
+			"Whether the newest snapshot in a backup set is older than the stale age configured for it",
+			setLabels, nil,
+		),
+		intervalMean: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "interval_mean_seconds"),
+			"Mean interval in seconds between consecutive snapshots in a backup set",
+			setLabels, nil,
+		),
+		intervalMax: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "interval_max_seconds"),
+			"Longest interval in seconds between consecutive snapshots in a backup set",
+			setLabels, nil,
+		),
+		backupDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "duration_seconds"),
+			"Durations of the backups of the snapshots in a repo",
+			repoLabels, nil,
+		),
+		snapshotAges: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "snapshot_age_seconds"),
+			"Ages of the snapshots in a repo when it was collected",
+			repoLabels, nil,
+		),
+		setAges: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "set_age_seconds"),
+			"Ages of the newest snapshots of the backup sets in a repo",
+			repoLabels, nil,
+		),
+		snapshotSizes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "snapshot_size_bytes"),
+			"Sizes of the files backed up by the snapshots in a repo",
+			repoLabels, nil,
+		),
+		repoSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_size_bytes"),
+			"Space used by the pack files of a repo",
+			repoLabels, nil,
+		),
+		rawDataSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_raw_data_bytes"),
+			"Stored size of the blobs in the index of a repo",
+			repoLabels, nil,
+		),
+		blobCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_blobs"),
+			"Number of blobs in the index of a repo",
+			repoLabels, nil,
+		),
+		packCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_packs"),
+			"Number of pack files in the index of a repo",
+			repoLabels, nil,
+		),
+		sizeBudget: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_size_budget_bytes"),
+			"Size that a repo is allowed to grow to",
+			repoLabels, nil,
+		),
+		budgetUsed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_size_budget_utilization"),
+			"Fraction of its size budget that a repo uses",
+			repoLabels, nil,
+		),
+		daysToFull: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_size_budget_days_to_full"),
+			"Projected days until a repo exceeds its size budget at its recent growth",
+			repoLabels, nil,
+		),
+		forgettable: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_forgettable_snapshots"),
+			"Number of snapshots that the forget policy of a repo would remove",
+			repoLabels, nil,
+		),
+		lastPrune: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "last_prune_unixtime"),
+			"Time of the first collection of a repo after its index files were replaced by a prune",
+			repoLabels, nil,
+		),
+		keyCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_keys"),
+			"Number of key files of a repo, each of which is a password that opens it",
+			repoLabels, nil,
+		),
+		formatInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_format_info"),
+			"The format version of a repo and whether it supports compression",
+			append(slices.Clone(repoLabels), "version", "compression"), nil,
+		),
+		b2Bytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "b2_stored_bytes"),
+			"Bytes that B2 stores for a repo by whether they're current, hidden or unfinished uploads",
+			append(slices.Clone(repoLabels), "state"), nil,
+		),
+		b2Files: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "b2_stored_files"),
+			"File versions that B2 stores for a repo by whether they're current, hidden or unfinished uploads",
+			append(slices.Clone(repoLabels), "state"), nil,
+		),
+		s3Bytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "s3_stored_bytes"),
+			"Bytes that S3 stores for a repo by storage class",
+			append(slices.Clone(repoLabels), "storage_class"), nil,
+		),
+		s3Objects: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "s3_stored_objects"),
+			"Objects that S3 stores for a repo by storage class",
+			append(slices.Clone(repoLabels), "storage_class"), nil,
+		),
+		deleteAccess: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_delete_access_info"),
+			"Whether the credentials of an append-only repo can delete files, always 1",
+			append(slices.Clone(repoLabels), "delete"), nil,
+		),
+		pathsMissing: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "expected_paths_missing"),
+			"Number of expected paths of the host that the newest snapshot in a backup set doesn't include",
+			setLabels, nil,
+		),
+		ladderCovered: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "retention_covered"),
+			"Whether each of the recent periods of the retention ladder has a snapshot in a backup set",
+			append(slices.Clone(setLabels), "period"), nil,
+		),
+		ladderMissing: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "retention_periods_missing"),
+			"Number of the recent periods of the retention ladder without a snapshot in a backup set",
+			append(slices.Clone(setLabels), "period"), nil,
+		),
+		dailyCoverage: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "daily_coverage_ratio"),
+			"Fraction of the recent days with a snapshot in a backup set",
+			setLabels, nil,
+		),
+		restoreSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "restore_size_bytes"),
+			"Size of the files in the newest snapshot in a backup set of a repo with restore_size",
+			setLabels, nil,
+		),
+		dataAdded: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "newest_data_added_bytes"),
+			"Size of the new data added to the repo by the backup of the newest snapshot in a backup set",
+			setLabels, nil,
+		),
+		filesProcessed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "newest_files_processed"),
+			"Number of files read by the backup of the newest snapshot in a backup set",
+			setLabels, nil,
+		),
+		bytesProcessed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "newest_bytes_processed"),
+			"Size of the files read by the backup of the newest snapshot in a backup set",
+			setLabels, nil,
+		),
+		backupStart: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "newest_start_timestamp"),
+			"Time the backup of the newest snapshot in a backup set started",
+			setLabels, nil,
+		),
+		backupEnd: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "newest_end_timestamp"),
+			"Time the backup of the newest snapshot in a backup set ended",
+			setLabels, nil,
+		),
+		snapshotTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "snapshot_timestamp"),
+			"Time of one of the most recent snapshots in a backup set of a repo with snapshot_metrics",
+			append(slices.Clone(setLabels), "snapshot_id", "snapshot_tags"), nil,
+		),
+		repoHosts: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_hosts"),
+			"Number of distinct hosts with snapshots in a repo",
+			repoLabels, nil,
+		),
+		repoUsers: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_users"),
+			"Number of distinct users with snapshots in a repo",
+			repoLabels, nil,
+		),
+		hostMissing: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "host_missing"),
+			"Whether a host that is expected to back up to a repo has no snapshots in it",
+			append(slices.Clone(repoLabels), "host"), nil,
+		),
+		repoReachable: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_reachable"),
+			"Whether the most recent probe of a repo reached its config file",
+			repoLabels, nil,
+		),
+		probeDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_probe_duration_seconds"),
+			"How long the most recent probe of a repo took",
+			repoLabels, nil,
+		),
+		probeErrorClass: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_probe_error_class"),
+			"Class of the error of the most recent probe of a repo, always 1",
+			append(slices.Clone(repoLabels), "class"), nil,
+		),
+		lockCount: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_locks"),
+			"Number of locks held on a repo by type",
+			append(slices.Clone(repoLabels), "type"), nil,
+		),
+		exclusiveLocked: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_exclusive_locked"),
+			"Whether a repo has an exclusive lock, which blocks backups",
+			repoLabels, nil,
+		),
+		oldestLockAge: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_oldest_lock_age_seconds"),
+			"Age of the oldest lock held on a repo",
+			repoLabels, nil,
+		),
+		lockInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_lock_info"),
+			"A lock held on a repo, with the host, user and PID of the process that holds it and when it was created",
+			append(slices.Clone(repoLabels), "hostname", "username", "pid", "type", "created"), nil,
+		),
+		checkSuccess: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_check_success"),
+			"Whether the most recent check of the structure of a repo ran and found no errors",
+			repoLabels, nil,
+		),
+		checkErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_check_errors"),
+			"Number of errors found by the most recent check of the structure of a repo",
+			repoLabels, nil,
+		),
+		checkDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_check_duration_seconds"),
+			"How long the most recent check of the structure of a repo took",
+			repoLabels, nil,
+		),
+		checkTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_check_timestamp"),
+			"Time the most recent check of the structure of a repo finished",
+			repoLabels, nil,
+		),
+		verifySuccess: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_verify_success"),
+			"Whether the most recent verification of a subset of the data of a repo ran and found no errors",
+			repoLabels, nil,
+		),
+		verifyErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_verify_errors"),
+			"Number of errors found by the most recent verification of a subset of the data of a repo",
+			repoLabels, nil,
+		),
+		verifyBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_verify_bytes"),
+			"Size of the data read by the most recent verification of a repo",
+			repoLabels, nil,
+		),
+		verifiedBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_verified_bytes_total"),
+			"Size of the data read by all verifications of a repo since the exporter started",
+			repoLabels, nil,
+		),
+		verifyTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "repo_verify_timestamp"),
+			"Time the most recent verification of a subset of the data of a repo finished",
+			repoLabels, nil,
+		),
+		canarySuccess: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "restore_canary_success"),
+			"Whether the most recent restore canary of a repo restored a file that matched its hash",
+			repoLabels, nil,
+		),
+		canaryDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "restore_canary_duration_seconds"),
+			"How long the most recent restore canary of a repo took, including opening the repo",
+			repoLabels, nil,
+		),
+		canaryBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "restore_canary_bytes"),
+			"Size of the file restored by the most recent successful restore canary of a repo",
+			repoLabels, nil,
+		),
+		canaryTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "restore_canary_timestamp"),
+			"Time the most recent restore canary of a repo finished",
+			repoLabels, nil,
+		),
+		federationSiteUp: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "federation_site_up"),
+			"Whether the last status fetch from a federated site succeeded",
+			[]string{"site"}, nil,
+		),
+		haLeader: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "ha_leader"),
+			"Whether this replica is the leader that collects repos",
+			nil, nil,
+		),
+		activeCollections: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "collector", "active_collections"),
+			"Number of repos that are currently being read",
+			nil, nil,
+		),
+		reposPending: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "collector", "repos_pending"),
+			"Number of repos in collection runs that haven't finished",
+			nil, nil,
+		),
+		rounds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "collector", "rounds_total"),
+			"Number of collection runs that completed",
+			nil, nil,
+		),
+		roundsSkipped: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "collector", "rounds_skipped_total"),
+			"Number of collection runs that were skipped since all of their repos were still being collected",
+			nil, nil,
+		),
+		reposSkipped: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "collector", "repos_skipped_total"),
+			"Number of repos that were skipped by collection runs since they were still being collected",
+			nil, nil,
+		),
+		startTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "start_time_seconds"),
+			"Time that the exporter started in seconds since the epoch",
+			nil, nil,
+		),
+		schedulerIdle: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scheduler", "seconds_since_last_run"),
+			"Seconds since the scheduler last ran a job or was started",
+			nil, nil,
+		),
+		schedulerBlackout: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scheduler", "blackout"),
+			"Whether scheduled collections are being skipped for a blackout",
+			nil, nil,
+		),
+	}
+}
+
+func (m *metricSet) describeRepoMetrics(ch chan<- *prometheus.Desc) {
+	ch <- m.lastSuccessTime
+	ch <- m.jobErrorCount
+	ch <- m.readErrorCount
+	ch <- m.readErrorClass
+	ch <- m.snapshotCount
+	ch <- m.newestTimestamp
+	ch <- m.backupSetDayAge
+	ch <- m.backupSetAge
+	ch <- m.newSnapshots
+	ch <- m.belowMinimum
+	ch <- m.futureSnapshots
+	ch <- m.setMissing
+	ch <- m.overdue
+	ch <- m.setStale
+	ch <- m.intervalMean
+	ch <- m.intervalMax
+	ch <- m.backupDuration
+	if m.histograms {
+		ch <- m.snapshotAges
+		ch <- m.setAges
+		ch <- m.snapshotSizes
+	}
+	ch <- m.repoSize
+	ch <- m.rawDataSize
+	ch <- m.blobCount
+	ch <- m.packCount
+	ch <- m.sizeBudget
+	ch <- m.budgetUsed
+	ch <- m.daysToFull
+	ch <- m.forgettable
+	ch <- m.lastPrune
+	ch <- m.keyCount
+	ch <- m.formatInfo
+	ch <- m.b2Bytes
+	ch <- m.b2Files
+	ch <- m.s3Bytes
+	ch <- m.s3Objects
+	ch <- m.deleteAccess
+	ch <- m.pathsMissing
+	ch <- m.ladderCovered
+	ch <- m.ladderMissing
+	ch <- m.dailyCoverage
+	ch <- m.restoreSize
+	ch <- m.dataAdded
+	ch <- m.filesProcessed
+	ch <- m.bytesProcessed
+	ch <- m.backupStart
+	ch <- m.backupEnd
+	ch <- m.snapshotTime
+	ch <- m.repoHosts
+	ch <- m.repoUsers
+	ch <- m.hostMissing
+	if m.compat != nil {
+		m.compat.describe(ch)
+	}
+}
+
+// collectRepoMetrics converts the results of a collection run into
+// prometheus metrics. This is shared by all collectors that export repo
+// metrics.
+func (m *metricSet) collectRepoMetrics(ch chan<- prometheus.Metric, metrics *AllRepoMetrics) {
+	now := time.Now()
+
+	ch <- prometheus.MustNewConstMetric(
+		m.lastSuccessTime, prometheus.GaugeValue, float64(metrics.Time.UnixNano())/1e9,
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		m.jobErrorCount, prometheus.GaugeValue, float64(metrics.Errors),
+	)
+
+	for _, stats := range metrics.Stats {
+		// Renamed repos are exported under each of their names so that
+		// series continue across the rename. The repo label never
+		// contains credentials, the raw name is only used internally to
+		// match results to the configuration.
+		for _, name := range stats.names(now) {
+			stats.Name = name
+			m.collectRepo(ch, now, stats)
+		}
+	}
+}
+
+// repoValues returns the values of the labels that identify a repo,
+// which are its name, team, environment and the labels it sets
+func (m *metricSet) repoValues(name, team, environment string, labels map[string]string) []string {
+	values := []string{name, team, environment}
+	for _, label := range m.extraLabels {
+		values = append(values, labels[label])
+	}
+	return values
+}
+
+// repoLabelValues returns the values of the labels that identify a repo
+// in the configuration, see repoValues
+func (m *metricSet) repoLabelValues(cfg config.File, repo string) []string {
+	if entry := cfg.Find(repo); entry != nil {
+		return m.repoValues(entry.Label(), entry.Team, entry.Environment, entry.Labels)
+	}
+	return m.repoValues(config.ScrubRepo(repo), "", "", nil)
+}
+
+// collectRepo exports the metrics of a single repo
+func (m *metricSet) collectRepo(ch chan<- prometheus.Metric, now time.Time, stats RepoStats) {
+	// Repos without a team, environment or their own labels have empty
+	// labels, which is the same as no label in Prometheus
+	repo := m.repoValues(stats.Name, stats.Team, stats.Environment, stats.Labels)
+
+	ch <- prometheus.MustNewConstMetric(
+		m.readErrorCount, prometheus.GaugeValue, float64(stats.ReadErrors),
+		repo...,
+	)
+
+	if stats.ErrorClass != "" {
+		ch <- prometheus.MustNewConstMetric(
+			m.readErrorClass, prometheus.GaugeValue, 1,
+			append(slices.Clone(repo), stats.ErrorClass)...,
+		)
+	}
+
+	legacyDays, staleDays := stats.LegacyDays, stats.StaleDays
+	if legacyDays == 0 {
+		legacyDays = snapshots.DefaultLegacyDays
+	}
+	if staleDays == 0 {
+		staleDays = legacyDays
+	}
+
+	for _, set := range stats.Stats {
+		// See not on IsLegacy method
+		var legacy = "false"
+		if set.IsLegacyAfter(now, legacyDays) {
+			legacy = "true"
+		}
+
+		labels := append(slices.Clone(repo), setLabelFields.LabelValues(set)...)
+		legacyLabels := append(slices.Clone(labels), legacy)
+
+		ch <- prometheus.MustNewConstMetric(
+			m.snapshotCount, prometheus.GaugeValue, float64(set.Count),
+			legacyLabels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			m.newestTimestamp, prometheus.GaugeValue, float64(set.Time.Unix()),
+			legacyLabels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			m.backupSetDayAge, prometheus.GaugeValue, float64(set.DayAge(now)),
+			labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			m.backupSetAge, prometheus.GaugeValue, now.Sub(set.Time).Seconds(),
+			labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			m.newSnapshots, prometheus.CounterValue, float64(set.NewSnapshots),
+			labels...,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			m.futureSnapshots, prometheus.GaugeValue, float64(set.Future),
+			labels...,
+		)
+
+		var missing float64
+		if set.Missing {
+			missing = 1
+		}
+		ch <- prometheus.MustNewConstMetric(m.setMissing, prometheus.GaugeValue, missing, labels...)
+
+		var stale float64
+		if set.Stale(now, staleDays) {
+			stale = 1
+		}
+		ch <- prometheus.MustNewConstMetric(m.setStale, prometheus.GaugeValue, stale, labels...)
+
+		if set.MaxAge > 0 {
+			var overdue float64
+			if set.Overdue(now) {
+				overdue = 1
+			}
+			ch <- prometheus.MustNewConstMetric(m.overdue, prometheus.GaugeValue, overdue, labels...)
+		}
+
+		if set.Cadence != nil {
+			ch <- prometheus.MustNewConstMetric(m.intervalMean, prometheus.GaugeValue, set.Cadence.Mean.Seconds(), labels...)
+			ch <- prometheus.MustNewConstMetric(m.intervalMax, prometheus.GaugeValue, set.Cadence.Max.Seconds(), labels...)
+		}
+
+		if set.PathsChecked {
+			ch <- prometheus.MustNewConstMetric(
+				m.pathsMissing, prometheus.GaugeValue, float64(len(set.MissingPaths)),
+				labels...,
+			)
+		}
+
+		for _, cov := range set.Coverage {
+			periodLabels := append(slices.Clone(labels), cov.Period)
+			var covered float64
+			if cov.Complete() {
+				covered = 1
+			}
+			ch <- prometheus.MustNewConstMetric(m.ladderCovered, prometheus.GaugeValue, covered, periodLabels...)
+			ch <- prometheus.MustNewConstMetric(
+				m.ladderMissing, prometheus.GaugeValue, float64(cov.Periods-cov.Covered),
+				periodLabels...,
+			)
+		}
+
+		if set.Daily != nil {
+			ch <- prometheus.MustNewConstMetric(m.dailyCoverage, prometheus.GaugeValue, set.Daily.Ratio(), labels...)
+		}
+
+		if set.RestoreSize > 0 {
+			ch <- prometheus.MustNewConstMetric(m.restoreSize, prometheus.GaugeValue, float64(set.RestoreSize), labels...)
+		}
+
+		if sum := set.LatestSummary; sum != nil {
+			ch <- prometheus.MustNewConstMetric(m.dataAdded, prometheus.GaugeValue, float64(sum.DataAdded), labels...)
+			ch <- prometheus.MustNewConstMetric(m.filesProcessed, prometheus.GaugeValue, float64(sum.FilesProcessed), labels...)
+			ch <- prometheus.MustNewConstMetric(m.bytesProcessed, prometheus.GaugeValue, float64(sum.BytesProcessed), labels...)
+			if !sum.BackupStart.IsZero() {
+				ch <- prometheus.MustNewConstMetric(m.backupStart, prometheus.GaugeValue, float64(sum.BackupStart.Unix()), labels...)
+				ch <- prometheus.MustNewConstMetric(m.backupEnd, prometheus.GaugeValue, float64(sum.BackupEnd.Unix()), labels...)
+			}
+		}
+
+		for _, sn := range set.Recent {
+			ch <- prometheus.MustNewConstMetric(
+				m.snapshotTime, prometheus.GaugeValue, float64(sn.Time.Unix()),
+				append(slices.Clone(labels), sn.ID, strings.Join(slices.Sorted(slices.Values(sn.Tags)), ","))...,
+			)
+		}
+
+		if stats.MinSnapshots > 0 {
+			var below float64
+			if set.Count < stats.MinSnapshots {
+				below = 1
+			}
+			ch <- prometheus.MustNewConstMetric(m.belowMinimum, prometheus.GaugeValue, below, labels...)
+		}
+	}
+
+	// Durations are per repo rather than per backup set since a
+	// histogram per set would be a lot of series
+	durations := &snapshots.Durations{}
+	for _, set := range stats.Stats {
+		durations.Merge(set.Durations)
+	}
+	if durations.Count > 0 {
+		ch <- prometheus.MustNewConstHistogram(
+			m.backupDuration, durations.Count, durations.Sum, durations.Cumulative(),
+			repo...,
+		)
+	}
+
+	if m.histograms {
+		if stats.Ages != nil && stats.Ages.Count > 0 {
+			ch <- distributionMetric(m.snapshotAges, stats.Ages, snapshots.AgeBuckets, stats.Time, repo...)
+		}
+		if len(stats.Stats) > 0 {
+			ch <- distributionMetric(m.setAges, stats.Stats.SetAges(now), snapshots.AgeBuckets, stats.Time, repo...)
+		}
+
+		sizes := &snapshots.Distribution{}
+		for _, set := range stats.Stats {
+			sizes.Merge(set.Sizes)
+		}
+		if sizes.Count > 0 {
+			ch <- distributionMetric(m.snapshotSizes, sizes, snapshots.SizeBuckets, stats.Time, repo...)
+		}
+	}
+
+	if stats.SizeBytes > 0 {
+		ch <- prometheus.MustNewConstMetric(m.repoSize, prometheus.GaugeValue, float64(stats.SizeBytes), repo...)
+	}
+	if idx := stats.Index; idx != nil {
+		ch <- prometheus.MustNewConstMetric(m.rawDataSize, prometheus.GaugeValue, float64(idx.RawBytes), repo...)
+		ch <- prometheus.MustNewConstMetric(m.blobCount, prometheus.GaugeValue, float64(idx.Blobs), repo...)
+		ch <- prometheus.MustNewConstMetric(m.packCount, prometheus.GaugeValue, float64(idx.Packs), repo...)
+	}
+	if stats.SizeBudget > 0 {
+		ch <- prometheus.MustNewConstMetric(m.sizeBudget, prometheus.GaugeValue, float64(stats.SizeBudget), repo...)
+	}
+	if stats.SizeBytes > 0 && stats.SizeBudget > 0 {
+		ch <- prometheus.MustNewConstMetric(m.budgetUsed, prometheus.GaugeValue, stats.utilization(), repo...)
+		if days, ok := stats.daysToFull(); ok {
+			ch <- prometheus.MustNewConstMetric(m.daysToFull, prometheus.GaugeValue, days, repo...)
+		}
+	}
+
+	if stats.Forgettable != nil {
+		ch <- prometheus.MustNewConstMetric(m.forgettable, prometheus.GaugeValue, float64(*stats.Forgettable), repo...)
+	}
+	if stats.Version > 0 {
+		compression := "unsupported"
+		if stats.Version >= 2 {
+			compression = "supported"
+		}
+		ch <- prometheus.MustNewConstMetric(m.formatInfo, prometheus.GaugeValue, 1, append(slices.Clone(repo), strconv.FormatUint(uint64(stats.Version), 10), compression)...)
+	}
+	if stats.Keys > 0 {
+		ch <- prometheus.MustNewConstMetric(m.keyCount, prometheus.GaugeValue, float64(stats.Keys), repo...)
+	}
+	if !stats.LastPrune.IsZero() {
+		ch <- prometheus.MustNewConstMetric(m.lastPrune, prometheus.GaugeValue, float64(stats.LastPrune.Unix()), repo...)
+	}
+	if u := stats.B2Usage; u != nil {
+		states := []struct {
+			name         string
+			bytes, files int64
+		}{
+			{"current", u.Bytes - u.HiddenBytes - u.UnfinishedBytes, u.Files - u.HiddenFiles - u.UnfinishedFiles},
+			{"hidden", u.HiddenBytes, u.HiddenFiles},
+			{"unfinished", u.UnfinishedBytes, u.UnfinishedFiles},
+		}
+		for _, s := range states {
+			ch <- prometheus.MustNewConstMetric(m.b2Bytes, prometheus.GaugeValue, float64(s.bytes), append(slices.Clone(repo), s.name)...)
+			ch <- prometheus.MustNewConstMetric(m.b2Files, prometheus.GaugeValue, float64(s.files), append(slices.Clone(repo), s.name)...)
+		}
+	}
+	for class, s := range stats.S3StorageClasses {
+		ch <- prometheus.MustNewConstMetric(m.s3Bytes, prometheus.GaugeValue, float64(s.Bytes), append(slices.Clone(repo), class)...)
+		ch <- prometheus.MustNewConstMetric(m.s3Objects, prometheus.GaugeValue, float64(s.Objects), append(slices.Clone(repo), class)...)
+	}
+
+	// Hosts and users are only known when backup sets are grouped by
+	// them and when the repo could be read
+	groupBy, _ := snapshots.ParseGroupBy(stats.GroupBy)
+	if stats.ReadErrors == 0 && groupBy.Host {
+		ch <- prometheus.MustNewConstMetric(m.repoHosts, prometheus.GaugeValue, float64(stats.Hosts), repo...)
+	}
+	if stats.ReadErrors == 0 && groupBy.User {
+		ch <- prometheus.MustNewConstMetric(m.repoUsers, prometheus.GaugeValue, float64(stats.Users), repo...)
+	}
+	for host, found := range stats.ExpectedHosts {
+		var missing float64
+		if !found {
+			missing = 1
+		}
+		ch <- prometheus.MustNewConstMetric(m.hostMissing, prometheus.GaugeValue, missing, append(slices.Clone(repo), host)...)
+	}
+
+	if stats.DeleteAccess != "" {
+		ch <- prometheus.MustNewConstMetric(m.deleteAccess, prometheus.GaugeValue, 1, append(slices.Clone(repo), stats.DeleteAccess)...)
+	}
+
+	if m.compat != nil {
+		m.compat.collect(ch, stats)
+	}
+}
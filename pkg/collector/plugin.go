@@ -0,0 +1,121 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/logctx"
+	"github.com/restic/restic/reporter/pkg/repoerr"
+	"github.com/restic/restic/reporter/pkg/snapshots"
+	"go.uber.org/zap"
+)
+
+// PluginProtocolVersion is the version of the plugin protocol sent to
+// plugins in every request
+const PluginProtocolVersion = 1
+
+// PluginRequest is written as JSON to the standard input of a plugin
+type PluginRequest struct {
+	Version  int               `json:"version"`
+	Repo     string            `json:"repo"`
+	Password string            `json:"password,omitempty"`
+	Options  map[string]string `json:"options,omitempty"`
+}
+
+// PluginSnapshot is a single snapshot in a plugin response
+type PluginSnapshot struct {
+	ID    string    `json:"id,omitempty"`
+	Host  string    `json:"host"`
+	User  string    `json:"user"`
+	Time  time.Time `json:"time"`
+	Tags  []string  `json:"tags,omitempty"`
+	Paths []string  `json:"paths,omitempty"`
+
+	// DurationSeconds is how long the backup took and SizeBytes the size
+	// of the files that were backed up, if known
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	SizeBytes       int64   `json:"size_bytes,omitempty"`
+}
+
+// PluginResponse is read as JSON from the standard output of a plugin.
+// If Error is set then reading the repo failed. ErrorClass optionally
+// classifies the error with one of the names from repoerr.Class.
+// SizeBytes is the space used by the repo, if known.
+type PluginResponse struct {
+	Snapshots  []PluginSnapshot `json:"snapshots"`
+	SizeBytes  int64            `json:"size_bytes,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	ErrorClass string           `json:"error_class,omitempty"`
+}
+
+// PluginReader reads repos by running an external program, which allows
+// monitoring storage that restic doesn't support without changes to the
+// exporter. The program is run once per read with a PluginRequest on
+// its standard input and must write a PluginResponse to its standard
+// output and exit zero. Anything written to standard error is logged.
+type PluginReader struct{}
+
+func (PluginReader) ReadSnapshots(ctx context.Context, entry *config.Entry, groupBy snapshots.GroupBy, filter snapshots.Filter) (RepoInfo, error) {
+	logger := logctx.From(ctx)
+
+	req, err := json.Marshal(PluginRequest{
+		Version:  PluginProtocolVersion,
+		Repo:     entry.Repo,
+		Password: entry.Password,
+		Options:  entry.PluginOptions,
+	})
+	if err != nil {
+		return RepoInfo{}, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, entry.Plugin)
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	logger.Debug("Running plugin", zap.String("plugin", entry.Plugin))
+	err = cmd.Run()
+
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		logger.Info("Plugin output", zap.String("plugin", entry.Plugin), zap.String("stderr", msg))
+	}
+
+	if err != nil {
+		return RepoInfo{}, repoerr.Classify(fmt.Errorf("Error running plugin %s: %w", entry.Plugin, err), nil)
+	}
+
+	var res PluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		return RepoInfo{}, fmt.Errorf("Invalid response from plugin %s: %w", entry.Plugin, err)
+	}
+
+	if res.Error != "" {
+		return RepoInfo{}, repoerr.Classify(errors.New(res.Error), repoerr.FromName(res.ErrorClass))
+	}
+
+	col := snapshots.Collection{}
+	for _, sn := range res.Snapshots {
+		snap := snapshots.Snapshot{
+			ID:       sn.ID,
+			Username: sn.User,
+			Hostname: sn.Host,
+			Time:     sn.Time,
+			Tags:     sn.Tags,
+			Paths:    sn.Paths,
+			Duration: time.Duration(sn.DurationSeconds * float64(time.Second)),
+			Size:     sn.SizeBytes,
+		}
+		if !filter.Ignored(snap) {
+			col.AddSnapshot(groupBy, snap)
+		}
+	}
+	return RepoInfo{Snapshots: col, SizeBytes: res.SizeBytes}, nil
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/repoerr"
+	"github.com/restic/restic/reporter/pkg/resticrepo"
+	"go.uber.org/zap"
+)
+
+// probeTimeout is how long a single probe may take before the repo is
+// considered unreachable
+const probeTimeout = 30 * time.Second
+
+// ProbeFunc checks that a repo is reachable
+type ProbeFunc func(ctx context.Context, entry *config.Entry) error
+
+// DefaultProbe checks that a repo is reachable with resticrepo.Probe
+func DefaultProbe(ctx context.Context, entry *config.Entry) error {
+	return resticrepo.Probe(ctx, entry.Repo, entry.ExtraConfig())
+}
+
+// probeResult is the result of the most recent probe of a repo
+type probeResult struct {
+	err      error
+	duration time.Duration
+}
+
+// Prober checks that repos are reachable much more often than they're
+// collected, so that an unreachable backend is noticed within minutes
+// rather than at the next collection. Probes are cheap since they don't
+// read the repo, see resticrepo.Probe. Repos read by plugins aren't
+// probed.
+type Prober struct {
+	*repoResults[probeResult]
+	probe ProbeFunc
+}
+
+// NewProber creates a prober for the repos that config returns, which
+// is usually ResticCollector.Config
+func NewProber(logger *zap.Logger, opts MetricOptions, config func() config.File, probe ProbeFunc) *Prober {
+	return &Prober{
+		repoResults: newRepoResults[probeResult](logger, opts, config),
+		probe:       probe,
+	}
+}
+
+// ProbeAll probes every enabled repo concurrently. Results of repos no
+// longer in the configuration are dropped.
+func (p *Prober) ProbeAll(ctx context.Context) {
+	p.replace(checkRepos(ctx, p.logger, p.config(), func(ctx context.Context, logger *zap.Logger, entry *config.Entry) probeResult {
+		start := time.Now()
+		err := p.probe(ctx, entry)
+		if err != nil {
+			logger.Warn("Repo is unreachable", zap.String("error_class", repoerr.Class(err)), zap.Error(err))
+		}
+		return probeResult{err: err, duration: time.Since(start)}
+	}))
+}
+
+// Run probes every interval until ctx is done
+func (p *Prober) Run(ctx context.Context, interval time.Duration) {
+	runEvery(ctx, interval, p.ProbeAll)
+}
+
+// enabled excludes repos read by plugins, which aren't probed
+func (probeResult) enabled(entry *config.Entry) bool {
+	return entry.Plugin == ""
+}
+
+func (probeResult) describe(m *metricSet) []*prometheus.Desc {
+	return []*prometheus.Desc{m.repoReachable, m.probeDuration, m.probeErrorClass}
+}
+
+func (res probeResult) collect(ch chan<- prometheus.Metric, m *metricSet, name []string) {
+	var reachable float64
+	if res.err == nil {
+		reachable = 1
+	} else {
+		ch <- prometheus.MustNewConstMetric(m.probeErrorClass, prometheus.GaugeValue, 1, append(slices.Clone(name), repoerr.Class(res.err))...)
+	}
+	ch <- prometheus.MustNewConstMetric(m.repoReachable, prometheus.GaugeValue, reachable, name...)
+	ch <- prometheus.MustNewConstMetric(m.probeDuration, prometheus.GaugeValue, res.duration.Seconds(), name...)
+}
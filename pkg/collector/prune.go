@@ -0,0 +1,43 @@
+package collector
+
+import "time"
+
+// indexIDLength is how much of the ID of each index file is kept to
+// detect prunes, which keeps the results small for repos with many
+// index files
+const indexIDLength = 8
+
+// shortIndexIDs shortens the IDs of index files to what's kept, nil if
+// they weren't listed
+func shortIndexIDs(ids []string) []string {
+	if ids == nil {
+		return nil
+	}
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id[:min(len(id), indexIDLength)]
+	}
+	return out
+}
+
+// lastPrune returns when a repo was last pruned given the index files
+// of its previous and current collections. prune replaces the index
+// files of the repo with new ones and backups only add index files, so
+// a repo was pruned between the collections if any of the previous
+// index files are gone, which is recorded at now. Otherwise it's the
+// previous time, zero if no prune has been seen.
+func lastPrune(prev, cur []string, prevPrune, now time.Time) time.Time {
+	if prev == nil {
+		return prevPrune
+	}
+	present := make(map[string]bool, len(cur))
+	for _, id := range cur {
+		present[id] = true
+	}
+	for _, id := range prev {
+		if !present[id] {
+			return now
+		}
+	}
+	return prevPrune
+}
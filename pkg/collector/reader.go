@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/logctx"
+	"github.com/restic/restic/reporter/pkg/resticrepo"
+	"github.com/restic/restic/reporter/pkg/snapshots"
+	"go.uber.org/zap"
+)
+
+// RepoReader reads a single configured repo, which is its snapshots in
+// backup sets grouped by groupBy and what's known about the repo as a
+// whole, see RepoInfo. Snapshots that filter ignores must not be
+// added to the backup sets. This is the boundary between the collector
+// and restic so that collectors can be used without real repos, see the
+// collectortest package. Readers should log to the logger carried by the
+// context, see logctx.
+type RepoReader interface {
+	ReadSnapshots(ctx context.Context, entry *config.Entry, groupBy snapshots.GroupBy, filter snapshots.Filter) (RepoInfo, error)
+}
+
+// DefaultReader reads repos with their plugin if they have one and from
+// restic otherwise
+type DefaultReader struct{}
+
+func (DefaultReader) ReadSnapshots(ctx context.Context, entry *config.Entry, groupBy snapshots.GroupBy, filter snapshots.Filter) (RepoInfo, error) {
+	if entry.Plugin != "" {
+		return PluginReader{}.ReadSnapshots(ctx, entry, groupBy, filter)
+	}
+	return ResticReader{}.ReadSnapshots(ctx, entry, groupBy, filter)
+}
+
+// ResticReader reads snapshots from restic repos. The repo is read
+// locked while the snapshots are listed. The size of repos with a size
+// budget, the index totals of repos with stats, the restore sizes of
+// repos with restore_size, the snapshots that the forget_policy of a
+// repo would remove, the B2 usage of repos with b2_usage, and whether
+// append_only repos allow deletes are also read. Failing to read them is
+// logged but doesn't fail the read.
+type ResticReader struct{}
+
+func (ResticReader) ReadSnapshots(ctx context.Context, entry *config.Entry, groupBy snapshots.GroupBy, filter snapshots.Filter) (RepoInfo, error) {
+	repo, ctx, err := resticrepo.Open(ctx, entry.Repo, entry.Password, entry.ExtraConfig())
+	if err != nil {
+		return RepoInfo{}, fmt.Errorf("Error opening restic backend: %w", err)
+	}
+	defer repo.Close()
+
+	logctx.From(ctx).Debug("Listing snapshots")
+	col, err := repo.Snapshots(ctx, groupBy, filter)
+	if err != nil {
+		return RepoInfo{}, fmt.Errorf("Error iterating restic snapshots: %w", err)
+	}
+
+	info := RepoInfo{Snapshots: col, Version: repo.Version()}
+
+	logctx.From(ctx).Debug("Reading repo locks")
+	if locks, err := repo.Locks(ctx); err != nil {
+		logctx.From(ctx).Warn("Error reading repo locks", zap.Error(err))
+	} else {
+		info.Locks, info.LocksTime = locks, time.Now()
+	}
+
+	logctx.From(ctx).Debug("Listing repo index files")
+	if ids, err := repo.IndexFiles(ctx); err != nil {
+		logctx.From(ctx).Warn("Error listing repo index files", zap.Error(err))
+	} else {
+		info.IndexFiles = ids
+	}
+
+	logctx.From(ctx).Debug("Listing repo keys")
+	if n, err := repo.Keys(ctx); err != nil {
+		logctx.From(ctx).Warn("Error listing repo keys", zap.Error(err))
+	} else {
+		info.Keys = n
+	}
+
+	if entry.SizeBudget != "" {
+		logctx.From(ctx).Debug("Reading repo size")
+		size, err := repo.Size(ctx)
+		if err != nil {
+			logctx.From(ctx).Error("Error reading repo size", zap.Error(err))
+		}
+		info.SizeBytes = size
+	}
+
+	if entry.Stats {
+		logctx.From(ctx).Debug("Reading repo index")
+		stats, err := repo.Stats(ctx)
+		if err != nil {
+			logctx.From(ctx).Error("Error reading repo index", zap.Error(err))
+		} else {
+			info.Index = &stats
+		}
+	}
+
+	if entry.RestoreSize {
+		logctx.From(ctx).Debug("Measuring restore sizes")
+		err := col.MeasureRestoreSizes(func(id string) (int64, error) {
+			return repo.RestoreSize(ctx, id)
+		})
+		if err != nil {
+			logctx.From(ctx).Error("Error measuring restore sizes", zap.Error(err))
+		}
+	}
+
+	if entry.ForgetPolicy != nil {
+		logctx.From(ctx).Debug("Evaluating forget policy")
+		n, err := repo.Forgettable(ctx, *entry.ForgetPolicy)
+		if err != nil {
+			logctx.From(ctx).Error("Error evaluating forget policy", zap.Error(err))
+		} else {
+			info.Forgettable = &n
+		}
+	}
+
+	if entry.B2Usage {
+		logctx.From(ctx).Debug("Reading B2 usage")
+		usage, err := readB2Usage(ctx, entry)
+		if err != nil {
+			logctx.From(ctx).Error("Error reading B2 usage", zap.Error(err))
+		}
+		info.B2Usage = usage
+	}
+
+	if entry.S3StorageClasses {
+		logctx.From(ctx).Debug("Reading S3 storage classes")
+		classes, err := resticrepo.S3StorageClasses(ctx, entry.Repo, entry.ExtraConfig())
+		if err != nil {
+			logctx.From(ctx).Error("Error reading S3 storage classes", zap.Error(err))
+		}
+		info.S3StorageClasses = classes
+	}
+
+	if entry.AppendOnly {
+		logctx.From(ctx).Debug("Probing delete access")
+		access, err := probeDelete(ctx, entry)
+		if err != nil {
+			logctx.From(ctx).Error("Error probing delete access", zap.Error(err))
+		} else if access == deleteAllowed {
+			logctx.From(ctx).Warn("Repo should be append-only but allows deletes")
+		}
+		info.DeleteAccess = access
+	}
+
+	return info, nil
+}
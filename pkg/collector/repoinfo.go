@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/b2api"
+	"github.com/restic/restic/reporter/pkg/resticrepo"
+	"github.com/restic/restic/reporter/pkg/snapshots"
+)
+
+// RepoInfo is the result of reading a repo, which is its backup sets and
+// what the reader learns about the repo as a whole, see RepoReader
+type RepoInfo struct {
+	// Snapshots are the backup sets of the repo
+	Snapshots snapshots.Collection
+
+	// SizeBytes is the space used by the repo, zero if it wasn't read.
+	// Readers only need to read it for repos with a size budget.
+	SizeBytes int64
+
+	// Index is the totals of the index of the repo, nil if it wasn't
+	// read. Readers only need to read it for repos with stats.
+	Index *resticrepo.IndexStats
+
+	// Forgettable is the number of snapshots that the forget policy of
+	// the repo would remove, nil if it wasn't evaluated. Readers only
+	// need to evaluate it for repos with a forget_policy.
+	Forgettable *int
+
+	// Locks are the locks held on the repo by other processes and
+	// LocksTime when they were read, zero if they weren't
+	Locks     []resticrepo.LockInfo
+	LocksTime time.Time
+
+	// IndexFiles are the IDs of the index files of the repo, nil if
+	// they weren't listed
+	IndexFiles []string
+
+	// Keys is the number of key files of the repo, zero if they weren't
+	// listed
+	Keys int
+
+	// Version is the format version of the repo, zero if it's unknown
+	Version uint
+
+	// B2Usage is what B2 stores for the repo, nil if it wasn't read.
+	// Readers only need to read it for repos with b2_usage.
+	B2Usage *b2api.Usage
+
+	// S3StorageClasses is what S3 stores for the repo by storage class,
+	// nil if it wasn't read. Readers only need to read it for repos with
+	// s3_storage_classes.
+	S3StorageClasses map[string]resticrepo.S3StorageClass
+
+	// DeleteAccess is whether the credentials of the repo can delete
+	// files, empty if it wasn't probed. Readers only need to probe it
+	// for repos with append_only.
+	DeleteAccess string
+}
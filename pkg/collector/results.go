@@ -0,0 +1,153 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/logctx"
+	"go.uber.org/zap"
+)
+
+// repoResult is the result of checking a repo apart from collections,
+// which is exported as the metrics that it describes while enabled
+// returns true for the entry of the repo
+type repoResult interface {
+	enabled(entry *config.Entry) bool
+	describe(m *metricSet) []*prometheus.Desc
+	collect(ch chan<- prometheus.Metric, m *metricSet, name []string)
+}
+
+// repoResults holds the most recent result of each repo for the
+// collectors that check repos apart from collections, such as Prober and
+// RepoChecker, and exports them. Results are only exported while their
+// repo is configured and enabled, see repoResult.
+type repoResults[T repoResult] struct {
+	logger     *zap.Logger
+	config     func() config.File
+	metricSets []*metricSet
+
+	mu      sync.Mutex
+	results map[string]T
+}
+
+func newRepoResults[T repoResult](logger *zap.Logger, opts MetricOptions, config func() config.File) *repoResults[T] {
+	return &repoResults[T]{
+		logger:     logger,
+		config:     config,
+		metricSets: opts.metricSets(),
+		results:    map[string]T{},
+	}
+}
+
+// entry returns the entry of a repo if its results are exported,
+// otherwise nil
+func (r *repoResults[T]) entry(cfg config.File, repo string) *config.Entry {
+	var zero T
+	entry := cfg.Find(repo)
+	if entry == nil || entry.Disabled || !zero.enabled(entry) {
+		return nil
+	}
+	return entry
+}
+
+// set records the result of a repo
+func (r *repoResults[T]) set(repo string, res T) {
+	r.update(func(results map[string]T) { results[repo] = res })
+}
+
+// update calls fn with the results, which it may change
+func (r *repoResults[T]) update(fn func(results map[string]T)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(r.results)
+}
+
+// replace replaces every result
+func (r *repoResults[T]) replace(results map[string]T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = results
+}
+
+func (r *repoResults[T]) Describe(ch chan<- *prometheus.Desc) {
+	var zero T
+	for _, m := range r.metricSets {
+		for _, desc := range zero.describe(m) {
+			ch <- desc
+		}
+	}
+}
+
+func (r *repoResults[T]) Collect(ch chan<- prometheus.Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg := r.config()
+	for _, m := range r.metricSets {
+		for repo, res := range r.results {
+			if r.entry(cfg, repo) == nil {
+				continue
+			}
+			res.collect(ch, m, m.repoLabelValues(cfg, repo))
+		}
+	}
+}
+
+// withRepo returns a copy of ctx with a logger, which is also returned,
+// that has the fields of a repo
+func withRepo(ctx context.Context, logger *zap.Logger, entry *config.Entry) (context.Context, *zap.Logger) {
+	return logctx.WithFields(logctx.With(ctx, logger), zap.String("repo", config.ScrubRepo(entry.Repo)), zap.String("backend", entry.Backend()))
+}
+
+// checkRepos runs check concurrently for every enabled repo that isn't
+// read by a plugin and returns the results by repo. Each check has a
+// logger with the fields of the repo and times out after probeTimeout.
+func checkRepos[T any](ctx context.Context, logger *zap.Logger, cfg config.File, check func(context.Context, *zap.Logger, *config.Entry) T) map[string]T {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := map[string]T{}
+
+	for _, entry := range cfg {
+		if entry.Disabled || entry.Plugin != "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, logger := withRepo(ctx, logger, entry)
+			ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+			defer cancel()
+
+			res := check(ctx, logger, entry)
+
+			mu.Lock()
+			results[entry.Repo] = res
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runEvery calls fn immediately and then every interval until ctx is
+// done
+func runEvery(ctx context.Context, interval time.Duration, fn func(context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	fn(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			fn(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// growthWindow is how far back the growth of a repo is measured to
+	// project when it will exceed its size budget
+	growthWindow = 7 * 24 * time.Hour
+
+	// sizeSampleInterval is the minimum time between the size samples
+	// kept for measuring growth, which limits how many are kept
+	sizeSampleInterval = time.Hour
+)
+
+// SizeSample is the size of a repo at the time it was collected
+type SizeSample struct {
+	Time  time.Time `json:"time"`
+	Bytes int64     `json:"bytes"`
+}
+
+// addSizeSample returns the samples within the growth window of now with
+// a sample of size at now added, unless the newest sample is too recent
+func addSizeSample(samples []SizeSample, now time.Time, size int64) []SizeSample {
+	var out []SizeSample
+	for _, s := range samples {
+		if now.Sub(s.Time) <= growthWindow {
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 || now.Sub(out[len(out)-1].Time) >= sizeSampleInterval {
+		out = append(out, SizeSample{Time: now, Bytes: size})
+	}
+	return out
+}
+
+// utilization returns the fraction of the size budget that the repo
+// uses
+func (s RepoStats) utilization() float64 {
+	return float64(s.SizeBytes) / float64(s.SizeBudget)
+}
+
+// daysToFull projects the number of days until the repo exceeds its
+// size budget from its growth since the oldest size sample. False is
+// returned if the repo isn't growing or there isn't enough history.
+func (s RepoStats) daysToFull() (float64, bool) {
+	if len(s.SizeHistory) == 0 {
+		return 0, false
+	}
+
+	oldest := s.SizeHistory[0]
+	elapsed := s.Time.Sub(oldest.Time)
+	if elapsed < sizeSampleInterval || s.SizeBytes <= oldest.Bytes {
+		return 0, false
+	}
+
+	perDay := float64(s.SizeBytes-oldest.Bytes) / elapsed.Hours() * 24
+	return math.Max(float64(s.SizeBudget-s.SizeBytes)/perDay, 0), true
+}
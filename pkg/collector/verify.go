@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/repoerr"
+	"github.com/restic/restic/reporter/pkg/resticrepo"
+	"go.uber.org/zap"
+)
+
+// VerifyFunc reads a percent of the data of a repo
+type VerifyFunc func(ctx context.Context, entry *config.Entry, percent float64) (resticrepo.VerifyResult, error)
+
+// DefaultVerify opens a repo and verifies it with
+// resticrepo.Repo.Verify
+func DefaultVerify(ctx context.Context, entry *config.Entry, percent float64) (resticrepo.VerifyResult, error) {
+	repo, ctx, err := resticrepo.Open(ctx, entry.Repo, entry.Password, entry.ExtraConfig())
+	if err != nil {
+		return resticrepo.VerifyResult{}, err
+	}
+	defer repo.Close()
+	return repo.Verify(ctx, percent)
+}
+
+// verifyResult is the result of the most recent verification of a repo.
+// errors is -1 if the verification couldn't be run. total is the size of
+// the data read by every verification of the repo.
+type verifyResult struct {
+	errors int
+	bytes  int64
+	total  int64
+	time   time.Time
+}
+
+// Verifier reads a random subset of the data of the repos with a
+// verify_schedule on that schedule, like restic check --read-data-subset,
+// so that bit rot in storage that is never read otherwise is detected.
+// Verifications download the data they read so they're run by the
+// scheduler of the exporter, see Verify.
+type Verifier struct {
+	*repoResults[verifyResult]
+	verify VerifyFunc
+}
+
+// NewVerifier creates a verifier for the repos that config returns,
+// which is usually ResticCollector.Config
+func NewVerifier(logger *zap.Logger, opts MetricOptions, config func() config.File, verify VerifyFunc) *Verifier {
+	return &Verifier{
+		repoResults: newRepoResults[verifyResult](logger, opts, config),
+		verify:      verify,
+	}
+}
+
+// Verify verifies the verify_percent of a repo if it's still configured
+// with a verify_schedule
+func (v *Verifier) Verify(ctx context.Context, repo string) {
+	entry := v.entry(v.config(), repo)
+	if entry == nil {
+		return
+	}
+
+	ctx, logger := withRepo(ctx, v.logger, entry)
+	logger.Info("Verifying repo data", zap.Float64("percent", entry.VerifyPercent))
+
+	start := time.Now()
+	res, err := v.verify(ctx, entry, entry.VerifyPercent)
+	result := verifyResult{errors: len(res.Errors), bytes: res.Bytes, time: time.Now()}
+	switch {
+	case err != nil:
+		logger.Error("Error verifying repo data", zap.String("error_class", repoerr.Class(err)), zap.Error(err))
+		result.errors = -1
+	case len(res.Errors) > 0:
+		logger.Error("Repo data verification found errors", zap.Int("errors", len(res.Errors)), zap.Error(res.Errors[0]))
+	default:
+		logger.Info("Repo data verification found no errors",
+			zap.Int("packs", res.Packs), zap.Int64("bytes", res.Bytes), zap.Duration("duration", time.Since(start)))
+	}
+
+	v.update(func(results map[string]verifyResult) {
+		result.total = results[repo].total + res.Bytes
+		results[repo] = result
+	})
+}
+
+// enabled excludes repos that no longer have a verify_schedule
+func (verifyResult) enabled(entry *config.Entry) bool {
+	return entry.VerifySchedule != ""
+}
+
+func (verifyResult) describe(m *metricSet) []*prometheus.Desc {
+	return []*prometheus.Desc{m.verifySuccess, m.verifyErrors, m.verifyBytes, m.verifiedBytes, m.verifyTime}
+}
+
+func (res verifyResult) collect(ch chan<- prometheus.Metric, m *metricSet, name []string) {
+	var success float64
+	if res.errors == 0 {
+		success = 1
+	}
+	ch <- prometheus.MustNewConstMetric(m.verifySuccess, prometheus.GaugeValue, success, name...)
+	if res.errors >= 0 {
+		ch <- prometheus.MustNewConstMetric(m.verifyErrors, prometheus.GaugeValue, float64(res.errors), name...)
+		ch <- prometheus.MustNewConstMetric(m.verifyBytes, prometheus.GaugeValue, float64(res.bytes), name...)
+	}
+	ch <- prometheus.MustNewConstMetric(m.verifiedBytes, prometheus.CounterValue, float64(res.total), name...)
+	ch <- prometheus.MustNewConstMetric(m.verifyTime, prometheus.GaugeValue, float64(res.time.Unix()), name...)
+}
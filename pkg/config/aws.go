@@ -0,0 +1,70 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultAWSProfile is the profile read from an AWS shared credentials
+// file when an entry doesn't set aws_profile
+const DefaultAWSProfile = "default"
+
+// ReadAWSCredentials reads the access key of a profile from an AWS
+// shared credentials file, such as ~/.aws/credentials. Temporary
+// credentials with a session token aren't supported since restic can
+// only be given static keys.
+func ReadAWSCredentials(filename, profile string) (keyID, secret string, err error) {
+	if profile == "" {
+		profile = DefaultAWSProfile
+	}
+
+	fd, err := os.Open(filename)
+	if err != nil {
+		return "", "", err
+	}
+	defer fd.Close()
+
+	var section string
+	var found bool
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			found = found || section == profile
+			continue
+		}
+		if section != profile {
+			continue
+		}
+
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "aws_access_key_id":
+			keyID = strings.TrimSpace(v)
+		case "aws_secret_access_key":
+			secret = strings.TrimSpace(v)
+		case "aws_session_token":
+			return "", "", fmt.Errorf("Profile %q has a session token, which isn't supported", profile)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+
+	if !found {
+		return "", "", fmt.Errorf("No profile %q in %s", profile, filename)
+	}
+	if keyID == "" || secret == "" {
+		return "", "", fmt.Errorf("Profile %q has no aws_access_key_id and aws_secret_access_key", profile)
+	}
+	return keyID, secret, nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/restic/restic/reporter/pkg/resticrepo"
+	"github.com/restic/restic/reporter/pkg/schedule"
+)
+
+// DefaultCanaryMaxSize is the largest random file restored by a restore
+// canary without a max_size
+const DefaultCanaryMaxSize = "10MB"
+
+// RestoreCanary periodically restores a file from the newest snapshot
+// of a repo and verifies it, see collector.RestoreCanary
+type RestoreCanary struct {
+	// Schedule is when the file is restored, see schedule.Parse
+	Schedule string `json:"schedule"`
+
+	// Path is the file that's restored, otherwise a random file of at
+	// most MaxSize, see ParseSize
+	Path    string `json:"path,omitempty"`
+	MaxSize string `json:"max_size,omitempty"`
+
+	// Host restores from the newest snapshot of a host instead of the
+	// newest of the repo
+	Host string `json:"host,omitempty"`
+}
+
+// Validate checks that the canary has a schedule and that it parses
+func (c RestoreCanary) Validate() error {
+	var errs []error
+	if c.Schedule == "" {
+		errs = append(errs, errors.New("restore_canary requires a schedule"))
+	} else if _, err := schedule.Parse(c.Schedule); err != nil {
+		errs = append(errs, fmt.Errorf("invalid restore_canary schedule: %w", err))
+	}
+	if c.MaxSize != "" {
+		if c.Path != "" {
+			errs = append(errs, errors.New("restore_canary max_size can't be combined with path"))
+		}
+		if _, err := ParseSize(c.MaxSize); err != nil {
+			errs = append(errs, fmt.Errorf("restore_canary max_size %q must be a size such as 10MB", c.MaxSize))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Options returns the options for resticrepo.Repo.RestoreFile. The
+// canary is validated with the configuration when it's loaded, see
+// LoadAll, so an invalid max_size is never used and is treated as the
+// default.
+func (c RestoreCanary) Options() resticrepo.RestoreOptions {
+	maxSize, err := ParseSize(c.MaxSize)
+	if err != nil {
+		maxSize, _ = ParseSize(DefaultCanaryMaxSize)
+	}
+	return resticrepo.RestoreOptions{Host: c.Host, Path: c.Path, MaxSize: maxSize}
+}
@@ -0,0 +1,39 @@
+package config
+
+// StripComments removes // comments from JSON so that configuration
+// files can be documented. Comments inside of strings are left alone.
+func StripComments(in []byte) []byte {
+	out := make([]byte, 0, len(in))
+	inString, escaped, inComment := false, false, false
+
+	for i := 0; i < len(in); i++ {
+		c := in[i]
+
+		switch {
+		case inComment:
+			if c == '\n' {
+				inComment = false
+				out = append(out, c)
+			}
+			continue
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(in) && in[i+1] == '/':
+			inComment = true
+			continue
+		}
+
+		out = append(out, c)
+	}
+
+	return out
+}
@@ -0,0 +1,1137 @@
+// Package config loads and validates the exporter configuration file
+// and resolves the secrets it references.
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/resticrepo"
+	"github.com/restic/restic/reporter/pkg/schedule"
+	"github.com/restic/restic/reporter/pkg/snapshots"
+)
+
+// Entry is the configuration for a single repo
+type Entry struct {
+	Disabled        bool   `json:"disabled,omitempty"`
+	Repo            string `json:"repo"`
+	Password        string `json:"password,omitempty"`
+	VaultMaterial   string `json:"vault_material,omitempty"`
+	B2VaultMaterial string `json:"b2_vault_material,omitempty"`
+	B2AccountId     string `json:"b2_account_id,omitempty"`
+	B2Key           string `json:"b2_key,omitempty"`
+
+	// RESTUsername and RESTPassword, or RESTToken, are the credentials
+	// of a rest-server repo instead of a user and password in the URL.
+	// RESTVaultMaterial is a path to a Vault secret with the username
+	// and password fields to read them from instead.
+	RESTVaultMaterial string `json:"rest_vault_material,omitempty"`
+	RESTUsername      string `json:"rest_username,omitempty"`
+	RESTPassword      string `json:"rest_password,omitempty"`
+	RESTToken         string `json:"rest_token,omitempty"`
+
+	// AWSAccessKeyID and AWSSecretAccessKey are the credentials of an
+	// S3 repo. AWSCredentialsFile is an AWS shared credentials file to
+	// read them from instead, with the AWSProfile section. AWSIAMRole
+	// leaves them to restic, which uses the environment or the IAM role
+	// of the instance or pod.
+	AWSAccessKeyID     string `json:"aws_access_key_id,omitempty"`
+	AWSSecretAccessKey string `json:"aws_secret_access_key,omitempty"`
+	AWSCredentialsFile string `json:"aws_credentials_file,omitempty"`
+	AWSProfile         string `json:"aws_profile,omitempty"`
+	AWSIAMRole         bool   `json:"aws_iam_role,omitempty"`
+
+	// AzureAccountName is the storage account of an Azure repo and
+	// AzureAccountKey its key, or AzureAccountSAS a SAS token for it.
+	// AzureVaultMaterial is a path to a Vault secret with the name and
+	// key fields to read the account name and key from instead.
+	AzureVaultMaterial string `json:"azure_vault_material,omitempty"`
+	AzureAccountName   string `json:"azure_account_name,omitempty"`
+	AzureAccountKey    string `json:"azure_account_key,omitempty"`
+	AzureAccountSAS    string `json:"azure_account_sas,omitempty"`
+
+	// GSCredentials is the JSON key of a service account for a GCS repo,
+	// usually as a secret reference such as a file:// path.
+	// GSVaultMaterial is a path to a Vault secret with the key in its
+	// credentials field to read it from instead. Without either the
+	// application default credentials are used.
+	GSVaultMaterial string `json:"gs_vault_material,omitempty"`
+	GSCredentials   string `json:"gs_credentials,omitempty"`
+
+	// RcloneProgram and RcloneConfig are the rclone binary and its
+	// configuration file for an rclone repo, see resticrepo.RcloneConfig
+	RcloneProgram string `json:"rclone_program,omitempty"`
+	RcloneConfig  string `json:"rclone_config,omitempty"`
+
+	// SwiftAuthURL, SwiftRegion, SwiftTenant, SwiftDomain, SwiftUser and
+	// SwiftKey are the Keystone credentials of a Swift repo, see
+	// resticrepo.SwiftConfig. SwiftVaultMaterial is a path to a Vault
+	// secret with the user and key fields to read the user and key from
+	// instead.
+	SwiftAuthURL       string `json:"swift_auth_url,omitempty"`
+	SwiftRegion        string `json:"swift_region,omitempty"`
+	SwiftTenant        string `json:"swift_tenant,omitempty"`
+	SwiftDomain        string `json:"swift_domain,omitempty"`
+	SwiftVaultMaterial string `json:"swift_vault_material,omitempty"`
+	SwiftUser          string `json:"swift_user,omitempty"`
+	SwiftKey           string `json:"swift_key,omitempty"`
+
+	// Env are the settings that restic reads from the environment for
+	// the backend of the repo, which are passed to the backend without
+	// changing the environment of the process. Values may be secret
+	// references. See resticrepo.EnvConfig.
+	Env map[string]string `json:"env,omitempty"`
+
+	// SFTPIdentityFile, SFTPKnownHostsFile and SFTPHostKeyChecking are
+	// passed to ssh for an SFTP repo, see resticrepo.SFTPConfig
+	SFTPIdentityFile    string `json:"sftp_identity_file,omitempty"`
+	SFTPKnownHostsFile  string `json:"sftp_known_hosts_file,omitempty"`
+	SFTPHostKeyChecking string `json:"sftp_host_key_checking,omitempty"`
+
+	// Plugin is the path to an executable that reads the repo instead of
+	// restic, see collector.PluginReader. PluginOptions are passed to it.
+	Plugin        string            `json:"plugin,omitempty"`
+	PluginOptions map[string]string `json:"plugin_options,omitempty"`
+
+	// Schedule overrides the server schedule for this repo, see
+	// schedule.Parse for the format
+	Schedule string `json:"schedule,omitempty"`
+
+	// GroupBy overrides the server grouping of snapshots into backup
+	// sets for this repo, see snapshots.ParseGroupBy for the format. An
+	// empty string groups all snapshots into one set so nil is unset.
+	GroupBy *string `json:"group_by,omitempty"`
+
+	// SplitByPath makes each backed up path its own backup set
+	SplitByPath bool `json:"split_by_path,omitempty"`
+
+	// SplitByTag makes each tag that starts with SplitTagPrefix its own
+	// backup set
+	SplitByTag     bool   `json:"split_by_tag,omitempty"`
+	SplitTagPrefix string `json:"split_tag_prefix,omitempty"`
+
+	// LabelPolicy maps backup set labels to LabelDrop or LabelHash to
+	// limit the cardinality or hide the values of the labels
+	LabelPolicy map[string]string `json:"label_policy,omitempty"`
+
+	// MinSnapshots is the number of snapshots that every backup set
+	// should have, zero disables the check
+	MinSnapshots int `json:"min_snapshots,omitempty"`
+
+	// DropAfterDays stops exporting backup sets whose newest snapshot is
+	// older than this many days, zero exports them forever
+	DropAfterDays int `json:"drop_after_days,omitempty"`
+
+	// LegacyDays is the age in days after which the backup sets of the
+	// repo are exported with isLegacy="true" and StaleDays the age after
+	// which backup_set_stale is 1, both snapshots.DefaultLegacyDays if
+	// zero. StaleDays defaults to LegacyDays if only that is set.
+	LegacyDays int `json:"legacy_days,omitempty"`
+	StaleDays  int `json:"stale_days,omitempty"`
+
+	// MissingTTLDays stops exporting backup sets that have had no
+	// snapshots for this many days, zero exports them until the repo is
+	// removed from the configuration
+	MissingTTLDays int `json:"missing_ttl_days,omitempty"`
+
+	// SizeBudget is the size that the repo may grow to, such as 500GB,
+	// see ParseSize. The size of the repo is only read if it has a
+	// budget since that lists every pack file.
+	SizeBudget string `json:"size_budget,omitempty"`
+
+	// Stats reads the totals of the index of the repo, see
+	// resticrepo.Repo.Stats, which is slow for large repos
+	Stats bool `json:"stats,omitempty"`
+
+	// Check checks the structure of the repo like restic check, see
+	// collector.RepoChecker
+	Check bool `json:"check,omitempty"`
+
+	// VerifySchedule is when a random VerifyPercent of the data of the
+	// repo is read and verified, like restic check --read-data-subset,
+	// see collector.Verifier and schedule.Parse for the format
+	VerifySchedule string  `json:"verify_schedule,omitempty"`
+	VerifyPercent  float64 `json:"verify_percent,omitempty"`
+
+	// ForgetPolicy is the policy that restic forget is run with for the
+	// repo, to count the snapshots that it would remove, see
+	// resticrepo.Repo.Forgettable
+	ForgetPolicy *resticrepo.ForgetPolicy `json:"forget_policy,omitempty"`
+
+	// RestoreCanary restores a file from the repo on a schedule to
+	// verify that it can be restored
+	RestoreCanary *RestoreCanary `json:"restore_canary,omitempty"`
+
+	// RestoreSize measures the size of the newest snapshot of every
+	// backup set, see resticrepo.Repo.RestoreSize, which reads all of
+	// the trees of the snapshots
+	RestoreSize bool `json:"restore_size,omitempty"`
+
+	// B2Usage reads what B2 stores for a B2 repo, including what restic
+	// can't see, see b2api.Usage
+	B2Usage bool `json:"b2_usage,omitempty"`
+
+	// S3StorageClasses reads what S3 stores for an S3 repo by storage
+	// class, see resticrepo.S3StorageClasses
+	S3StorageClasses bool `json:"s3_storage_classes,omitempty"`
+
+	// AppendOnly declares that a rest-server repo should be append-only,
+	// which is verified by probing whether its credentials can delete
+	AppendOnly bool `json:"append_only,omitempty"`
+
+	// RetentionLadder is the number of recent periods that should each
+	// have a snapshot in every backup set
+	RetentionLadder *snapshots.Ladder `json:"retention_ladder,omitempty"`
+
+	// CoverageDays measures the fraction of this many recent days that
+	// have a snapshot in every backup set, zero disables it
+	CoverageDays int `json:"coverage_days,omitempty"`
+
+	// SnapshotMetrics exports this many of the most recent snapshots of
+	// every backup set as their own series, at most snapshots.MaxRecent.
+	// This is meant for small repos since every snapshot is a series.
+	SnapshotMetrics int `json:"snapshot_metrics,omitempty"`
+
+	// Name is the name the repo is exported as instead of its scrubbed
+	// URI, see Label
+	Name string `json:"name,omitempty"`
+
+	// Team and Environment are exported as labels of the metrics of the
+	// repo, for ownership reporting and routing alerts. Their values
+	// may be restricted by the Document.
+	Team        string `json:"team,omitempty"`
+	Environment string `json:"environment,omitempty"`
+
+	// Labels are exported as labels of the metrics of the repo, such as
+	// criticality for routing alerts. Only the labels that the exporter
+	// is started with are exported, see collector.MetricOptions.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// IgnoreTags excludes the snapshots that have any of these tags
+	IgnoreTags []string `json:"ignore_tags,omitempty"`
+
+	// IncludeHosts, ExcludeHosts, IncludeUsers and ExcludeUsers are
+	// regular expressions that select the snapshots to export by their
+	// host and user, see SnapshotFilter
+	IncludeHosts []string `json:"include_hosts,omitempty"`
+	ExcludeHosts []string `json:"exclude_hosts,omitempty"`
+	IncludeUsers []string `json:"include_users,omitempty"`
+	ExcludeUsers []string `json:"exclude_users,omitempty"`
+
+	// ExpectedPaths maps hostnames to the paths that the host must back
+	// up, the host "*" applies to every host without its own paths
+	ExpectedPaths map[string][]string `json:"expected_paths,omitempty"`
+
+	// MaxAgeHours is how old the newest snapshot of a backup set may be
+	// before it's overdue, zero never makes it overdue. HostMaxAgeHours
+	// overrides it for the backup sets of some hosts.
+	MaxAgeHours     int            `json:"max_age_hours,omitempty"`
+	HostMaxAgeHours map[string]int `json:"host_max_age_hours,omitempty"`
+
+	// ExpectedHosts are the hosts that must have snapshots in the repo,
+	// so that a host that has never backed up isn't overlooked
+	ExpectedHosts []string `json:"expected_hosts,omitempty"`
+
+	// PreviousNames are names that the repo was exported as before it
+	// was renamed, which are also exported until they expire
+	PreviousNames []PreviousName `json:"previous_names,omitempty"`
+}
+
+// PreviousName is a former name of a repo. Until is a date, such as
+// 2024-06-01, or an RFC 3339 time after which the name is no longer
+// exported.
+type PreviousName struct {
+	Name  string `json:"name"`
+	Until string `json:"until"`
+}
+
+// Expiry parses Until
+func (p PreviousName) Expiry() (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, p.Until); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, p.Until)
+}
+
+// ExpectedPathsFor returns the paths that a host must back up, which
+// are those for "*" if the host has none of its own
+func (e Entry) ExpectedPathsFor(host string) []string {
+	if paths, ok := e.ExpectedPaths[host]; ok {
+		return paths
+	}
+	return e.ExpectedPaths["*"]
+}
+
+// MaxAgeFor returns how old the newest snapshot of a backup set of a
+// host may be, which is that of the repo if the host has none of its
+// own. Zero means that its sets are never overdue.
+func (e Entry) MaxAgeFor(host string) time.Duration {
+	hours, ok := e.HostMaxAgeHours[host]
+	if !ok {
+		hours = e.MaxAgeHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// LegacyDaysOr returns the legacy_days of the repo or
+// snapshots.DefaultLegacyDays if it has none
+func (e Entry) LegacyDaysOr() int {
+	if e.LegacyDays > 0 {
+		return e.LegacyDays
+	}
+	return snapshots.DefaultLegacyDays
+}
+
+// StaleDaysOr returns the stale_days of the repo or its legacy days if
+// it has none
+func (e Entry) StaleDaysOr() int {
+	if e.StaleDays > 0 {
+		return e.StaleDays
+	}
+	return e.LegacyDaysOr()
+}
+
+// GroupByOr returns the grouping of the repo or def if it has none,
+// split by path or tag if the repo is. Configurations are validated when
+// they're loaded, see LoadAll, so an invalid grouping is never used and
+// is treated as none.
+func (e Entry) GroupByOr(def snapshots.GroupBy) snapshots.GroupBy {
+	g := def
+	if e.GroupBy != nil {
+		if parsed, err := snapshots.ParseGroupBy(*e.GroupBy); err == nil {
+			g = parsed
+		}
+	}
+	if e.SplitByPath {
+		g.EachPath = true
+	}
+	if e.SplitByTag {
+		g.EachTag = true
+		g.TagPrefix = e.SplitTagPrefix
+	}
+	return g
+}
+
+// SnapshotFilter returns the filter that selects the snapshots of the
+// repo to export. Host and user patterns must match the whole host or
+// user. Configurations are validated when they're loaded, see LoadAll,
+// so invalid patterns are never used and are treated as none.
+func (e Entry) SnapshotFilter() snapshots.Filter {
+	f := snapshots.Filter{IgnoreTags: e.IgnoreTags}
+	f.IncludeHosts, _ = snapshots.MatchAny(e.IncludeHosts)
+	f.ExcludeHosts, _ = snapshots.MatchAny(e.ExcludeHosts)
+	f.IncludeUsers, _ = snapshots.MatchAny(e.IncludeUsers)
+	f.ExcludeUsers, _ = snapshots.MatchAny(e.ExcludeUsers)
+	return f
+}
+
+// SizeBudgetBytes returns the size budget in bytes, zero if the repo
+// has none. Configurations are validated when they're loaded, see
+// LoadAll, so an invalid budget is never used and is treated as none.
+func (e Entry) SizeBudgetBytes() int64 {
+	if e.SizeBudget == "" {
+		return 0
+	}
+	budget, _ := ParseSize(e.SizeBudget)
+	return budget
+}
+
+// ExtraConfig returns the backend specific configuration to pass to
+// resticrepo.Open, if any, with the Env of the entry.
+func (e Entry) ExtraConfig() any {
+	if len(e.Env) > 0 {
+		return resticrepo.EnvConfig{Env: e.Env, Config: e.backendConfig()}
+	}
+	return e.backendConfig()
+}
+
+// envCredentials are the sets of environment variables with which Env
+// supplies the credentials of each backend instead of the fields of the
+// entry
+var envCredentials = map[string][][]string{
+	"azure": {{"AZURE_ACCOUNT_NAME", "AZURE_ACCOUNT_KEY"}, {"AZURE_ACCOUNT_NAME", "AZURE_ACCOUNT_SAS"}},
+	"b2":    {{"B2_ACCOUNT_ID", "B2_ACCOUNT_KEY"}},
+	"s3":    {{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"}},
+	"swift": {{"OS_USERNAME", "OS_PASSWORD"}},
+}
+
+// EnvCredentials returns whether Env has the credentials of the backend
+// of the repo, see envCredentials
+func (e Entry) EnvCredentials() bool {
+	for _, names := range envCredentials[resticrepo.BackendType(e.Repo)] {
+		if !slices.ContainsFunc(names, func(name string) bool { return e.Env[name] == "" }) {
+			return true
+		}
+	}
+	return false
+}
+
+// backendConfig returns the backend specific configuration, if any
+func (e Entry) backendConfig() any {
+	if e.B2AccountId != "" || e.B2Key != "" {
+		return resticrepo.B2Config{
+			AccountID: e.B2AccountId,
+			Key:       e.B2Key,
+		}
+	}
+	if e.AWSAccessKeyID != "" || e.AWSSecretAccessKey != "" {
+		return resticrepo.S3Config{
+			AccessKeyID:     e.AWSAccessKeyID,
+			SecretAccessKey: e.AWSSecretAccessKey,
+		}
+	}
+	if e.AzureAccountName != "" {
+		return resticrepo.AzureConfig{
+			AccountName: e.AzureAccountName,
+			AccountKey:  e.AzureAccountKey,
+			AccountSAS:  e.AzureAccountSAS,
+		}
+	}
+	if e.GSCredentials != "" {
+		return resticrepo.GSConfig{CredentialsJSON: e.GSCredentials}
+	}
+	if e.RESTUsername != "" || e.RESTToken != "" {
+		return resticrepo.RESTConfig{
+			Username: e.RESTUsername,
+			Password: e.RESTPassword,
+			Token:    e.RESTToken,
+		}
+	}
+	if e.SwiftAuthURL != "" {
+		return resticrepo.SwiftConfig{
+			AuthURL:  e.SwiftAuthURL,
+			Region:   e.SwiftRegion,
+			Tenant:   e.SwiftTenant,
+			Domain:   e.SwiftDomain,
+			UserName: e.SwiftUser,
+			Key:      e.SwiftKey,
+		}
+	}
+	if resticrepo.BackendType(e.Repo) == "rclone" {
+		return resticrepo.RcloneConfig{
+			Program:    e.RcloneProgram,
+			ConfigFile: e.RcloneConfig,
+		}
+	}
+	if resticrepo.BackendType(e.Repo) == "sftp" {
+		return resticrepo.SFTPConfig{
+			IdentityFile:    e.SFTPIdentityFile,
+			KnownHostsFile:  e.SFTPKnownHostsFile,
+			HostKeyChecking: e.SFTPHostKeyChecking,
+		}
+	}
+	return nil
+}
+
+// Label returns the name that the repo is exported as, its Name if it
+// has one and otherwise its scrubbed URI, see ScrubRepo
+func (e Entry) Label() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return ScrubRepo(e.Repo)
+}
+
+// Backend returns the type of backend used to read the repo, which is
+// plugin for repos read by a plugin
+func (e Entry) Backend() string {
+	if e.Plugin != "" {
+		return "plugin"
+	}
+	return resticrepo.BackendType(e.Repo)
+}
+
+// Validate checks that the entry is complete without resolving any
+// secrets.
+func (e Entry) Validate() error {
+	var errs []error
+
+	if e.Repo == "" {
+		return errors.New("repo is required")
+	}
+
+	if e.Schedule != "" {
+		if _, err := schedule.Parse(e.Schedule); err != nil {
+			errs = append(errs, fmt.Errorf("invalid schedule: %w", err))
+		}
+	}
+
+	if err := validateLabelPolicy(e.LabelPolicy); err != nil {
+		errs = append(errs, err)
+	}
+
+	for name := range e.Labels {
+		if !validLabelName(name) {
+			errs = append(errs, fmt.Errorf("label name %q must be letters, digits and underscores not starting with a digit or __", name))
+		}
+	}
+
+	if e.MinSnapshots < 0 {
+		errs = append(errs, errors.New("min_snapshots must not be negative"))
+	}
+
+	if e.DropAfterDays < 0 {
+		errs = append(errs, errors.New("drop_after_days must not be negative"))
+	}
+
+	if e.LegacyDays < 0 {
+		errs = append(errs, errors.New("legacy_days must not be negative"))
+	}
+
+	if e.StaleDays < 0 {
+		errs = append(errs, errors.New("stale_days must not be negative"))
+	}
+
+	if e.MissingTTLDays < 0 {
+		errs = append(errs, errors.New("missing_ttl_days must not be negative"))
+	}
+
+	if e.SizeBudget != "" {
+		if _, err := ParseSize(e.SizeBudget); err != nil {
+			errs = append(errs, fmt.Errorf("size_budget %q must be a size such as 500GB", e.SizeBudget))
+		}
+	}
+
+	if e.B2Usage && (e.Plugin != "" || resticrepo.BackendType(e.Repo) != "b2") {
+		errs = append(errs, errors.New("b2_usage requires a b2 repo"))
+	}
+
+	if e.S3StorageClasses && (e.Plugin != "" || resticrepo.BackendType(e.Repo) != "s3") {
+		errs = append(errs, errors.New("s3_storage_classes requires an s3 repo"))
+	}
+
+	if e.Stats && e.Plugin != "" {
+		errs = append(errs, errors.New("stats requires a restic repo"))
+	}
+
+	if e.RestoreSize && e.Plugin != "" {
+		errs = append(errs, errors.New("restore_size requires a restic repo"))
+	}
+
+	if e.Check && e.Plugin != "" {
+		errs = append(errs, errors.New("check requires a restic repo"))
+	}
+
+	if e.VerifySchedule != "" {
+		if e.Plugin != "" {
+			errs = append(errs, errors.New("verify_schedule requires a restic repo"))
+		}
+		if _, err := schedule.Parse(e.VerifySchedule); err != nil {
+			errs = append(errs, fmt.Errorf("invalid verify_schedule: %w", err))
+		}
+		if e.VerifyPercent <= 0 || e.VerifyPercent > 100 {
+			errs = append(errs, errors.New("verify_percent must be greater than 0 and at most 100"))
+		}
+	} else if e.VerifyPercent != 0 {
+		errs = append(errs, errors.New("verify_percent requires verify_schedule"))
+	}
+
+	if e.RestoreCanary != nil {
+		if e.Plugin != "" {
+			errs = append(errs, errors.New("restore_canary requires a restic repo"))
+		}
+		if err := e.RestoreCanary.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if e.ForgetPolicy != nil {
+		if e.Plugin != "" {
+			errs = append(errs, errors.New("forget_policy requires a restic repo"))
+		}
+		if err := e.ForgetPolicy.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if e.AppendOnly && (e.Plugin != "" || resticrepo.BackendType(e.Repo) != "rest") {
+		errs = append(errs, errors.New("append_only requires a rest repo"))
+	}
+
+	if e.RESTVaultMaterial != "" || e.RESTUsername != "" || e.RESTPassword != "" || e.RESTToken != "" {
+		if e.Plugin != "" || resticrepo.BackendType(e.Repo) != "rest" {
+			errs = append(errs, errors.New("rest credentials require a rest repo"))
+		}
+		if e.RESTToken != "" && (e.RESTUsername != "" || e.RESTPassword != "" || e.RESTVaultMaterial != "") {
+			errs = append(errs, errors.New("rest_token must not be set with rest_username, rest_password or rest_vault_material"))
+		}
+		if e.RESTVaultMaterial == "" && (e.RESTUsername == "") != (e.RESTPassword == "") {
+			errs = append(errs, errors.New("rest_username and rest_password must be set together"))
+		}
+	}
+
+	if e.RetentionLadder != nil {
+		if err := e.RetentionLadder.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if e.CoverageDays < 0 {
+		errs = append(errs, errors.New("coverage_days must not be negative"))
+	}
+
+	if e.SnapshotMetrics < 0 || e.SnapshotMetrics > snapshots.MaxRecent {
+		errs = append(errs, fmt.Errorf("snapshot_metrics must be between 0 and %d", snapshots.MaxRecent))
+	}
+
+	if e.GroupBy != nil {
+		if _, err := snapshots.ParseGroupBy(*e.GroupBy); err != nil {
+			errs = append(errs, fmt.Errorf("invalid group_by: %w", err))
+		}
+	}
+
+	if e.SplitTagPrefix != "" && !e.SplitByTag {
+		errs = append(errs, errors.New("split_tag_prefix requires split_by_tag"))
+	}
+
+	if slices.Contains(e.IgnoreTags, "") {
+		errs = append(errs, errors.New("ignore_tags must not contain empty tags"))
+	}
+
+	for _, f := range []struct {
+		key      string
+		patterns []string
+	}{
+		{"include_hosts", e.IncludeHosts},
+		{"exclude_hosts", e.ExcludeHosts},
+		{"include_users", e.IncludeUsers},
+		{"exclude_users", e.ExcludeUsers},
+	} {
+		if _, err := snapshots.MatchAny(f.patterns); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", f.key, err))
+		}
+	}
+
+	for host, paths := range e.ExpectedPaths {
+		if len(paths) == 0 || slices.Contains(paths, "") {
+			errs = append(errs, fmt.Errorf("expected_paths for %s must be a list of paths", host))
+		}
+	}
+
+	if e.MaxAgeHours < 0 {
+		errs = append(errs, errors.New("max_age_hours must not be negative"))
+	}
+	for host, hours := range e.HostMaxAgeHours {
+		if hours < 0 {
+			errs = append(errs, fmt.Errorf("host_max_age_hours for %s must not be negative", host))
+		}
+	}
+
+	if slices.Contains(e.ExpectedHosts, "") {
+		errs = append(errs, errors.New("expected_hosts must not contain empty hosts"))
+	}
+	if len(e.ExpectedHosts) > 0 && e.LabelPolicy["host"] == LabelDrop {
+		errs = append(errs, errors.New("expected_hosts can't be used when the label_policy drops the host"))
+	}
+
+	for _, p := range e.PreviousNames {
+		if p.Name == "" {
+			errs = append(errs, errors.New("previous_names name is required"))
+		}
+		if _, err := p.Expiry(); err != nil {
+			errs = append(errs, fmt.Errorf("previous_names until %q must be a date or RFC 3339 time", p.Until))
+		}
+	}
+
+	// Plugins define their own requirements
+	if e.Plugin != "" {
+		return errors.Join(errs...)
+	}
+
+	if !resticrepo.Supported(e.Repo) {
+		errs = append(errs, fmt.Errorf("backend %q is not supported", resticrepo.BackendType(e.Repo)))
+	}
+
+	if e.Password == "" && e.VaultMaterial == "" {
+		errs = append(errs, errors.New("one of password or vault_material is required"))
+	}
+
+	if resticrepo.BackendType(e.Repo) == "b2" && e.B2VaultMaterial == "" && (e.B2AccountId == "" || e.B2Key == "") && !e.EnvCredentials() {
+		errs = append(errs, errors.New("b2 repos require b2_vault_material, b2_account_id and b2_key, or B2_ACCOUNT_ID and B2_ACCOUNT_KEY in env"))
+	}
+
+	if resticrepo.BackendType(e.Repo) == "s3" {
+		var sources int
+		for _, set := range []bool{e.AWSAccessKeyID != "" && e.AWSSecretAccessKey != "", e.AWSCredentialsFile != "", e.AWSIAMRole} {
+			if set {
+				sources++
+			}
+		}
+		if sources > 1 || (sources == 0 && !e.EnvCredentials()) {
+			errs = append(errs, errors.New("s3 repos require exactly one of aws_access_key_id and aws_secret_access_key, aws_credentials_file or aws_iam_role, or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY in env"))
+		}
+	}
+
+	if resticrepo.BackendType(e.Repo) == "azure" && e.AzureVaultMaterial == "" {
+		if (e.AzureAccountName == "" || (e.AzureAccountKey == "" && e.AzureAccountSAS == "")) && !e.EnvCredentials() {
+			errs = append(errs, errors.New("azure repos require azure_vault_material, azure_account_name and one of azure_account_key or azure_account_sas, or the same AZURE_* variables in env"))
+		}
+		if e.AzureAccountKey != "" && e.AzureAccountSAS != "" {
+			errs = append(errs, errors.New("azure_account_key and azure_account_sas must not both be set"))
+		}
+	}
+
+	if resticrepo.BackendType(e.Repo) == "swift" {
+		if e.SwiftAuthURL == "" && e.Env["OS_AUTH_URL"] == "" {
+			errs = append(errs, errors.New("swift repos require swift_auth_url or OS_AUTH_URL in env"))
+		}
+		if e.SwiftVaultMaterial == "" && (e.SwiftUser == "" || e.SwiftKey == "") && !e.EnvCredentials() {
+			errs = append(errs, errors.New("swift repos require swift_vault_material, swift_user and swift_key, or OS_USERNAME and OS_PASSWORD in env"))
+		}
+	}
+
+	if e.GSCredentials != "" && !NewSecretProviders(nil).IsRef(e.GSCredentials) && !json.Valid([]byte(e.GSCredentials)) {
+		errs = append(errs, errors.New("gs_credentials must be a JSON service account key or a secret reference"))
+	}
+
+	if e.AWSProfile != "" && e.AWSCredentialsFile == "" {
+		errs = append(errs, errors.New("aws_profile requires aws_credentials_file"))
+	}
+
+	switch e.SFTPHostKeyChecking {
+	case "", "yes", "accept-new", "no":
+	default:
+		errs = append(errs, fmt.Errorf("sftp_host_key_checking %q must be yes, accept-new or no", e.SFTPHostKeyChecking))
+	}
+
+	// The paths are quoted in the ssh arguments
+	if strings.Contains(e.SFTPIdentityFile+e.SFTPKnownHostsFile, `"`) {
+		errs = append(errs, errors.New("sftp_identity_file and sftp_known_hosts_file must not contain quotes"))
+	}
+
+	for name := range e.Env {
+		if !validEnvName(name) {
+			errs = append(errs, fmt.Errorf("env name %q must be letters, digits and underscores not starting with a digit", name))
+		} else if !resticrepo.EnvSupported(e.Repo, name) {
+			errs = append(errs, fmt.Errorf("env name %q isn't read by %s repos", name, resticrepo.BackendType(e.Repo)))
+		}
+	}
+
+	// The path is quoted in the rclone arguments
+	if strings.Contains(e.RcloneConfig, `"`) {
+		errs = append(errs, errors.New("rclone_config must not contain quotes"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validEnvName checks that name is a portable environment variable name,
+// which starts with a letter or underscore
+func validEnvName(name string) bool {
+	for i, c := range name {
+		letter := c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// validLabelName checks that name is a Prometheus label name that isn't
+// reserved, which has the same syntax as an environment variable
+func validLabelName(name string) bool {
+	return validEnvName(name) && !strings.HasPrefix(name, "__")
+}
+
+// File is the list of repos in a configuration file
+type File []*Entry
+
+// Validate checks every entry in the configuration and that no repo is
+// configured more than once.
+func (c File) Validate() error {
+	var errs []error
+	seen := map[string]bool{}
+
+	for i, entry := range c {
+		if err := entry.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("repo %d (%s): %w", i, RedactRepo(entry.Repo), err))
+		}
+		if seen[entry.Repo] {
+			errs = append(errs, fmt.Errorf("repo %d (%s): duplicate repo", i, RedactRepo(entry.Repo)))
+		}
+		seen[entry.Repo] = true
+	}
+
+	// Repos are exported by their label so labels must be unique too
+	labels := map[string]bool{}
+	for i, entry := range c {
+		if labels[entry.Label()] {
+			errs = append(errs, fmt.Errorf("repo %d (%s): name %s is already used", i, RedactRepo(entry.Repo), entry.Label()))
+		}
+		labels[entry.Label()] = true
+	}
+
+	// Previous names are exported alongside the repos so must not
+	// collide with them or each other
+	for i, entry := range c {
+		for _, p := range entry.PreviousNames {
+			name := ScrubRepo(p.Name)
+			if labels[name] {
+				errs = append(errs, fmt.Errorf("repo %d (%s): previous name %s is already used", i, RedactRepo(entry.Repo), RedactRepo(p.Name)))
+			}
+			labels[name] = true
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ErrVaultDisabled is the error for Vault secret references that are
+// resolved without a Vault client
+var ErrVaultDisabled = errors.New("Vault is disabled")
+
+// Find returns the entry for a repo, by its URI or by its Label, or nil
+// if no such repo is configured. URIs are matched first so that a name
+// can't hide another repo.
+func (c File) Find(repo string) *Entry {
+	for _, entry := range c {
+		if entry.Repo == repo {
+			return entry
+		}
+	}
+	for _, entry := range c {
+		if entry.Label() == repo {
+			return entry
+		}
+	}
+	return nil
+}
+
+// CurrentVersion is the version of the configuration file format
+// written by Migrate. Version 1 is the original format which is a bare
+// list of repos. Version 2 wraps the list in an object to leave room for
+// settings that aren't per-repo.
+const CurrentVersion = 2
+
+// Document is the top level of a version 2 or later configuration file
+type Document struct {
+	Version int `json:"version"`
+
+	// Teams and Environments are the allowed values of the team and
+	// environment of repos. If either is set then every repo must have
+	// one of its values, see checkTaxonomy.
+	Teams        []string `json:"teams,omitempty"`
+	Environments []string `json:"environments,omitempty"`
+
+	Repos File `json:"repos"`
+}
+
+// checkTaxonomy checks that every repo has one of the allowed teams and
+// environments, if there are any
+func (d *Document) checkTaxonomy() error {
+	var errs []error
+	for i, entry := range d.Repos {
+		if len(d.Teams) > 0 && !slices.Contains(d.Teams, entry.Team) {
+			errs = append(errs, fmt.Errorf("repo %d (%s): team %q must be one of %s", i, RedactRepo(entry.Repo), entry.Team, strings.Join(d.Teams, ", ")))
+		}
+		if len(d.Environments) > 0 && !slices.Contains(d.Environments, entry.Environment) {
+			errs = append(errs, fmt.Errorf("repo %d (%s): environment %q must be one of %s", i, RedactRepo(entry.Repo), entry.Environment, strings.Join(d.Environments, ", ")))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseDocument parses any version of the configuration file format.
+// The version 1 format is returned as a Document with version 1. The
+// teams and environments of the repos aren't checked.
+func ParseDocument(data []byte) (*Document, error) {
+	data = bytes.TrimSpace(StripComments(data))
+
+	if bytes.HasPrefix(data, []byte("[")) {
+		var out File
+		if err := json.Unmarshal(data, &out); err != nil {
+			return nil, err
+		}
+		return &Document{Version: 1, Repos: out}, nil
+	}
+
+	var doc Document
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	if doc.Version < 2 || doc.Version > CurrentVersion {
+		return nil, fmt.Errorf("Unsupported configuration version %d", doc.Version)
+	}
+
+	return &doc, nil
+}
+
+// Parse parses any version of the configuration file format and
+// returns the repos and the version of the format that was parsed.
+func Parse(data []byte) (File, int, error) {
+	doc, err := ParseDocument(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := doc.checkTaxonomy(); err != nil {
+		return nil, 0, err
+	}
+	return doc.Repos, doc.Version, nil
+}
+
+// Read reads a configuration file without resolving any secrets. The
+// version of the format that was read is also returned.
+func Read(name string) (File, int, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return Parse(data)
+}
+
+// readDocument reads a configuration file without checking the teams
+// and environments of its repos, see ParseDocument
+func readDocument(name string) (*Document, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDocument(data)
+}
+
+// ReadAll reads several configuration files without resolving any
+// secrets and merges their repos in order, such as a base file shared
+// by every site and an overlay for one site. A repo may only be in one
+// of the files. The teams and environments allowed by any of the files
+// are allowed for the repos of all of them. The lowest version of the
+// format that was read is returned.
+func ReadAll(names []string) (File, int, error) {
+	var merged Document
+	from := map[string]string{}
+
+	for _, name := range names {
+		doc, err := readDocument(name)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Error reading %s: %w", name, err)
+		}
+		if merged.Version == 0 || doc.Version < merged.Version {
+			merged.Version = doc.Version
+		}
+		merged.Teams = joinUnique(merged.Teams, doc.Teams)
+		merged.Environments = joinUnique(merged.Environments, doc.Environments)
+
+		for _, entry := range doc.Repos {
+			if prev, ok := from[entry.Repo]; ok {
+				return nil, 0, fmt.Errorf("Repo %s is in both %s and %s", RedactRepo(entry.Repo), prev, name)
+			}
+			from[entry.Repo] = name
+			merged.Repos = append(merged.Repos, entry)
+		}
+	}
+
+	if err := merged.checkTaxonomy(); err != nil {
+		return nil, 0, err
+	}
+	return merged.Repos, merged.Version, nil
+}
+
+// joinUnique returns the values of a followed by those of b that aren't
+// in a
+func joinUnique(a, b []string) []string {
+	for _, v := range b {
+		if !slices.Contains(a, v) {
+			a = append(a, v)
+		}
+	}
+	return a
+}
+
+// Migrate reads a configuration file in any supported format and
+// writes it in the current format. Secrets are not resolved so that
+// Vault secrets aren't written into the file.
+func Migrate(name string, w io.Writer) error {
+	doc, err := readDocument(name)
+	if err != nil {
+		return err
+	}
+	if err := doc.checkTaxonomy(); err != nil {
+		return err
+	}
+
+	doc.Version = CurrentVersion
+	out, err := json.MarshalIndent(doc, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", out)
+	return err
+}
+
+// Load reads and validates a configuration file and resolves all of the
+// secrets it references using providers. References to Vault secrets are left
+// unresolved if Vault is disabled.
+func Load(ctx context.Context, name string, providers SecretProviders) (File, error) {
+	return LoadAll(ctx, []string{name}, providers)
+}
+
+// LoadAll reads and merges several configuration files, see ReadAll,
+// validates them and resolves all of the secrets they reference like
+// Load. An invalid configuration is an error so that everything that
+// reads it can rely on it being valid.
+func LoadAll(ctx context.Context, names []string, providers SecretProviders) (File, error) {
+	out, _, err := ReadAll(names)
+	if err != nil {
+		return nil, err
+	}
+	if err := out.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid configuration: %w", err)
+	}
+
+	for _, cfg := range out {
+		for _, res := range cfg.ResolveSecrets(ctx, providers) {
+			if res.Err != nil && !errors.Is(res.Err, ErrVaultDisabled) {
+				return nil, res.Err
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// SecretResolution is the result of resolving a single secret reference
+// for a config entry. It never contains the value of the secret.
+type SecretResolution struct {
+	Name   string
+	Source string
+	Ref    string
+	Err    error
+}
+
+// ResolveSecrets resolves all of the secret references in the entry and
+// replaces them with the secret values. The password, the credentials of
+// the backend such as b2_key, and the values of env may each be a
+// reference like env://RESTIC_PASSWORD. The vault_material fields, such
+// as b2_vault_material, are references to Vault secrets that are used if
+// the fields they populate are empty. The AWS keys are read from
+// aws_credentials_file if it's set. The result of each attempt is
+// returned.
+func (e *Entry) ResolveSecrets(ctx context.Context, providers SecretProviders) []SecretResolution {
+	var out []SecretResolution
+
+	resolve := func(name, ref string, dst *string) {
+		scheme, _, _ := strings.Cut(ref, "://")
+		res := SecretResolution{Name: name, Source: scheme, Ref: ref}
+
+		// An unresolved reference is cleared so that it's never used as
+		// the secret itself
+		if v, err := providers.Resolve(ctx, ref); err != nil {
+			*dst = ""
+			res.Err = err
+		} else {
+			*dst = v
+		}
+
+		out = append(out, res)
+	}
+
+	if e.Password == "" && e.VaultMaterial != "" {
+		resolve("password", "vault://"+e.VaultMaterial, &e.Password)
+	} else if providers.IsRef(e.Password) {
+		resolve("password", e.Password, &e.Password)
+	}
+
+	if e.B2Key == "" && e.B2VaultMaterial != "" {
+		resolve("b2_account_id", "vault://"+e.B2VaultMaterial+"#id", &e.B2AccountId)
+		resolve("b2_key", "vault://"+e.B2VaultMaterial+"#key", &e.B2Key)
+	} else {
+		if providers.IsRef(e.B2AccountId) {
+			resolve("b2_account_id", e.B2AccountId, &e.B2AccountId)
+		}
+		if providers.IsRef(e.B2Key) {
+			resolve("b2_key", e.B2Key, &e.B2Key)
+		}
+	}
+
+	if e.RESTPassword == "" && e.RESTVaultMaterial != "" {
+		resolve("rest_username", "vault://"+e.RESTVaultMaterial+"#username", &e.RESTUsername)
+		resolve("rest_password", "vault://"+e.RESTVaultMaterial+"#password", &e.RESTPassword)
+	} else {
+		if providers.IsRef(e.RESTUsername) {
+			resolve("rest_username", e.RESTUsername, &e.RESTUsername)
+		}
+		if providers.IsRef(e.RESTPassword) {
+			resolve("rest_password", e.RESTPassword, &e.RESTPassword)
+		}
+		if providers.IsRef(e.RESTToken) {
+			resolve("rest_token", e.RESTToken, &e.RESTToken)
+		}
+	}
+
+	if e.AzureAccountKey == "" && e.AzureAccountSAS == "" && e.AzureVaultMaterial != "" {
+		resolve("azure_account_name", "vault://"+e.AzureVaultMaterial+"#name", &e.AzureAccountName)
+		resolve("azure_account_key", "vault://"+e.AzureVaultMaterial+"#key", &e.AzureAccountKey)
+	} else {
+		if providers.IsRef(e.AzureAccountName) {
+			resolve("azure_account_name", e.AzureAccountName, &e.AzureAccountName)
+		}
+		if providers.IsRef(e.AzureAccountKey) {
+			resolve("azure_account_key", e.AzureAccountKey, &e.AzureAccountKey)
+		}
+		if providers.IsRef(e.AzureAccountSAS) {
+			resolve("azure_account_sas", e.AzureAccountSAS, &e.AzureAccountSAS)
+		}
+	}
+
+	if e.GSCredentials == "" && e.GSVaultMaterial != "" {
+		resolve("gs_credentials", "vault://"+e.GSVaultMaterial+"#credentials", &e.GSCredentials)
+	} else if providers.IsRef(e.GSCredentials) {
+		resolve("gs_credentials", e.GSCredentials, &e.GSCredentials)
+	}
+
+	if e.SwiftKey == "" && e.SwiftVaultMaterial != "" {
+		resolve("swift_user", "vault://"+e.SwiftVaultMaterial+"#user", &e.SwiftUser)
+		resolve("swift_key", "vault://"+e.SwiftVaultMaterial+"#key", &e.SwiftKey)
+	} else {
+		if providers.IsRef(e.SwiftUser) {
+			resolve("swift_user", e.SwiftUser, &e.SwiftUser)
+		}
+		if providers.IsRef(e.SwiftKey) {
+			resolve("swift_key", e.SwiftKey, &e.SwiftKey)
+		}
+	}
+
+	// Env is copied so that the values of a shared map aren't replaced
+	if len(e.Env) > 0 {
+		e.Env = maps.Clone(e.Env)
+		names := make([]string, 0, len(e.Env))
+		for name := range e.Env {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for _, name := range names {
+			if v := e.Env[name]; providers.IsRef(v) {
+				resolve("env."+name, v, &v)
+				e.Env[name] = v
+			}
+		}
+	}
+
+	if e.AWSCredentialsFile != "" {
+		res := SecretResolution{Name: "aws_credentials_file", Source: "file", Ref: e.AWSCredentialsFile}
+		e.AWSAccessKeyID, e.AWSSecretAccessKey, res.Err = ReadAWSCredentials(e.AWSCredentialsFile, e.AWSProfile)
+		out = append(out, res)
+	} else {
+		if providers.IsRef(e.AWSAccessKeyID) {
+			resolve("aws_access_key_id", e.AWSAccessKeyID, &e.AWSAccessKeyID)
+		}
+		if providers.IsRef(e.AWSSecretAccessKey) {
+			resolve("aws_secret_access_key", e.AWSSecretAccessKey, &e.AWSSecretAccessKey)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/restic/restic/reporter/pkg/snapshots"
+)
+
+const (
+	// LabelDrop removes the value of a label, merging backup sets that
+	// only differ by it
+	LabelDrop = "drop"
+
+	// LabelHash replaces the value of a label with a short hash so that
+	// sets can still be told apart without exposing the value
+	LabelHash = "hash"
+)
+
+// hashLength is the number of hex characters of hashed label values
+const hashLength = 12
+
+// validateLabelPolicy checks that the policy only names backup set
+// labels and known actions
+func validateLabelPolicy(policy map[string]string) error {
+	for label, action := range policy {
+		switch label {
+		case "host", "user", "tags", "paths":
+		default:
+			return fmt.Errorf("label_policy label %q must be host, user, tags or paths", label)
+		}
+		if action != LabelDrop && action != LabelHash {
+			return fmt.Errorf("label_policy action %q for %s must be %s or %s", action, label, LabelDrop, LabelHash)
+		}
+	}
+	return nil
+}
+
+func applyLabelAction(action, v string) string {
+	switch action {
+	case LabelDrop:
+		return ""
+	case LabelHash:
+		if v == "" {
+			return v
+		}
+		sum := sha256.Sum256([]byte(v))
+		return hex.EncodeToString(sum[:])[:hashLength]
+	default:
+		return v
+	}
+}
+
+// HostLabel returns the host label of a host after the LabelPolicy of
+// the repo is applied
+func (e *Entry) HostLabel(host string) string {
+	return applyLabelAction(e.LabelPolicy["host"], host)
+}
+
+// ApplyLabelPolicy drops or hashes the labels of the backup sets of the
+// repo according to its LabelPolicy. The collection is returned
+// unchanged if there is no policy.
+func (e *Entry) ApplyLabelPolicy(col snapshots.Collection) snapshots.Collection {
+	if len(e.LabelPolicy) == 0 {
+		return col
+	}
+
+	return col.Relabel(func(set *snapshots.Info) {
+		set.Host = applyLabelAction(e.LabelPolicy["host"], set.Host)
+		set.Username = applyLabelAction(e.LabelPolicy["user"], set.Username)
+		set.Tags = applyLabelAction(e.LabelPolicy["tags"], set.Tags)
+		set.Paths = applyLabelAction(e.LabelPolicy["paths"], set.Paths)
+	})
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"code.crute.us/mcrute/golib/secrets"
+)
+
+// SecretProvider resolves references to secrets stored outside of the
+// configuration file. The reference is everything after the scheme, so
+// for file:///etc/restic/password it's /etc/restic/password.
+type SecretProvider interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// SecretProviders maps reference schemes to the provider that resolves
+// them. Additional providers can be added to the map before it's used.
+type SecretProviders map[string]SecretProvider
+
+// NewSecretProviders creates the built in providers, which are vault,
+// file, and env. sc may be nil if Vault is disabled in which case
+// resolving Vault references fails with ErrVaultDisabled.
+func NewSecretProviders(sc secrets.Client) SecretProviders {
+	return SecretProviders{
+		"vault": VaultSecretProvider{Client: sc},
+		"file":  FileSecretProvider{},
+		"env":   EnvSecretProvider{},
+	}
+}
+
+// parse splits a secret reference into the provider for its scheme and
+// the reference itself. ok is false if v isn't a reference for one of
+// the providers.
+func (p SecretProviders) parse(v string) (scheme, ref string, ok bool) {
+	scheme, ref, ok = strings.Cut(v, "://")
+	if !ok || p[scheme] == nil {
+		return "", "", false
+	}
+	return scheme, ref, true
+}
+
+// IsRef indicates if v is a reference to a secret rather than a secret
+// value
+func (p SecretProviders) IsRef(v string) bool {
+	_, _, ok := p.parse(v)
+	return ok
+}
+
+// Resolve returns the value of the secret referenced by v
+func (p SecretProviders) Resolve(ctx context.Context, v string) (string, error) {
+	scheme, ref, ok := p.parse(v)
+	if !ok {
+		return "", fmt.Errorf("No secret provider for %q", v)
+	}
+	return p[scheme].Resolve(ctx, ref)
+}
+
+// VaultSecretProvider resolves references to a path in the Vault KV
+// store. By default the key field of the secret is used, another field
+// can be selected with a fragment like vault://service/backups/b2#id.
+type VaultSecretProvider struct {
+	Client secrets.Client
+}
+
+func (p VaultSecretProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	if p.Client == nil {
+		return "", ErrVaultDisabled
+	}
+
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok {
+		field = "key"
+	}
+
+	var secret map[string]any
+	if _, err := p.Client.Secret(ctx, path, &secret); err != nil {
+		return "", err
+	}
+
+	v, ok := secret[field].(string)
+	if !ok {
+		return "", fmt.Errorf("Vault secret %q has no field %q", path, field)
+	}
+	return v, nil
+}
+
+// FileSecretProvider resolves references to a file containing only the
+// secret. Trailing newlines are removed.
+type FileSecretProvider struct{}
+
+func (FileSecretProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// EnvSecretProvider resolves references to an environment variable
+type EnvSecretProvider struct{}
+
+func (EnvSecretProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	v, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("Environment variable %q is not set", ref)
+	}
+	return v, nil
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the multipliers of the size suffixes accepted by
+// ParseSize, longest first so that KiB matches before B
+var sizeUnits = []struct {
+	suffix string
+	bytes  float64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40}, {"PiB", 1 << 50},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12}, {"PB", 1e15},
+	{"B", 1},
+}
+
+// ParseSize parses a size in bytes with an optional decimal (KB, MB, GB,
+// TB, PB) or binary (KiB, MiB, GiB, TiB, PiB) suffix, such as 500GB or
+// 1.5TiB
+func ParseSize(s string) (int64, error) {
+	num, mult := strings.TrimSpace(s), 1.0
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(num, u.suffix) {
+			num, mult = strings.TrimSpace(strings.TrimSuffix(num, u.suffix)), u.bytes
+			break
+		}
+	}
+
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("Invalid size %q", s)
+	}
+	return int64(v * mult), nil
+}
@@ -0,0 +1,149 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/b2api"
+	"github.com/restic/restic/reporter/pkg/config"
+	"go.uber.org/zap"
+)
+
+// b2ConfigObject is the object that every restic repo has at its root
+const b2ConfigObject = "config"
+
+// B2 discovers the repos in a B2 bucket. Every directory directly under
+// a prefix that contains a restic config object is a repo, for setups
+// where each host has its own repo in a shared bucket.
+type B2 struct {
+	bucket    string
+	prefix    string
+	accountID string
+	key       string
+	password  PasswordTemplate
+	providers config.SecretProviders
+	client    *http.Client
+	logger    *zap.Logger
+}
+
+// NewB2 creates a discovery for location, which is bucket or
+// bucket:prefix. The account ID and key may be secret references, they
+// are resolved on every sync.
+func NewB2(logger *zap.Logger, location, accountID, key string, password PasswordTemplate, providers config.SecretProviders) (*B2, error) {
+	bucket, prefix, _ := strings.Cut(location, ":")
+	if bucket == "" {
+		return nil, fmt.Errorf("Invalid B2 location %q, must be bucket or bucket:prefix", location)
+	}
+	if accountID == "" || key == "" {
+		return nil, fmt.Errorf("B2 discovery requires an account ID and key")
+	}
+
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &B2{
+		bucket:    bucket,
+		prefix:    prefix,
+		accountID: accountID,
+		key:       key,
+		password:  password,
+		providers: providers,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		logger:    logger,
+	}, nil
+}
+
+// Sync returns the configuration for the repos in the bucket. Repos that
+// are invalid, such as those with a password that can't be resolved,
+// are logged and skipped.
+func (b *B2) Sync(ctx context.Context) (config.File, error) {
+	accountID, err := b.resolve(ctx, b.accountID)
+	if err != nil {
+		return nil, fmt.Errorf("Error resolving B2 account ID: %w", err)
+	}
+	key, err := b.resolve(ctx, b.key)
+	if err != nil {
+		return nil, fmt.Errorf("Error resolving B2 key: %w", err)
+	}
+
+	s, err := b2api.Authorize(ctx, b.client, accountID, key)
+	if err != nil {
+		return nil, fmt.Errorf("Error authorizing B2 account: %w", err)
+	}
+
+	names, err := b.list(ctx, s)
+	if err != nil {
+		return nil, fmt.Errorf("Error listing B2 bucket %s: %w", b.bucket, err)
+	}
+
+	var cfg config.File
+	for _, name := range names {
+		repo := "b2:" + b.bucket + ":" + b.prefix + name
+		e, err := newEntry(ctx, b.providers, &config.Entry{
+			Repo:        repo,
+			Password:    b.password.Expand(name),
+			B2AccountId: accountID,
+			B2Key:       key,
+		})
+		if err != nil {
+			b.logger.Error("Skipping invalid discovered repo", zap.String("repo", repo), zap.Error(err))
+			continue
+		}
+		cfg = append(cfg, e)
+	}
+	return cfg, nil
+}
+
+func (b *B2) resolve(ctx context.Context, v string) (string, error) {
+	if b.providers.IsRef(v) {
+		return b.providers.Resolve(ctx, v)
+	}
+	return v, nil
+}
+
+// list returns the names of the directories under the prefix that
+// contain a config object
+func (b *B2) list(ctx context.Context, s *b2api.Session) ([]string, error) {
+	bucketID, err := s.BucketID(ctx, b.bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	start := ""
+	for {
+		files, next, err := s.ListFileNames(ctx, bucketID, b.prefix, "/", start, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if f.Action == "folder" {
+				dirs = append(dirs, f.FileName)
+			}
+		}
+		if next == "" {
+			break
+		}
+		start = next
+	}
+
+	var names []string
+	for _, dir := range dirs {
+		obj := dir + b2ConfigObject
+		files, _, err := s.ListFileNames(ctx, bucketID, obj, "", obj, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 || files[0].FileName != obj {
+			b.logger.Debug("Directory is not a restic repo", zap.String("bucket", b.bucket), zap.String("directory", dir))
+			continue
+		}
+		names = append(names, strings.TrimSuffix(strings.TrimPrefix(dir, b.prefix), "/"))
+	}
+	return names, nil
+}
@@ -0,0 +1,42 @@
+// Package discovery finds the repos hosted by a backend so that new
+// repos are collected without editing the configuration file. Every
+// source returns the configuration of the repos it found with their
+// secrets resolved, like config.Load.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/restic/restic/reporter/pkg/config"
+)
+
+// NamePlaceholder is replaced in a PasswordTemplate with the name of
+// the discovered repo, which is its path relative to the root that was
+// searched
+const NamePlaceholder = "{name}"
+
+// PasswordTemplate is the password of discovered repos. It's either a
+// password shared by all repos or a secret reference, such as
+// file:///etc/restic/{name}.password, which may contain NamePlaceholder
+// to give each repo its own password.
+type PasswordTemplate string
+
+// Expand returns the password or secret reference for a repo
+func (t PasswordTemplate) Expand(name string) string {
+	return strings.ReplaceAll(string(t), NamePlaceholder, name)
+}
+
+// newEntry builds the configuration of a discovered repo and resolves
+// its secrets. Vault references are left unresolved if Vault is
+// disabled, as they are by config.Load.
+func newEntry(ctx context.Context, providers config.SecretProviders, e *config.Entry) (*config.Entry, error) {
+	for _, res := range e.ResolveSecrets(ctx, providers) {
+		if res.Err != nil && !errors.Is(res.Err, config.ErrVaultDisabled) {
+			return nil, fmt.Errorf("Error resolving %s: %w", res.Name, res.Err)
+		}
+	}
+	return e, e.Validate()
+}
@@ -0,0 +1,221 @@
+// Package kube is a minimal client for the Kubernetes API using the
+// in-cluster service account. It only supports the few JSON requests
+// the exporter needs so that it doesn't depend on client-go.
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir is where Kubernetes mounts the credentials of the
+// pod's service account
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// MergePatch is the content type of JSON merge patches
+const MergePatch = "application/merge-patch+json"
+
+// StatusError is returned for responses that aren't successful
+type StatusError struct {
+	Method string
+	Path   string
+	Code   int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s returned status %d", e.Method, e.Path, e.Code)
+}
+
+// IsStatus returns true if err is a StatusError with the status code
+func IsStatus(err error, code int) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == code
+}
+
+// Client makes requests to the API server
+type Client struct {
+	host      string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+// InCluster creates a client using the service account of the pod that
+// the exporter is running in
+func InCluster() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("Not running in a Kubernetes cluster")
+	}
+
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("Error reading service account token: %w", err)
+	}
+
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("Error reading service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("No certificates in service account CA")
+	}
+
+	namespace, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return nil, fmt.Errorf("Error reading pod namespace: %w", err)
+	}
+
+	return &Client{
+		host:      "https://" + net.JoinHostPort(host, port),
+		token:     strings.TrimSpace(string(token)),
+		namespace: strings.TrimSpace(string(namespace)),
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// Namespace returns the namespace of the pod
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// Do makes a request to path, which starts with /api or /apis. If in
+// isn't nil it's sent as JSON, or as contentType if set. A successful
+// response is decoded into out if it isn't nil. Responses that aren't
+// successful return a *StatusError.
+func (c *Client) Do(ctx context.Context, method, path, contentType string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.host+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &StatusError{Method: method, Path: path, Code: res.StatusCode}
+	}
+	if out != nil {
+		return json.NewDecoder(res.Body).Decode(out)
+	}
+	return nil
+}
+
+// ObjectMeta is the subset of object metadata used by the exporter
+type ObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+}
+
+// Secret is a core/v1 Secret, the values of Data are decoded
+type Secret struct {
+	Metadata ObjectMeta        `json:"metadata"`
+	Data     map[string][]byte `json:"data"`
+}
+
+// GetSecret returns a secret
+func (c *Client) GetSecret(ctx context.Context, namespace, name string) (*Secret, error) {
+	var s Secret
+	path := fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", namespace, name)
+	if err := c.Do(ctx, http.MethodGet, path, "", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SecretValue returns a key of a secret, it's an error if the key
+// doesn't exist
+func (c *Client) SecretValue(ctx context.Context, namespace, name, key string) (string, error) {
+	s, err := c.GetSecret(ctx, namespace, name)
+	if err != nil {
+		return "", err
+	}
+	v, ok := s.Data[key]
+	if !ok {
+		return "", fmt.Errorf("Secret %s/%s has no key %s", namespace, name, key)
+	}
+	return string(v), nil
+}
+
+// listPath is the path for listing a resource in a namespace, or in all
+// namespaces if namespace is empty, filtered by a label selector
+func listPath(prefix, namespace, resource, selector string) string {
+	p := prefix
+	if namespace != "" {
+		p += "/namespaces/" + namespace
+	}
+	p += "/" + resource
+	if selector != "" {
+		p += "?labelSelector=" + url.QueryEscape(selector)
+	}
+	return p
+}
+
+// ListSecrets returns the secrets in a namespace, or all namespaces if
+// namespace is empty, that match a label selector
+func (c *Client) ListSecrets(ctx context.Context, namespace, selector string) ([]Secret, error) {
+	var list struct {
+		Items []Secret `json:"items"`
+	}
+	if err := c.Do(ctx, http.MethodGet, listPath("/api/v1", namespace, "secrets", selector), "", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// Pod is a core/v1 Pod, only its metadata is used
+type Pod struct {
+	Metadata ObjectMeta `json:"metadata"`
+}
+
+// ListPods returns the pods in a namespace, or all namespaces if
+// namespace is empty, that match a label selector
+func (c *Client) ListPods(ctx context.Context, namespace, selector string) ([]Pod, error) {
+	var list struct {
+		Items []Pod `json:"items"`
+	}
+	if err := c.Do(ctx, http.MethodGet, listPath("/api/v1", namespace, "pods", selector), "", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
@@ -0,0 +1,111 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FileLock is a lock file on storage shared by all replicas, such as
+// NFS. The leader holds an exclusive flock on the file for as long as it
+// leads. The kernel, or the NFS server for files on NFS, grants it to a
+// single replica and drops it when the process exits, so the lease
+// duration only decides how often standbys try to take it. NFS shares
+// locks between hosts with version 4, or with the lock daemon with
+// version 3. The file is never removed since a replica that locked a
+// removed file would lead alongside one that locked its replacement.
+type FileLock struct {
+	Path string
+
+	mu sync.Mutex
+	fd *os.File // open while the lock is held
+}
+
+var _ Lock = (*FileLock)(nil)
+
+// fileLockState is written to the lock file by the leader so that the
+// leader can be found, it isn't used for locking
+type fileLockState struct {
+	Holder string    `json:"holder"`
+	Since  time.Time `json:"since"`
+}
+
+func (l *FileLock) Acquire(ctx context.Context, identity string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// The lock is held until it's released, unless the file was removed
+	// or replaced, in which case another replica may have locked the new
+	// one
+	if l.fd != nil {
+		if held, err := l.stillHeld(); held || err != nil {
+			return held, err
+		}
+		l.unlock()
+	}
+
+	fd, err := os.OpenFile(l.Path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return false, err
+	}
+	if err := syscall.Flock(int(fd.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		fd.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return false, nil
+		}
+		return false, err
+	}
+	l.fd = fd
+
+	data, err := json.Marshal(fileLockState{Holder: identity, Since: time.Now()})
+	if err == nil {
+		if err = fd.Truncate(0); err == nil {
+			_, err = fd.WriteAt(data, 0)
+		}
+	}
+	if err != nil {
+		l.unlock()
+		return false, err
+	}
+	return true, nil
+}
+
+// stillHeld returns whether the locked file is still the file at Path
+func (l *FileLock) stillHeld() (bool, error) {
+	held, err := l.fd.Stat()
+	if err != nil {
+		return false, err
+	}
+	current, err := os.Stat(l.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return os.SameFile(held, current), nil
+}
+
+// unlock releases the flock by closing the file
+func (l *FileLock) unlock() {
+	l.fd.Close()
+	l.fd = nil
+}
+
+func (l *FileLock) Release(ctx context.Context, identity string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.fd == nil {
+		return nil
+	}
+	if err := l.fd.Truncate(0); err != nil {
+		l.unlock()
+		return err
+	}
+	l.unlock()
+	return nil
+}
@@ -0,0 +1,160 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/kube"
+)
+
+// leaseTimeFormat is the MicroTime format used by the Lease API
+const leaseTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// KubernetesLease is a coordination.k8s.io/v1 Lease. It uses the
+// in-cluster service account which needs get, create and update on
+// leases in the namespace. Updates use the resource version of the
+// lease so concurrent updates from replicas are rejected by the API
+// server.
+type KubernetesLease struct {
+	Namespace string
+	Name      string
+
+	client *kube.Client
+}
+
+var _ Lock = (*KubernetesLease)(nil)
+
+// NewKubernetesLease creates a lease using the in-cluster configuration.
+// If namespace is empty the namespace of the pod is used.
+func NewKubernetesLease(namespace, name string) (*KubernetesLease, error) {
+	if name == "" {
+		return nil, errors.New("Lease name is required")
+	}
+
+	client, err := kube.InCluster()
+	if err != nil {
+		return nil, err
+	}
+
+	if namespace == "" {
+		namespace = client.Namespace()
+	}
+
+	return &KubernetesLease{
+		Namespace: namespace,
+		Name:      name,
+		client:    client,
+	}, nil
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+type lease struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Metadata   kube.ObjectMeta `json:"metadata"`
+	Spec       leaseSpec       `json:"spec"`
+}
+
+// expired returns true if the lease isn't held or the holder has not
+// renewed it within the lease duration
+func (l *lease) expired(now time.Time) bool {
+	if l.Spec.HolderIdentity == "" {
+		return true
+	}
+	renewed, err := time.Parse(leaseTimeFormat, l.Spec.RenewTime)
+	if err != nil {
+		return true
+	}
+	return now.After(renewed.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+func (k *KubernetesLease) path(withName bool) string {
+	p := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", k.Namespace)
+	if withName {
+		p += "/" + k.Name
+	}
+	return p
+}
+
+func (k *KubernetesLease) Acquire(ctx context.Context, identity string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	seconds := int((ttl + time.Second - 1) / time.Second)
+
+	var current lease
+	err := k.client.Do(ctx, http.MethodGet, k.path(true), "", nil, &current)
+	if kube.IsStatus(err, http.StatusNotFound) {
+		created := &lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   kube.ObjectMeta{Name: k.Name, Namespace: k.Namespace},
+			Spec: leaseSpec{
+				HolderIdentity:       identity,
+				LeaseDurationSeconds: seconds,
+				AcquireTime:          now.Format(leaseTimeFormat),
+				RenewTime:            now.Format(leaseTimeFormat),
+			},
+		}
+		err := k.client.Do(ctx, http.MethodPost, k.path(false), "", created, nil)
+		// Conflict means another replica created it first
+		if kube.IsStatus(err, http.StatusConflict) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if current.Spec.HolderIdentity != identity {
+		if !current.expired(now) {
+			return false, nil
+		}
+		current.Spec.AcquireTime = now.Format(leaseTimeFormat)
+		current.Spec.LeaseTransitions++
+	}
+	current.Spec.HolderIdentity = identity
+	current.Spec.LeaseDurationSeconds = seconds
+	current.Spec.RenewTime = now.Format(leaseTimeFormat)
+
+	return k.update(ctx, &current)
+}
+
+// update replaces the lease, returning false if it was modified since it
+// was read
+func (k *KubernetesLease) update(ctx context.Context, l *lease) (bool, error) {
+	err := k.client.Do(ctx, http.MethodPut, k.path(true), "", l, nil)
+	if kube.IsStatus(err, http.StatusConflict) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (k *KubernetesLease) Release(ctx context.Context, identity string) error {
+	var current lease
+	err := k.client.Do(ctx, http.MethodGet, k.path(true), "", nil, &current)
+	if kube.IsStatus(err, http.StatusNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if current.Spec.HolderIdentity != identity {
+		return nil
+	}
+
+	current.Spec.HolderIdentity = ""
+	_, err = k.update(ctx, &current)
+	return err
+}
@@ -0,0 +1,147 @@
+// Package leader elects a single leader among exporter replicas so that
+// only one of them collects repos. Leadership is a lock with a time to
+// live that the leader renews, if the leader stops renewing it another
+// replica takes over once it expires.
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Lock is a lock with a time to live shared by all replicas
+type Lock interface {
+	// Acquire takes or renews the lock for identity until ttl from now.
+	// It returns false without an error if another identity holds an
+	// unexpired lock.
+	Acquire(ctx context.Context, identity string, ttl time.Duration) (bool, error)
+
+	// Release gives up the lock if it's held by identity
+	Release(ctx context.Context, identity string) error
+}
+
+// ParseLock parses a lock URI which is either file:<path> for a lock
+// file on shared storage or kubernetes:[<namespace>/]<name> for a
+// Kubernetes Lease in the cluster the exporter is running in. The
+// namespace defaults to that of the pod.
+func ParseLock(uri string) (Lock, error) {
+	kind, rest, ok := strings.Cut(uri, ":")
+	if !ok || rest == "" {
+		return nil, fmt.Errorf("Invalid lock %q, must be type:location", uri)
+	}
+
+	switch kind {
+	case "file":
+		return &FileLock{Path: rest}, nil
+	case "kubernetes":
+		namespace, name, ok := strings.Cut(rest, "/")
+		if !ok {
+			namespace, name = "", rest
+		}
+		return NewKubernetesLease(namespace, name)
+	default:
+		return nil, fmt.Errorf("Unknown lock type %q", kind)
+	}
+}
+
+// Elector campaigns for leadership for as long as it runs
+type Elector struct {
+	lock     Lock
+	identity string
+	ttl      time.Duration
+	logger   *zap.Logger
+
+	leader   atomic.Bool
+	mu       sync.Mutex
+	onChange []func(leader bool)
+}
+
+// NewElector creates an elector for identity, which must be unique
+// among replicas. The lock is renewed every third of ttl.
+func NewElector(logger *zap.Logger, lock Lock, identity string, ttl time.Duration) (*Elector, error) {
+	if identity == "" {
+		return nil, errors.New("Leader election requires an identity")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("Leader election requires a positive lease duration")
+	}
+	return &Elector{
+		lock:     lock,
+		identity: identity,
+		ttl:      ttl,
+		logger:   logger.With(zap.String("identity", identity)),
+	}, nil
+}
+
+// IsLeader returns true if this replica currently holds the lock
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// OnChange registers a function to be called whenever leadership is
+// gained or lost. This must not be called once the elector is running.
+func (e *Elector) OnChange(fn func(leader bool)) {
+	e.onChange = append(e.onChange, fn)
+}
+
+// Step makes a single attempt to take or renew the lock. Leadership is
+// given up if the lock can't be renewed, even if that was caused by an
+// error, since another replica may take over once it expires.
+func (e *Elector) Step(ctx context.Context) {
+	ok, err := e.lock.Acquire(ctx, e.identity, e.ttl)
+	if err != nil {
+		e.logger.Error("Error acquiring leader lock", zap.Error(err))
+	}
+	e.set(ok && err == nil)
+}
+
+func (e *Elector) set(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.leader.Swap(leader) == leader {
+		return
+	}
+
+	if leader {
+		e.logger.Info("Became leader, collecting repos")
+	} else {
+		e.logger.Info("Lost leadership, serving persisted metrics as standby")
+	}
+
+	for _, fn := range e.onChange {
+		fn(leader)
+	}
+}
+
+// Run campaigns until ctx is done and then releases the lock if it's
+// held so that a standby can take over immediately
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.Step(ctx)
+		case <-ctx.Done():
+			if e.IsLeader() {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+
+				if err := e.lock.Release(releaseCtx, e.identity); err != nil {
+					e.logger.Error("Error releasing leader lock", zap.Error(err))
+				}
+				e.set(false)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// Package logctx carries a logger in a context so that every log line
+// for a collection, down to the restic backend, has the fields of the
+// collection (such as run_id and repo) without passing a logger through
+// every function.
+package logctx
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type contextKey struct{}
+
+// With returns a copy of ctx carrying logger
+func With(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// From returns the logger carried by ctx or the global zap logger if
+// there isn't one
+func From(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return zap.L()
+}
+
+// WithFields returns a copy of ctx carrying its logger with fields added
+// and that logger
+func WithFields(ctx context.Context, fields ...zap.Field) (context.Context, *zap.Logger) {
+	logger := From(ctx).With(fields...)
+	return With(ctx, logger), logger
+}
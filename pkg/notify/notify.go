@@ -0,0 +1,202 @@
+// Package notify sends notifications about collection runs to chat and
+// push notification services. Each service is a Notifier and the
+// Dispatcher turns the results of collection runs into events and
+// sends them to every notifier, so adding a service doesn't require any
+// changes to the collector.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/collector"
+	"go.uber.org/zap"
+)
+
+// EventType identifies what happened
+type EventType string
+
+const (
+	// RunCompleted is sent once at the end of every collection run
+	RunCompleted EventType = "run_completed"
+	// RepoCollected is sent for every repo that collected successfully
+	RepoCollected EventType = "repo_collected"
+	// RepoFailed is sent for every repo that failed to collect
+	RepoFailed EventType = "repo_failed"
+)
+
+// DefaultEvents are the events sent if no others are configured, which
+// are those that need attention
+var DefaultEvents = []EventType{RunCompleted, RepoFailed}
+
+// ParseEventType parses the name of an event type
+func ParseEventType(v string) (EventType, error) {
+	switch t := EventType(v); t {
+	case RunCompleted, RepoCollected, RepoFailed:
+		return t, nil
+	default:
+		return "", fmt.Errorf("Unknown notification event %q", v)
+	}
+}
+
+// Event is a single notification. Repo and Sets are only set for repo
+// events and Repos and Errors only for run events.
+type Event struct {
+	Type   EventType `json:"type"`
+	Time   time.Time `json:"time"`
+	Repo   string    `json:"repo,omitempty"`
+	Sets   int       `json:"sets,omitempty"`
+	Repos  int       `json:"repos,omitempty"`
+	Errors int       `json:"errors,omitempty"`
+}
+
+// Failed indicates if the event reports a problem
+func (e Event) Failed() bool {
+	return e.Type == RepoFailed || e.Errors > 0
+}
+
+// Title is a short summary of the event
+func (e Event) Title() string {
+	switch {
+	case e.Type == RepoFailed:
+		return "Backup repo failed to collect"
+	case e.Type == RepoCollected:
+		return "Backup repo collected"
+	case e.Failed():
+		return "Backup collection completed with errors"
+	default:
+		return "Backup collection completed"
+	}
+}
+
+// Message describes the event for people
+func (e Event) Message() string {
+	switch e.Type {
+	case RepoFailed:
+		return fmt.Sprintf("Failed to collect %s", e.Repo)
+	case RepoCollected:
+		return fmt.Sprintf("Collected %d backup sets from %s", e.Sets, e.Repo)
+	default:
+		return fmt.Sprintf("Collected %d repos, %d failed", e.Repos, e.Errors)
+	}
+}
+
+// Events converts the results of a collection run into an event for
+// each repo followed by an event for the run
+func Events(metrics *collector.AllRepoMetrics) []Event {
+	out := make([]Event, 0, len(metrics.Stats)+1)
+
+	for _, stats := range metrics.Stats {
+		ev := Event{Type: RepoCollected, Time: metrics.Time, Repo: stats.RepoLabel(), Sets: len(stats.Stats)}
+		if stats.ReadErrors > 0 {
+			ev = Event{Type: RepoFailed, Time: metrics.Time, Repo: stats.RepoLabel()}
+		}
+		out = append(out, ev)
+	}
+
+	return append(out, Event{
+		Type:   RunCompleted,
+		Time:   metrics.Time,
+		Repos:  len(metrics.Stats),
+		Errors: metrics.Errors,
+	})
+}
+
+// Notifier sends events to a notification service
+type Notifier interface {
+	Notify(ctx context.Context, ev Event) error
+}
+
+// New creates a notifier from a URI in the form type:url, for example
+// slack:https://hooks.slack.com/services/... The supported types are
+// webhook, slack, and ntfy.
+func New(uri string) (Notifier, error) {
+	kind, target, ok := strings.Cut(uri, ":")
+	if !ok || !strings.HasPrefix(target, "http") {
+		return nil, fmt.Errorf("Invalid notifier %q, must be type:url", uri)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	switch kind {
+	case "webhook":
+		return &Webhook{URL: target, Client: client}, nil
+	case "slack":
+		return &Slack{URL: target, Client: client}, nil
+	case "ntfy":
+		return &Ntfy{URL: target, Client: client}, nil
+	default:
+		return nil, fmt.Errorf("Unknown notifier type %q", kind)
+	}
+}
+
+// Dispatcher sends the events for every collection run to a set of
+// notifiers
+type Dispatcher struct {
+	notifiers []Notifier
+	events    map[EventType]bool
+	logger    *zap.Logger
+}
+
+// NewDispatcher creates a dispatcher that only sends events of the
+// given types
+func NewDispatcher(logger *zap.Logger, events []EventType) *Dispatcher {
+	d := &Dispatcher{
+		events: map[EventType]bool{},
+		logger: logger,
+	}
+	for _, t := range events {
+		d.events[t] = true
+	}
+	return d
+}
+
+// Add adds a notifier. This must not be called once collections have
+// started.
+func (d *Dispatcher) Add(n Notifier) {
+	d.notifiers = append(d.notifiers, n)
+}
+
+// Collected sends the events for a collection run to every notifier. It
+// has the signature of collector.ResticCollector.OnCollected. Errors
+// are logged and don't stop other events from being sent.
+func (d *Dispatcher) Collected(ctx context.Context, metrics *collector.AllRepoMetrics) {
+	for _, ev := range Events(metrics) {
+		if !d.events[ev.Type] {
+			continue
+		}
+		for _, n := range d.notifiers {
+			if err := n.Notify(ctx, ev); err != nil {
+				d.logger.Error("Error sending notification", zap.String("event", string(ev.Type)), zap.Error(err))
+			}
+		}
+	}
+}
+
+// post sends a request to a notification service and checks the
+// response
+func post(ctx context.Context, client *http.Client, url, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("Notification request returned %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+)
+
+// Ntfy publishes each event to an ntfy topic. The URL is the full URL of
+// the topic, such as https://ntfy.sh/my-backups. Credentials in the URL
+// are sent as basic auth by the HTTP client.
+type Ntfy struct {
+	URL    string
+	Client *http.Client
+}
+
+func (n *Ntfy) Notify(ctx context.Context, ev Event) error {
+	headers := map[string]string{
+		"Title":    ev.Title(),
+		"Priority": "default",
+		"Tags":     "white_check_mark",
+	}
+	if ev.Failed() {
+		headers["Priority"] = "high"
+		headers["Tags"] = "rotating_light"
+	}
+	return post(ctx, n.Client, n.URL, "text/plain", []byte(ev.Message()), headers)
+}
@@ -0,0 +1,29 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Slack posts each event as a message to a Slack incoming webhook
+type Slack struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s *Slack) Notify(ctx context.Context, ev Event) error {
+	icon := ":white_check_mark:"
+	if ev.Failed() {
+		icon = ":rotating_light:"
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"text": fmt.Sprintf("%s *%s*\n%s", icon, ev.Title(), ev.Message()),
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.Client, s.URL, "application/json", body, nil)
+}
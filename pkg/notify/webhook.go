@@ -0,0 +1,21 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// Webhook posts each event as a JSON document to a URL
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (w *Webhook) Notify(ctx context.Context, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return post(ctx, w.Client, w.URL, "application/json", body, nil)
+}
@@ -0,0 +1,104 @@
+package operator
+
+// CRD is the CustomResourceDefinition of ResticRepository, which must be
+// applied to the cluster before running the operator
+const CRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: resticrepositories.restic-reporter.io
+spec:
+  group: restic-reporter.io
+  scope: Namespaced
+  names:
+    kind: ResticRepository
+    listKind: ResticRepositoryList
+    plural: resticrepositories
+    singular: resticrepository
+    shortNames: [resticrepo]
+  versions:
+    - name: v1alpha1
+      served: true
+      storage: true
+      subresources:
+        status: {}
+      additionalPrinterColumns:
+        - name: Repo
+          type: string
+          jsonPath: .spec.repo
+        - name: Healthy
+          type: boolean
+          jsonPath: .status.healthy
+        - name: Newest Snapshot
+          type: date
+          jsonPath: .status.newestSnapshot
+        - name: Last Collected
+          type: date
+          jsonPath: .status.lastCollected
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              type: object
+              required: [repo]
+              properties:
+                repo:
+                  type: string
+                  description: Repository URL in restic style
+                disabled:
+                  type: boolean
+                passwordSecretRef:
+                  type: object
+                  required: [name, key]
+                  properties:
+                    name:
+                      type: string
+                    key:
+                      type: string
+                b2AccountIdSecretRef:
+                  type: object
+                  required: [name, key]
+                  properties:
+                    name:
+                      type: string
+                    key:
+                      type: string
+                b2KeySecretRef:
+                  type: object
+                  required: [name, key]
+                  properties:
+                    name:
+                      type: string
+                    key:
+                      type: string
+                schedule:
+                  type: string
+                  description: Cron expression, @every <duration> or @manual
+                thresholds:
+                  type: object
+                  properties:
+                    maxAgeDays:
+                      type: integer
+                      minimum: 0
+            status:
+              type: object
+              properties:
+                lastCollected:
+                  type: string
+                  format: date-time
+                healthy:
+                  type: boolean
+                message:
+                  type: string
+                errorClass:
+                  type: string
+                backupSets:
+                  type: integer
+                snapshotCount:
+                  type: integer
+                newestSnapshot:
+                  type: string
+                  format: date-time
+                maxAgeDays:
+                  type: integer
+`
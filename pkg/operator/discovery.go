@@ -0,0 +1,176 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/kube"
+	"go.uber.org/zap"
+)
+
+const (
+	// DiscoverLabel must be set to "true" on Secrets and Pods that
+	// declare a repo
+	DiscoverLabel = "restic-reporter.io/discover"
+
+	// Annotations on Secrets and Pods that declare a repo
+	RepoAnnotation           = "restic-reporter.io/repo"
+	PasswordKeyAnnotation    = "restic-reporter.io/password-key"
+	PasswordSecretAnnotation = "restic-reporter.io/password-secret"
+	ScheduleAnnotation       = "restic-reporter.io/schedule"
+	DisabledAnnotation       = "restic-reporter.io/disabled"
+
+	defaultPasswordKey = "password"
+)
+
+// Discovery finds repos declared with annotations on Secrets or Pods
+// labeled with DiscoverLabel. A Secret declares a repo whose password
+// is in the Secret itself. A Pod declares a repo whose password is in
+// the Secret named by PasswordSecretAnnotation in the Pod's namespace.
+// B2 credentials are read from the b2_account_id and b2_key keys of the
+// Secret if present.
+type Discovery struct {
+	client     *kube.Client
+	namespaces []string
+	secrets    bool
+	pods       bool
+	logger     *zap.Logger
+}
+
+// NewDiscovery creates a discovery of the given kinds, which are secrets
+// and pods, in namespaces or in every namespace if none are given
+func NewDiscovery(logger *zap.Logger, client *kube.Client, namespaces, kinds []string) (*Discovery, error) {
+	d := &Discovery{
+		client:     client,
+		namespaces: namespaces,
+		logger:     logger,
+	}
+
+	for _, kind := range kinds {
+		switch kind {
+		case "secrets":
+			d.secrets = true
+		case "pods":
+			d.pods = true
+		default:
+			return nil, fmt.Errorf("Unknown discovery kind %q, must be secrets or pods", kind)
+		}
+	}
+
+	return d, nil
+}
+
+// entry builds the configuration of a repo declared by an object with
+// its secrets in secret
+func entry(meta kube.ObjectMeta, secret *kube.Secret) (*config.Entry, error) {
+	e := &config.Entry{
+		Repo:        meta.Annotations[RepoAnnotation],
+		Schedule:    meta.Annotations[ScheduleAnnotation],
+		B2AccountId: string(secret.Data["b2_account_id"]),
+		B2Key:       string(secret.Data["b2_key"]),
+	}
+
+	if v, ok := meta.Annotations[DisabledAnnotation]; ok {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s annotation: %w", DisabledAnnotation, err)
+		}
+		e.Disabled = disabled
+	}
+
+	key := meta.Annotations[PasswordKeyAnnotation]
+	if key == "" {
+		key = defaultPasswordKey
+	}
+	e.Password = string(secret.Data[key])
+
+	return e, e.Validate()
+}
+
+// podSecret returns the secret named by the password secret annotation
+// of a pod, which is name or name:key
+func (d *Discovery) podSecret(ctx context.Context, pod kube.Pod) (*kube.Secret, kube.ObjectMeta, error) {
+	meta := pod.Metadata
+	ref := meta.Annotations[PasswordSecretAnnotation]
+	if ref == "" {
+		return nil, meta, fmt.Errorf("Missing %s annotation", PasswordSecretAnnotation)
+	}
+
+	name, key, ok := strings.Cut(ref, ":")
+	if ok {
+		// Copy the annotations so that the key override doesn't modify
+		// the pod
+		annotations := map[string]string{PasswordKeyAnnotation: key}
+		for k, v := range meta.Annotations {
+			if k != PasswordKeyAnnotation {
+				annotations[k] = v
+			}
+		}
+		meta.Annotations = annotations
+	}
+
+	secret, err := d.client.GetSecret(ctx, meta.Namespace, name)
+	return secret, meta, err
+}
+
+// Sync lists the labeled objects and returns the configuration for the
+// repos they declare. Objects that are invalid are logged and skipped.
+// Several objects may declare the same repo, such as the pods of a
+// deployment, in which case the first is used.
+func (d *Discovery) Sync(ctx context.Context) (config.File, error) {
+	namespaces := d.namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+
+	var cfg config.File
+	seen := map[string]bool{}
+	selector := DiscoverLabel + "=true"
+
+	add := func(kind string, meta kube.ObjectMeta, e *config.Entry, err error) {
+		logger := d.logger.With(zap.String("kind", kind), zap.String("namespace", meta.Namespace), zap.String("name", meta.Name))
+		if err != nil {
+			logger.Error("Skipping invalid discovered repo", zap.Error(err))
+			return
+		}
+		if seen[e.Repo] {
+			logger.Debug("Repo was already discovered", zap.String("repo", config.ScrubRepo(e.Repo)))
+			return
+		}
+		seen[e.Repo] = true
+		cfg = append(cfg, e)
+	}
+
+	for _, ns := range namespaces {
+		if d.secrets {
+			secrets, err := d.client.ListSecrets(ctx, ns, selector)
+			if err != nil {
+				return nil, fmt.Errorf("Error listing secrets: %w", err)
+			}
+			for i := range secrets {
+				e, err := entry(secrets[i].Metadata, &secrets[i])
+				add("Secret", secrets[i].Metadata, e, err)
+			}
+		}
+
+		if d.pods {
+			pods, err := d.client.ListPods(ctx, ns, selector)
+			if err != nil {
+				return nil, fmt.Errorf("Error listing pods: %w", err)
+			}
+			for _, pod := range pods {
+				secret, meta, err := d.podSecret(ctx, pod)
+				var e *config.Entry
+				if err == nil {
+					e, err = entry(meta, secret)
+				}
+				add("Pod", pod.Metadata, e, err)
+			}
+		}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,264 @@
+// Package operator builds the set of repos to collect from a
+// Kubernetes cluster. The Operator uses ResticRepository custom
+// resources and writes the result of collecting each repo back to the
+// status of its resource. Discovery uses annotations on Secrets and
+// Pods.
+package operator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/collector"
+	"github.com/restic/restic/reporter/pkg/config"
+	"github.com/restic/restic/reporter/pkg/kube"
+	"go.uber.org/zap"
+)
+
+const (
+	Group    = "restic-reporter.io"
+	Version  = "v1alpha1"
+	Resource = "resticrepositories"
+)
+
+// SecretKeyRef selects a key of a Secret in the namespace of the
+// resource
+type SecretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// Thresholds decide whether a repo is healthy
+type Thresholds struct {
+	// MaxAgeDays is the maximum age in days of the newest snapshot of
+	// every backup set, zero means any age is healthy
+	MaxAgeDays int `json:"maxAgeDays,omitempty"`
+}
+
+// RepositorySpec is the desired state of a ResticRepository
+type RepositorySpec struct {
+	Repo                 string        `json:"repo"`
+	Disabled             bool          `json:"disabled,omitempty"`
+	PasswordSecretRef    *SecretKeyRef `json:"passwordSecretRef,omitempty"`
+	B2AccountIDSecretRef *SecretKeyRef `json:"b2AccountIdSecretRef,omitempty"`
+	B2KeySecretRef       *SecretKeyRef `json:"b2KeySecretRef,omitempty"`
+	Schedule             string        `json:"schedule,omitempty"`
+	Thresholds           Thresholds    `json:"thresholds,omitempty"`
+}
+
+// RepositoryStatus is the result of the most recent collection of a
+// ResticRepository
+type RepositoryStatus struct {
+	LastCollected  *time.Time `json:"lastCollected,omitempty"`
+	Healthy        bool       `json:"healthy"`
+	Message        string     `json:"message,omitempty"`
+	ErrorClass     string     `json:"errorClass,omitempty"`
+	BackupSets     int        `json:"backupSets"`
+	SnapshotCount  int        `json:"snapshotCount"`
+	NewestSnapshot *time.Time `json:"newestSnapshot,omitempty"`
+	MaxAgeDays     int        `json:"maxAgeDays"`
+}
+
+// Repository is a ResticRepository custom resource
+type Repository struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Metadata   kube.ObjectMeta  `json:"metadata"`
+	Spec       RepositorySpec   `json:"spec"`
+	Status     RepositoryStatus `json:"status,omitempty"`
+}
+
+type repositoryList struct {
+	Items []Repository `json:"items"`
+}
+
+// Operator keeps the configuration of a collector in sync with the
+// ResticRepository resources in a set of namespaces
+type Operator struct {
+	client     *kube.Client
+	namespaces []string
+	logger     *zap.Logger
+
+	mu        sync.Mutex
+	resources map[string]*Repository // keyed by repo URI
+}
+
+// New creates an operator that watches namespaces, or every namespace
+// if none are given
+func New(logger *zap.Logger, client *kube.Client, namespaces []string) *Operator {
+	return &Operator{
+		client:     client,
+		namespaces: namespaces,
+		logger:     logger,
+		resources:  map[string]*Repository{},
+	}
+}
+
+func (o *Operator) path(namespace, name string) string {
+	p := fmt.Sprintf("/apis/%s/%s", Group, Version)
+	if namespace != "" {
+		p += "/namespaces/" + namespace
+	}
+	p += "/" + Resource
+	if name != "" {
+		p += "/" + name
+	}
+	return p
+}
+
+func (o *Operator) list(ctx context.Context) ([]Repository, error) {
+	namespaces := o.namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+
+	var out []Repository
+	for _, ns := range namespaces {
+		var list repositoryList
+		if err := o.client.Do(ctx, http.MethodGet, o.path(ns, ""), "", nil, &list); err != nil {
+			return nil, err
+		}
+		out = append(out, list.Items...)
+	}
+	return out, nil
+}
+
+// secret resolves a secret reference in the namespace of a resource
+func (o *Operator) secret(ctx context.Context, r *Repository, ref *SecretKeyRef) (string, error) {
+	if ref == nil {
+		return "", nil
+	}
+	return o.client.SecretValue(ctx, r.Metadata.Namespace, ref.Name, ref.Key)
+}
+
+// entry builds the configuration of a resource, resolving its secrets
+func (o *Operator) entry(ctx context.Context, r *Repository) (*config.Entry, error) {
+	e := &config.Entry{
+		Repo:     r.Spec.Repo,
+		Disabled: r.Spec.Disabled,
+		Schedule: r.Spec.Schedule,
+	}
+
+	var err error
+	if e.Password, err = o.secret(ctx, r, r.Spec.PasswordSecretRef); err != nil {
+		return nil, fmt.Errorf("Error resolving password: %w", err)
+	}
+	if e.B2AccountId, err = o.secret(ctx, r, r.Spec.B2AccountIDSecretRef); err != nil {
+		return nil, fmt.Errorf("Error resolving B2 account ID: %w", err)
+	}
+	if e.B2Key, err = o.secret(ctx, r, r.Spec.B2KeySecretRef); err != nil {
+		return nil, fmt.Errorf("Error resolving B2 key: %w", err)
+	}
+
+	return e, e.Validate()
+}
+
+// Sync lists the resources and returns the configuration for them.
+// Resources that are invalid or whose secrets can't be resolved are
+// logged, skipped and have their status updated.
+func (o *Operator) Sync(ctx context.Context) (config.File, error) {
+	repos, err := o.list(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Error listing ResticRepositories: %w", err)
+	}
+
+	cfg := make(config.File, 0, len(repos))
+	resources := map[string]*Repository{}
+
+	for i := range repos {
+		r := &repos[i]
+		logger := o.logger.With(zap.String("namespace", r.Metadata.Namespace), zap.String("name", r.Metadata.Name))
+
+		if other, ok := resources[r.Spec.Repo]; ok {
+			err = fmt.Errorf("Repo is also declared by %s/%s", other.Metadata.Namespace, other.Metadata.Name)
+		} else {
+			var entry *config.Entry
+			if entry, err = o.entry(ctx, r); err == nil {
+				cfg = append(cfg, entry)
+				resources[r.Spec.Repo] = r
+				continue
+			}
+		}
+
+		logger.Error("Skipping invalid ResticRepository", zap.Error(err))
+		o.updateStatus(ctx, r, RepositoryStatus{Message: err.Error()})
+	}
+
+	o.mu.Lock()
+	o.resources = resources
+	o.mu.Unlock()
+
+	return cfg, nil
+}
+
+// status computes the status of a resource from the result of its most
+// recent collection
+func status(r *Repository, stats collector.RepoStats, collected time.Time) RepositoryStatus {
+	now := time.Now()
+	s := RepositoryStatus{
+		LastCollected: &collected,
+		ErrorClass:    stats.ErrorClass,
+		BackupSets:    len(stats.Stats),
+	}
+
+	for _, set := range stats.Stats {
+		s.SnapshotCount += set.Count
+		if s.NewestSnapshot == nil || set.Time.After(*s.NewestSnapshot) {
+			t := set.Time
+			s.NewestSnapshot = &t
+		}
+		if age := set.DayAge(now); age > s.MaxAgeDays {
+			s.MaxAgeDays = age
+		}
+	}
+
+	switch max := r.Spec.Thresholds.MaxAgeDays; {
+	case stats.ReadErrors > 0:
+		s.Message = "Error reading repo"
+	case len(stats.Stats) == 0:
+		s.Message = "Repo has no snapshots"
+	case max > 0 && s.MaxAgeDays > max:
+		s.Message = fmt.Sprintf("A backup set is %d days old, more than %d", s.MaxAgeDays, max)
+	default:
+		s.Healthy = true
+	}
+
+	return s
+}
+
+func (o *Operator) updateStatus(ctx context.Context, r *Repository, s RepositoryStatus) {
+	patch := map[string]any{"status": s}
+	if err := o.client.Do(ctx, http.MethodPatch, o.path(r.Metadata.Namespace, r.Metadata.Name)+"/status", kube.MergePatch, patch, nil); err != nil {
+		o.logger.Error("Error updating ResticRepository status",
+			zap.String("namespace", r.Metadata.Namespace),
+			zap.String("name", r.Metadata.Name),
+			zap.Error(err))
+	}
+}
+
+// UpdateStatus writes the results of a collection to the status of the
+// resources, it's meant to be registered with
+// collector.ResticCollector.OnCollected
+func (o *Operator) UpdateStatus(ctx context.Context, metrics *collector.AllRepoMetrics) {
+	o.mu.Lock()
+	resources := o.resources
+	o.mu.Unlock()
+
+	for _, stats := range metrics.Stats {
+		r, ok := resources[stats.Name]
+		if !ok {
+			continue
+		}
+
+		// Results persisted by older versions don't have the time each
+		// repo was collected
+		collected := stats.Time
+		if collected.IsZero() {
+			collected = metrics.Time
+		}
+		o.updateStatus(ctx, r, status(r, stats, collected))
+	}
+}
@@ -0,0 +1,135 @@
+package resticrepo
+
+import (
+	"context"
+	"math"
+	"math/rand"
+
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/reporter/pkg/repoerr"
+)
+
+// CheckResult is the result of checking the structure of a repository
+type CheckResult struct {
+	// Errors are the problems found, which restic check would fail on
+	Errors []error
+
+	// Hints are the number of issues that restic check only reports,
+	// such as packs that no index references after an interrupted
+	// backup, which prune cleans up
+	Hints int
+}
+
+// Check checks the structure of the repository like restic check
+// without --read-data: the index, that the packs in the index exist, and
+// that every tree of every snapshot and the blobs they reference are in
+// the index. The data in the packs isn't read. Unlike restic check this
+// only takes the non-exclusive lock of Open, which is enough to keep
+// prune from changing the repository during the check but allows
+// backups. The returned error is for failing to run the check, problems
+// found by it are in the result.
+func (r *Repo) Check(ctx context.Context) (CheckResult, error) {
+	var res CheckResult
+	chkr := checker.New(r.repo, false)
+
+	hints, errs := chkr.LoadIndex(ctx, nil)
+	if ctx.Err() != nil {
+		return res, ctx.Err()
+	}
+	res.Hints += len(hints)
+	res.Errors = append(res.Errors, errs...)
+	if len(errs) > 0 {
+		// Like restic check, the rest can't be checked with a broken
+		// index
+		return res, nil
+	}
+
+	errChan := make(chan error)
+	go chkr.Packs(ctx, errChan)
+	for err := range errChan {
+		if checker.IsOrphanedPack(err) {
+			res.Hints++
+		} else {
+			res.Errors = append(res.Errors, err)
+		}
+	}
+
+	if err := chkr.LoadSnapshots(ctx); err != nil {
+		return res, repoerr.Classify(err, nil)
+	}
+
+	errChan = make(chan error)
+	go chkr.Structure(ctx, nil, errChan)
+	for err := range errChan {
+		res.Errors = append(res.Errors, err)
+	}
+
+	return res, ctx.Err()
+}
+
+// VerifyResult is the result of reading a subset of the data of a
+// repository
+type VerifyResult struct {
+	// Errors are the packs that couldn't be read or whose contents don't
+	// match their hashes, which restic check would fail on
+	Errors []error
+
+	// Packs and Bytes are the number and size of the packs read
+	Packs int
+	Bytes int64
+}
+
+// Verify reads a random percent of the pack files of the repository and
+// checks the hashes of their contents, like restic check with
+// --read-data-subset percent%. Over several runs this detects bit rot in
+// storage that is otherwise never read. The index is loaded and checked
+// first and the packs aren't read if it has errors. The returned error is
+// for failing to run the verification, problems found by it are in the
+// result.
+func (r *Repo) Verify(ctx context.Context, percent float64) (VerifyResult, error) {
+	var res VerifyResult
+	chkr := checker.New(r.repo, false)
+
+	_, errs := chkr.LoadIndex(ctx, nil)
+	if ctx.Err() != nil {
+		return res, ctx.Err()
+	}
+	res.Errors = append(res.Errors, errs...)
+	if len(errs) > 0 {
+		return res, nil
+	}
+
+	packs := selectPacks(chkr.GetPacks(), percent)
+	for _, size := range packs {
+		res.Packs++
+		res.Bytes += size
+	}
+
+	errChan := make(chan error)
+	go chkr.ReadPacks(ctx, packs, nil, errChan)
+	for err := range errChan {
+		res.Errors = append(res.Errors, err)
+	}
+
+	return res, ctx.Err()
+}
+
+// selectPacks returns a random percent of packs, at least one unless
+// there are none, like restic's --read-data-subset
+func selectPacks(packs map[restic.ID]int64, percent float64) map[restic.ID]int64 {
+	n := int(math.Ceil(float64(len(packs)) * percent / 100))
+	n = min(max(n, 1), len(packs))
+
+	ids := make([]restic.ID, 0, len(packs))
+	for id := range packs {
+		ids = append(ids, id)
+	}
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+
+	out := make(map[restic.ID]int64, n)
+	for _, id := range ids[:n] {
+		out[id] = packs[id]
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+//go:build !restic_0_16
+
+package resticrepo
+
+import (
+	"context"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/retry"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/reporter/pkg/snapshots"
+)
+
+// newRetryBackend wraps a backend so that failed operations are retried
+// for up to 15 minutes
+func newRetryBackend(be backend.Backend, report func(string, error, time.Duration), success func(string, int)) backend.Backend {
+	return retry.New(be, 15*time.Minute, report, success)
+}
+
+// lockRepo takes a non-exclusive read lock on the repository without
+// retrying if the repository is exclusively locked. The returned
+// function releases the lock.
+func lockRepo(ctx context.Context, repo *repository.Repository, printRetry func(string), logf func(string, ...any)) (func(), context.Context, error) {
+	lock, ctx, err := repository.Lock(ctx, repo, false /*exclusive*/, 0 /*no retry*/, printRetry, logf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lock.Unlock, ctx, nil
+}
+
+// listBlobs calls fn for every blob in the loaded index
+func listBlobs(ctx context.Context, repo *repository.Repository, fn func(restic.PackedBlob)) error {
+	return repo.ListBlobs(ctx, fn)
+}
+
+// snapshotSummary returns the summary of a snapshot, which is only
+// recorded by restic 0.17 and later. Nil is returned for older
+// snapshots.
+func snapshotSummary(sn *restic.Snapshot) *snapshots.Summary {
+	if sn.Summary == nil {
+		return nil
+	}
+	return &snapshots.Summary{
+		DataAdded:      int64(sn.Summary.DataAdded),
+		FilesProcessed: int64(sn.Summary.TotalFilesProcessed),
+		BytesProcessed: int64(sn.Summary.TotalBytesProcessed),
+		BackupStart:    sn.Summary.BackupStart,
+		BackupEnd:      sn.Summary.BackupEnd,
+	}
+}
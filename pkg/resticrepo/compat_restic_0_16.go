@@ -0,0 +1,45 @@
+//go:build restic_0_16
+
+package resticrepo
+
+import (
+	"context"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/retry"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/reporter/pkg/snapshots"
+)
+
+// newRetryBackend wraps a backend so that failed operations are retried.
+// Restic 0.16 limits retries by count rather than by time.
+func newRetryBackend(be backend.Backend, report func(string, error, time.Duration), success func(string, int)) backend.Backend {
+	return retry.New(be, 10, report, success)
+}
+
+// lockRepo takes a non-exclusive read lock on the repository. Restic
+// 0.16 has no lock retries or lock refresh context so printRetry and
+// logf are unused and ctx is returned as is.
+func lockRepo(ctx context.Context, repo *repository.Repository, printRetry func(string), logf func(string, ...any)) (func(), context.Context, error) {
+	lock, err := restic.NewLock(ctx, repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	return func() { lock.Unlock() }, ctx, nil
+}
+
+// listBlobs calls fn for every blob in the loaded index. Restic 0.16
+// only exposes the index itself, whose iteration stops without an error
+// when ctx is cancelled.
+func listBlobs(ctx context.Context, repo *repository.Repository, fn func(restic.PackedBlob)) error {
+	repo.Index().Each(ctx, fn)
+	return ctx.Err()
+}
+
+// snapshotSummary always returns nil since restic 0.16 snapshots have
+// no summary
+func snapshotSummary(sn *restic.Snapshot) *snapshots.Summary {
+	return nil
+}
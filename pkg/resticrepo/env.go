@@ -0,0 +1,181 @@
+package resticrepo
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/restic/restic/internal/backend/azure"
+	"github.com/restic/restic/internal/backend/b2"
+	"github.com/restic/restic/internal/backend/gs"
+	"github.com/restic/restic/internal/backend/rclone"
+	"github.com/restic/restic/internal/backend/s3"
+	"github.com/restic/restic/internal/backend/swift"
+	"github.com/restic/restic/internal/options"
+)
+
+// EnvConfig passes the settings of backends that restic reads from the
+// environment, such as B2_ACCOUNT_ID or RCLONE_CONFIG_*, to the backend
+// of a repo. They're applied to the configuration of the backend rather
+// than set in the environment of the process, which is shared by every
+// repo, see applyEnv. Config is the extra configuration of the backend,
+// which takes precedence over the environment. It's passed to Open as
+// the extra configuration.
+type EnvConfig struct {
+	Env    map[string]string
+	Config any
+}
+
+// rcloneEnvPrefix is the prefix of the environment variables that rclone
+// reads, which are passed to the rclone program, see rcloneWithEnv
+const rcloneEnvPrefix = "RCLONE_"
+
+// envVar is an environment variable that restic reads into a field of
+// the configuration of a backend, either value or secret
+type envVar struct {
+	name   string
+	value  *string
+	secret *options.SecretString
+}
+
+// envVars returns the environment variables that restic reads into the
+// fields of config, like its ApplyEnvironment does. Where several set
+// the same field the first that's set wins.
+func envVars(config any) []envVar {
+	switch cfg := config.(type) {
+	case *azure.Config:
+		return []envVar{
+			{name: "AZURE_ACCOUNT_NAME", value: &cfg.AccountName},
+			{name: "AZURE_ACCOUNT_KEY", secret: &cfg.AccountKey},
+			{name: "AZURE_ACCOUNT_SAS", secret: &cfg.AccountSAS},
+			{name: "AZURE_ENDPOINT_SUFFIX", value: &cfg.EndpointSuffix},
+		}
+	case *b2.Config:
+		return []envVar{
+			{name: "B2_ACCOUNT_ID", value: &cfg.AccountID},
+			{name: "B2_ACCOUNT_KEY", secret: &cfg.Key},
+		}
+	case *gs.Config:
+		return []envVar{
+			{name: "GOOGLE_PROJECT_ID", value: &cfg.ProjectID},
+		}
+	case *s3.Config:
+		return []envVar{
+			{name: "AWS_ACCESS_KEY_ID", value: &cfg.KeyID},
+			{name: "AWS_SECRET_ACCESS_KEY", secret: &cfg.Secret},
+			{name: "AWS_DEFAULT_REGION", value: &cfg.Region},
+		}
+	case *swift.Config:
+		return []envVar{
+			{name: "OS_USERNAME", value: &cfg.UserName},
+			{name: "OS_PASSWORD", secret: &cfg.APIKey},
+			{name: "OS_REGION_NAME", value: &cfg.Region},
+			{name: "OS_AUTH_URL", value: &cfg.AuthURL},
+			{name: "OS_USER_ID", value: &cfg.UserID},
+			{name: "OS_USER_DOMAIN_NAME", value: &cfg.Domain},
+			{name: "OS_USER_DOMAIN_ID", value: &cfg.DomainID},
+			{name: "OS_PROJECT_NAME", value: &cfg.Tenant},
+			{name: "OS_PROJECT_DOMAIN_NAME", value: &cfg.TenantDomain},
+			{name: "OS_PROJECT_DOMAIN_ID", value: &cfg.TenantDomainID},
+			{name: "OS_TRUST_ID", value: &cfg.TrustID},
+			{name: "OS_TENANT_ID", value: &cfg.TenantID},
+			{name: "OS_TENANT_NAME", value: &cfg.Tenant},
+			{name: "ST_AUTH", value: &cfg.AuthURL},
+			{name: "ST_USER", value: &cfg.UserName},
+			{name: "ST_KEY", secret: &cfg.APIKey},
+			{name: "OS_APPLICATION_CREDENTIAL_ID", value: &cfg.ApplicationCredentialID},
+			{name: "OS_APPLICATION_CREDENTIAL_NAME", value: &cfg.ApplicationCredentialName},
+			{name: "OS_APPLICATION_CREDENTIAL_SECRET", secret: &cfg.ApplicationCredentialSecret},
+			{name: "OS_STORAGE_URL", value: &cfg.StorageURL},
+			{name: "OS_AUTH_TOKEN", secret: &cfg.AuthToken},
+		}
+	}
+	return nil
+}
+
+// EnvSupported returns whether the environment variable name is passed
+// to the backend of a repo by EnvConfig
+func EnvSupported(uri, name string) bool {
+	var config any
+	switch BackendType(uri) {
+	case "azure":
+		config = &azure.Config{}
+	case "b2":
+		config = &b2.Config{}
+	case "gs":
+		if name == googleCredentialsEnv {
+			return true
+		}
+		config = &gs.Config{}
+	case "rclone":
+		return strings.HasPrefix(name, rcloneEnvPrefix)
+	case "s3":
+		config = &s3.Config{}
+	case "swift":
+		config = &swift.Config{}
+	}
+	return slices.ContainsFunc(envVars(config), func(v envVar) bool { return v.name == name })
+}
+
+// applyEnv sets the fields of the configuration of a backend from env,
+// see envVars
+func applyEnv(config any, env map[string]string) {
+	set := map[any]bool{}
+	for _, v := range envVars(config) {
+		value := env[v.name]
+		if value == "" {
+			continue
+		}
+		switch {
+		case v.value != nil && !set[v.value]:
+			*v.value = value
+			set[v.value] = true
+		case v.secret != nil && !set[v.secret]:
+			*v.secret = options.NewSecretString(value)
+			set[v.secret] = true
+		}
+	}
+}
+
+// rcloneWithEnv makes restic run the rclone program of cfg with the
+// RCLONE_ variables of env. They're written to a file that a shell reads
+// before it runs rclone, so that they aren't visible in the arguments of
+// any process. The returned function removes the file, which can be done
+// once the backend is open since rclone is running by then.
+func rcloneWithEnv(cfg *rclone.Config, env map[string]string) (func(), error) {
+	var lines []string
+	for name, value := range env {
+		if strings.HasPrefix(name, rcloneEnvPrefix) {
+			lines = append(lines, "export "+name+"='"+strings.ReplaceAll(value, "'", `'\''`)+"'\n")
+		}
+	}
+	if len(lines) == 0 {
+		return func() {}, nil
+	}
+	slices.Sort(lines)
+
+	fd, err := os.CreateTemp("", "restic-reporter-rclone-*.env")
+	if err != nil {
+		return nil, err
+	}
+	remove := func() { os.Remove(fd.Name()) }
+
+	_, err = fd.WriteString(strings.Join(lines, ""))
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && strings.Contains(fd.Name()+cfg.Program, `"`) {
+		err = fmt.Errorf("The rclone program and temporary directory must not contain quotes")
+	}
+	if err != nil {
+		remove()
+		return nil, err
+	}
+
+	// restic splits the arguments like a shell and runs the program with
+	// them and the remote, which the shell runs with the file as $0
+	cfg.Args = fmt.Sprintf(`-c '. "$0" && exec "$@"' "%s" "%s" %s`, fd.Name(), cfg.Program, cfg.Args)
+	cfg.Program = "sh"
+	return remove, nil
+}
@@ -0,0 +1,83 @@
+package resticrepo
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/rclone"
+	"github.com/restic/restic/internal/backend/swift"
+)
+
+func TestApplyEnv(t *testing.T) {
+	cfg := &swift.Config{UserName: "from-process"}
+	applyEnv(cfg, map[string]string{
+		"OS_USERNAME": "user",
+		"ST_USER":     "v1-user",
+		"OS_PASSWORD": "secret",
+		"OS_AUTH_URL": "",
+	})
+
+	if cfg.UserName != "user" {
+		t.Errorf("got user %q, want the first variable that's set", cfg.UserName)
+	}
+	if got := cfg.APIKey.Unwrap(); got != "secret" {
+		t.Errorf("got key %q, want secret", got)
+	}
+	if cfg.AuthURL != "" {
+		t.Errorf("got auth URL %q from an empty variable", cfg.AuthURL)
+	}
+}
+
+func TestEnvSupported(t *testing.T) {
+	for _, tc := range []struct {
+		uri, name string
+		want      bool
+	}{
+		{"s3:s3.amazonaws.com/bucket", "AWS_DEFAULT_REGION", true},
+		{"s3:s3.amazonaws.com/bucket", "B2_ACCOUNT_ID", false},
+		{"gs:bucket:/", googleCredentialsEnv, true},
+		{"rclone:remote:path", "RCLONE_CONFIG_REMOTE_TYPE", true},
+		{"rclone:remote:path", "HOME", false},
+		{"sftp:host:/path", "SSH_AUTH_SOCK", false},
+	} {
+		if got := EnvSupported(tc.uri, tc.name); got != tc.want {
+			t.Errorf("EnvSupported(%q, %q) = %t, want %t", tc.uri, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRcloneWithEnv(t *testing.T) {
+	cfg := &rclone.Config{Program: "rclone", Args: "serve restic --stdio"}
+	remove, err := rcloneWithEnv(cfg, map[string]string{
+		"RCLONE_CONFIG_REMOTE_PASS": "it's secret",
+		"B2_ACCOUNT_ID":             "ignored",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Program != "sh" {
+		t.Errorf("got program %q, want sh", cfg.Program)
+	}
+	if strings.Contains(cfg.Args, "secret") {
+		t.Errorf("arguments %q contain the value of a variable", cfg.Args)
+	}
+	if !strings.HasSuffix(cfg.Args, `"rclone" serve restic --stdio`) {
+		t.Errorf("arguments %q don't end with rclone and its arguments", cfg.Args)
+	}
+
+	name := strings.Split(cfg.Args, `"`)[5]
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "export RCLONE_CONFIG_REMOTE_PASS='it'\\''s secret'\n"; string(data) != want {
+		t.Errorf("got env file %q, want %q", data, want)
+	}
+
+	remove()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("env file wasn't removed: %v", err)
+	}
+}
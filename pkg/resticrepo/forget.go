@@ -0,0 +1,147 @@
+package resticrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/reporter/pkg/repoerr"
+	"github.com/restic/restic/reporter/pkg/snapshots"
+)
+
+// DefaultForgetGroupBy is how restic forget groups snapshots unless
+// told otherwise
+const DefaultForgetGroupBy = "host,paths"
+
+// ForgetPolicy is the retention policy that restic forget is run with
+// for a repo, with the same meaning as its --keep options. Tags are
+// comma separated lists of tags like --keep-tag, and Within is a
+// duration like --keep-within such as 1y6m. GroupBy is like --group-by
+// and defaults to DefaultForgetGroupBy.
+type ForgetPolicy struct {
+	Last    int      `json:"keep_last,omitempty"`
+	Hourly  int      `json:"keep_hourly,omitempty"`
+	Daily   int      `json:"keep_daily,omitempty"`
+	Weekly  int      `json:"keep_weekly,omitempty"`
+	Monthly int      `json:"keep_monthly,omitempty"`
+	Yearly  int      `json:"keep_yearly,omitempty"`
+	Within  string   `json:"keep_within,omitempty"`
+	Tags    []string `json:"keep_tags,omitempty"`
+	GroupBy *string  `json:"group_by,omitempty"`
+}
+
+// Validate checks that the policy keeps some snapshots, since restic
+// forget refuses to run without one, and that it can be parsed
+func (p ForgetPolicy) Validate() error {
+	if p.Last < 0 || p.Hourly < 0 || p.Daily < 0 || p.Weekly < 0 || p.Monthly < 0 || p.Yearly < 0 {
+		return errors.New("forget_policy keep counts must not be negative")
+	}
+	if _, err := p.groupBy(); err != nil {
+		return fmt.Errorf("invalid forget_policy group_by: %w", err)
+	}
+	policy, err := p.expirePolicy()
+	if err != nil {
+		return err
+	}
+	if policy.Empty() {
+		return errors.New("forget_policy must keep some snapshots")
+	}
+	return nil
+}
+
+func (p ForgetPolicy) groupBy() (snapshots.GroupBy, error) {
+	if p.GroupBy == nil {
+		return snapshots.ParseGroupBy(DefaultForgetGroupBy)
+	}
+	return snapshots.ParseGroupBy(*p.GroupBy)
+}
+
+func (p ForgetPolicy) expirePolicy() (restic.ExpirePolicy, error) {
+	policy := restic.ExpirePolicy{
+		Last:    p.Last,
+		Hourly:  p.Hourly,
+		Daily:   p.Daily,
+		Weekly:  p.Weekly,
+		Monthly: p.Monthly,
+		Yearly:  p.Yearly,
+	}
+	if p.Within != "" {
+		within, err := restic.ParseDuration(p.Within)
+		if err != nil {
+			return restic.ExpirePolicy{}, fmt.Errorf("invalid forget_policy keep_within: %w", err)
+		}
+		policy.Within = within
+	}
+	for _, tags := range p.Tags {
+		policy.Tags = append(policy.Tags, restic.TagList(strings.Split(tags, ",")))
+	}
+	return policy, nil
+}
+
+// forgetGroup returns the key of the group of a snapshot for restic
+// forget, which groups by the sorted tags and paths like restic does
+func forgetGroup(g snapshots.GroupBy, sn *restic.Snapshot) string {
+	var key []string
+	if g.Host {
+		key = append(key, sn.Hostname)
+	}
+	if g.User {
+		key = append(key, sn.Username)
+	}
+	if g.Tags {
+		tags := slices.Clone(sn.Tags)
+		slices.Sort(tags)
+		key = append(key, strings.Join(tags, ","))
+	}
+	if g.Paths {
+		paths := slices.Clone(sn.Paths)
+		slices.Sort(paths)
+		key = append(key, strings.Join(paths, ","))
+	}
+	return strings.Join(key, "\x00")
+}
+
+// Forgettable returns the number of snapshots that restic forget would
+// remove with policy, as with --dry-run. All snapshots in the repository
+// are evaluated, including those that the exporter ignores. The
+// snapshots listed by Snapshots are reused if it was called.
+func (r *Repo) Forgettable(ctx context.Context, policy ForgetPolicy) (int, error) {
+	g, err := policy.groupBy()
+	if err != nil {
+		return 0, err
+	}
+	expire, err := policy.expirePolicy()
+	if err != nil {
+		return 0, err
+	}
+
+	all := r.snapshots
+	if all == nil {
+		err := restic.ForAllSnapshots(ctx, r.repo, r.repo, restic.IDSet{}, func(id restic.ID, sn *restic.Snapshot, err error) error {
+			if err != nil {
+				return err
+			}
+			all = append(all, sn)
+			return nil
+		})
+		if err != nil {
+			return 0, repoerr.Classify(err, nil)
+		}
+	}
+
+	groups := map[string]restic.Snapshots{}
+	for _, sn := range all {
+		key := forgetGroup(g, sn)
+		groups[key] = append(groups[key], sn)
+	}
+
+	var n int
+	for _, group := range groups {
+		_, remove, _ := restic.ApplyPolicy(group, expire)
+		n += len(remove)
+	}
+	return n, nil
+}
@@ -0,0 +1,64 @@
+package resticrepo
+
+import (
+	"os"
+	"sync"
+)
+
+// GSConfig holds the JSON key of the service account for a Google
+// Cloud Storage repo. It's passed to Open as the extra configuration for
+// GCS repos. Without it restic uses the application default credentials,
+// such as the service account of a GCE instance.
+type GSConfig struct {
+	CredentialsJSON string
+}
+
+// googleCredentialsEnv is the only way to give restic the credentials
+// of a GCS repo, which it reads when the backend is opened
+const googleCredentialsEnv = "GOOGLE_APPLICATION_CREDENTIALS"
+
+// gsMu is held while the backend of a GCS repo is opened, see
+// withGoogleCredentials
+var gsMu sync.Mutex
+
+// withGoogleCredentials calls fn with googleCredentialsEnv set to name
+// in the environment of the process, if name isn't empty, and restored
+// once fn returns. It's the only setting that can't be passed to a
+// backend in its configuration. Only the GCS backend reads it so only
+// GCS repos are opened one at a time.
+func withGoogleCredentials(name string, fn func() error) error {
+	gsMu.Lock()
+	defer gsMu.Unlock()
+
+	if name != "" {
+		if old, ok := os.LookupEnv(googleCredentialsEnv); ok {
+			defer os.Setenv(googleCredentialsEnv, old)
+		} else {
+			defer os.Unsetenv(googleCredentialsEnv)
+		}
+		os.Setenv(googleCredentialsEnv, name)
+	}
+	return fn()
+}
+
+// writeGoogleCredentials writes the credentials of a GCS repo to a
+// temporary file for googleCredentialsEnv. The returned function removes
+// the file, which can be done once the backend is open since restic has
+// read it by then.
+func writeGoogleCredentials(cfg GSConfig) (string, func(), error) {
+	fd, err := os.CreateTemp("", "restic-reporter-gs-*.json")
+	if err != nil {
+		return "", nil, err
+	}
+	remove := func() { os.Remove(fd.Name()) }
+
+	_, err = fd.WriteString(cfg.CredentialsJSON)
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		remove()
+		return "", nil, err
+	}
+	return fd.Name(), remove, nil
+}
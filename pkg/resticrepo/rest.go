@@ -0,0 +1,85 @@
+package resticrepo
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/rest"
+	"github.com/restic/restic/reporter/pkg/repoerr"
+)
+
+// RESTConfig holds the credentials for a rest-server repo, either a user
+// and password for basic authentication or a bearer token, as an
+// alternative to putting them in the URL. It's passed to Open as the
+// extra configuration for REST repos.
+type RESTConfig struct {
+	Username string
+	Password string
+	Token    string
+}
+
+// withUser returns a copy of u with the user and password of the config,
+// if any
+func (c RESTConfig) withUser(u *url.URL) *url.URL {
+	if c.Username == "" {
+		return u
+	}
+	out := *u
+	out.User = url.UserPassword(c.Username, c.Password)
+	return &out
+}
+
+// bearerTransport adds a bearer token to every request, which restic
+// has no option for
+type bearerTransport struct {
+	rt    http.RoundTripper
+	token string
+}
+
+func (t bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.rt.RoundTrip(req)
+}
+
+// withToken returns rt with the bearer token of the config, if any
+func (c RESTConfig) withToken(rt http.RoundTripper) http.RoundTripper {
+	if c.Token == "" {
+		return rt
+	}
+	return bearerTransport{rt: rt, token: c.Token}
+}
+
+// RESTClient returns a client that sends requests to a rest-server repo
+// like restic's REST backend does, through the same transport and with
+// the same credentials, and the URL of the repo. The user and password
+// are in the URL, which the client sends as basic authentication.
+func RESTClient(uri string, extraConfig any) (*http.Client, *url.URL, error) {
+	if envCfg, ok := extraConfig.(EnvConfig); ok {
+		extraConfig = envCfg.Config
+	}
+
+	loc, err := location.Parse(newBackendRegistry(), uri)
+	if err != nil {
+		return nil, nil, repoerr.Scrub(err)
+	}
+	cfg, ok := loc.Config.(*rest.Config)
+	if !ok {
+		return nil, nil, fmt.Errorf("Not a REST repo")
+	}
+
+	rt, err := backend.Transport(backend.TransportOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u := cfg.URL
+	if restCfg, ok := extraConfig.(RESTConfig); ok {
+		u = restCfg.withUser(u)
+		rt = restCfg.withToken(rt)
+	}
+	return &http.Client{Transport: rt}, u, nil
+}
@@ -0,0 +1,752 @@
+// Package resticrepo exists to abstract away a bunch of the complexities
+// of restic and to access the internal APIs. Everything about the
+// exporter that touches restic internals is, intentionally, in this
+// package.
+//
+// Restic is a very poorly factored codebase where a large chunk of
+// the logic lives in the command line implementation and the rest
+// of it lives in an internal package that can't be imported outside
+// of the source tree. The functions here are largely a simplified
+// re-implementation of the snapshot command line designed purely for
+// the exporter. They're much less feature rich and support fewer
+// backends but are otherwise functional for a Prometheus exporter.
+//
+// Because the restic internals can only be imported from within the
+// restic source tree this package, and so the whole exporter, must be
+// built within it. See the README for details.
+//
+// The exported API of this package is the only interface between the
+// exporter and restic and must never expose restic types, which is:
+//
+//   - BackendType and Supported for checking repo URIs, and EnvSupported
+//     for checking the environment variables of their backends
+//   - B2Config, S3Config, SFTPConfig, AzureConfig, GSConfig,
+//     RcloneConfig, SwiftConfig and RESTConfig for passing credentials
+//     to Open, and
+//     EnvConfig for passing environment variables along with them
+//   - Open, Repo.Snapshots, Repo.Size, Repo.Stats, Repo.RestoreSize,
+//     Repo.Forgettable, Repo.Check, Repo.Verify, Repo.RestoreFile and
+//     Repo.Close for reading repos, IndexStats for the result of
+//     Repo.Stats, ForgetPolicy for Repo.Forgettable, CheckResult and
+//     VerifyResult for Repo.Check and Repo.Verify, and RestoreOptions
+//     and RestoreResult for Repo.RestoreFile
+//   - Repo.Locks, Repo.IndexFiles and Repo.Keys for the files of an
+//     open repo, and Repo.Version for its format
+//   - Probe for checking that a repo is reachable without opening it
+//   - Locks and LockInfo for checking the locks of a repo without
+//     locking it
+//
+// The restic internals change between releases. Code that differs
+// between the supported restic versions is in the compat_*.go files,
+// which are selected with build tags. The default is the current
+// release, building with the restic_0_16 tag supports restic 0.16.
+package resticrepo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/azure"
+	"github.com/restic/restic/internal/backend/b2"
+	"github.com/restic/restic/internal/backend/gs"
+	"github.com/restic/restic/internal/backend/limiter"
+	"github.com/restic/restic/internal/backend/location"
+	belogger "github.com/restic/restic/internal/backend/logger"
+	"github.com/restic/restic/internal/backend/rclone"
+	"github.com/restic/restic/internal/backend/rest"
+	"github.com/restic/restic/internal/backend/s3"
+	"github.com/restic/restic/internal/backend/sema"
+	"github.com/restic/restic/internal/backend/sftp"
+	"github.com/restic/restic/internal/backend/swift"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/reporter/pkg/logctx"
+	"github.com/restic/restic/reporter/pkg/repoerr"
+	"github.com/restic/restic/reporter/pkg/snapshots"
+	"go.uber.org/zap"
+)
+
+// B2Config holds the credentials for a B2 repo. It's passed to Open as
+// the extra configuration for B2 repos.
+type B2Config struct {
+	AccountID string
+	Key       string
+}
+
+// S3Config holds the static credentials for an S3 repo. It's passed to
+// Open as the extra configuration for S3 repos. Without it restic reads
+// the credentials from the environment, such as AWS_ACCESS_KEY_ID or
+// the IAM role of an EC2 instance.
+type S3Config struct {
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// SFTPConfig holds the ssh options for an SFTP repo. It's passed to
+// Open as the extra configuration for SFTP repos. Restic runs ssh to
+// connect so anything that isn't set here is read from the ssh
+// configuration of the user running the exporter.
+type SFTPConfig struct {
+	// IdentityFile is the path of the private key
+	IdentityFile string
+
+	// KnownHostsFile is the path of the known_hosts file to verify the
+	// host key with
+	KnownHostsFile string
+
+	// HostKeyChecking is the ssh StrictHostKeyChecking option, which is
+	// yes, accept-new or no. The default is yes since ssh can't ask to
+	// accept a new key.
+	HostKeyChecking string
+}
+
+// args returns the arguments that restic passes to ssh. ssh is run in
+// batch mode so that it fails rather than prompts for a password or
+// passphrase. Paths are quoted for restic, which splits the arguments
+// like a shell.
+func (c SFTPConfig) args() string {
+	checking := c.HostKeyChecking
+	if checking == "" {
+		checking = "yes"
+	}
+
+	args := []string{"-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=" + checking}
+	if c.IdentityFile != "" {
+		args = append(args, "-o", "IdentitiesOnly=yes", "-i", `"`+c.IdentityFile+`"`)
+	}
+	if c.KnownHostsFile != "" {
+		args = append(args, "-o", `"UserKnownHostsFile=`+c.KnownHostsFile+`"`)
+	}
+	return strings.Join(args, " ")
+}
+
+// AzureConfig holds the credentials for an Azure Blob Storage repo,
+// which are either the key of the storage account or a SAS token. It's
+// passed to Open as the extra configuration for Azure repos.
+type AzureConfig struct {
+	AccountName string
+	AccountKey  string
+	AccountSAS  string
+}
+
+// RcloneConfig selects the rclone that restic runs for an rclone repo.
+// It's passed to Open as the extra configuration for rclone repos.
+type RcloneConfig struct {
+	// Program is the path of the rclone binary, the default is rclone
+	// from the PATH
+	Program string
+
+	// ConfigFile is the rclone configuration file with the remote of
+	// the repo, the default is the rclone configuration of the user
+	// running the exporter
+	ConfigFile string
+}
+
+// SwiftConfig holds the Keystone credentials for an OpenStack Swift
+// repo. It's passed to Open as the extra configuration for Swift repos.
+// Domain is the Keystone v3 domain of both the user and the tenant and
+// Region is only needed if there is more than one.
+type SwiftConfig struct {
+	AuthURL  string
+	Region   string
+	Tenant   string
+	Domain   string
+	UserName string
+	Key      string
+}
+
+// BackendType returns the restic backend type for a repo URI. Restic
+// treats anything without a known scheme prefix as a local path.
+func BackendType(uri string) string {
+	scheme, _, ok := strings.Cut(uri, ":")
+	if !ok || strings.ContainsAny(scheme, "/\\") {
+		return "local"
+	}
+	return scheme
+}
+
+// newBackendRegistry populates a location registry with only the
+// supported backends. More could be easily supported but because each
+// backend may need some additional configuration that's type specific
+// they aren't all supported by default.
+func newBackendRegistry() *location.Registry {
+	backends := location.NewRegistry()
+	backends.Register(azure.NewFactory())
+	backends.Register(b2.NewFactory())
+	backends.Register(gs.NewFactory())
+	backends.Register(rclone.NewFactory())
+	backends.Register(rest.NewFactory())
+	backends.Register(s3.NewFactory())
+	backends.Register(sftp.NewFactory())
+	backends.Register(swift.NewFactory())
+	return backends
+}
+
+// Supported indicates if a repo URI uses a supported backend
+func Supported(uri string) bool {
+	return newBackendRegistry().Lookup(BackendType(uri)) != nil
+}
+
+// Repo is an open and read locked restic repository
+type Repo struct {
+	repo   *repository.Repository
+	be     backend.Backend
+	unlock func()
+
+	// indexLoaded is whether the index has been loaded, see loadIndex
+	indexLoaded bool
+
+	// snapshots are all of the snapshots listed by Snapshots, nil if it
+	// wasn't called
+	snapshots []*restic.Snapshot
+}
+
+// Close releases the lock on the repository and closes its backend. It
+// must always be called otherwise the repo will have stale locks and
+// backups may fail, and backends that run a program, such as ssh for
+// SFTP or rclone, leave it running.
+func (r *Repo) Close() {
+	r.unlock()
+	r.be.Close()
+}
+
+// Open opens a restic repository and takes a read lock on it. The
+// caller is responsible for calling Close when they no longer need the
+// repository. The returned context is cancelled if the lock is lost and
+// should be used as a replacement for the context passed into this
+// function.
+//
+// This is largely a less options-driven version of the logic in
+// cmd/restic/global:OpenRepository which can't easily be used because
+// it's both command line flag driven and in a non-importable `main`
+// package.
+//
+// Each step of opening the repository is logged at debug level to the
+// logger carried by ctx to help diagnose repositories that fail to
+// open.
+//
+// Errors from the backend are classified with the repoerr package.
+//
+// Supporting more than Azure, B2, GCS, rclone, REST, S3, SFTP and Swift
+// will require updates to this function.
+func Open(ctx context.Context, uri, cryptoKey string, extraConfig any) (*Repo, context.Context, error) {
+	be, err := openBackend(ctx, uri, extraConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return open(ctx, be, cryptoKey)
+}
+
+// open opens and locks the repository in an open backend. The backend
+// is closed if the repository can't be opened, otherwise it's closed by
+// Repo.Close.
+func open(ctx context.Context, be backend.Backend, cryptoKey string) (_ *Repo, _ context.Context, err error) {
+	logger := logctx.From(ctx)
+
+	defer func() {
+		if err != nil {
+			be.Close()
+		}
+	}()
+
+	// Retries are logged through logger so they carry the repo and any
+	// other fields of the collection
+	report := func(msg string, err error, d time.Duration) {
+		err = repoerr.Scrub(err)
+		if d >= 0 {
+			logger.Warn("Backend operation failed, retrying", zap.String("operation", msg), zap.Duration("retry_after", d), zap.Error(err))
+		} else {
+			logger.Error("Backend operation failed", zap.String("operation", msg), zap.Error(err))
+		}
+	}
+	success := func(msg string, retries int) {
+		logger.Info("Backend operation succeeded after retries", zap.String("operation", msg), zap.Int("retries", retries))
+	}
+	be = newRetryBackend(be, report, success)
+
+	if err := statConfig(ctx, be); err != nil {
+		return nil, nil, err
+	}
+
+	// Actually setup the repository, assumes a lot of defaults
+	repo, err := repository.New(be, repository.Options{
+		Compression: repository.CompressionAuto,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Search up to 20 keys before failing to decrypt the repository. 20
+	// Scomes from the napshot CLI implementation. The empty string is the
+	// SKeyID hint, which shouldn't matter unless we have more than 20 keys
+	// Sfor a repository.
+	logger.Debug("Searching for repository key")
+	if err := repo.SearchKey(ctx, cryptoKey, 20, ""); err != nil {
+		return nil, nil, repoerr.Classify(err, repoerr.ErrDecrypt)
+	}
+
+	// Grab a non-exclusive read lock on the repository with no retries
+	// to prevent certain admin commands from shuffling data out from
+	// underneath of us. This is similar to the logic the snapshot command
+	// line uses. The caller must unlock this lock before they're done
+	// otherwise the repo will have stale locks and backups may fail.
+	printRetry := func(msg string) {
+		logger.Info("Retrying repository lock", zap.String("reason", msg))
+	}
+	lockLogger := func(format string, args ...any) {
+		logger.Info("Repository lock", zap.String("message", strings.TrimSpace(fmt.Sprintf(format, args...))))
+	}
+	logger.Debug("Taking repository read lock")
+	unlock, ctx, err := lockRepo(ctx, repo, printRetry, lockLogger)
+	if err != nil {
+		return nil, nil, repoerr.Classify(err, repoerr.ErrLocked)
+	}
+	logger.Debug("Repository opened and locked")
+
+	return &Repo{repo: repo, be: be, unlock: unlock}, ctx, nil
+}
+
+// Probe checks that a repository is reachable by opening its backend,
+// which resolves and connects to it, and checking that its config file
+// exists. Unlike Open this doesn't search for a key, take a lock or
+// retry so it's cheap enough to run often and fails fast.
+func Probe(ctx context.Context, uri string, extraConfig any) error {
+	be, err := openBackend(ctx, uri, extraConfig)
+	if err != nil {
+		return err
+	}
+	defer be.Close()
+
+	return statConfig(ctx, be)
+}
+
+// LockInfo describes a lock held on a repository
+type LockInfo struct {
+	Exclusive bool      `json:"exclusive"`
+	Time      time.Time `json:"time"`
+	Hostname  string    `json:"hostname"`
+	Username  string    `json:"username,omitempty"`
+	PID       int       `json:"pid"`
+}
+
+// Locks returns the locks held on a repository. The repository is
+// opened without retries and without taking a lock of its own, so that
+// the result isn't affected by the check itself and so that it's cheap
+// enough to run often. Locks that are removed while they're being read
+// and the locks held by this process are skipped.
+func Locks(ctx context.Context, uri, cryptoKey string, extraConfig any) ([]LockInfo, error) {
+	be, err := openBackend(ctx, uri, extraConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer be.Close()
+
+	if err := statConfig(ctx, be); err != nil {
+		return nil, err
+	}
+
+	repo, err := repository.New(be, repository.Options{})
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.SearchKey(ctx, cryptoKey, 20, ""); err != nil {
+		return nil, repoerr.Classify(err, repoerr.ErrDecrypt)
+	}
+
+	return loadLocks(ctx, repo)
+}
+
+// Locks returns the locks held on the repository by other processes,
+// which excludes the lock taken by Open. Locks that are removed while
+// they're being read are skipped.
+func (r *Repo) Locks(ctx context.Context) ([]LockInfo, error) {
+	return loadLocks(ctx, r.repo)
+}
+
+// loadLocks reads every lock of a repository except for those held by
+// this process, which are identified the same way restic identifies
+// its own locks, by host name and PID
+func loadLocks(ctx context.Context, repo *repository.Repository) ([]LockInfo, error) {
+	hostname, _ := os.Hostname()
+	pid := os.Getpid()
+
+	var ids []restic.ID
+	err := repo.List(ctx, restic.LockFile, func(id restic.ID, _ int64) error {
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return nil, repoerr.Classify(err, nil)
+	}
+
+	var locks []LockInfo
+	for _, id := range ids {
+		lock, err := restic.LoadLock(ctx, repo, id)
+		if err != nil {
+			logctx.From(ctx).Debug("Skipping unreadable lock", zap.String("lock", id.Str()), zap.Error(err))
+			continue
+		}
+		if lock.Hostname == hostname && lock.PID == pid {
+			continue
+		}
+		locks = append(locks, LockInfo{
+			Exclusive: lock.Exclusive,
+			Time:      lock.Time,
+			Hostname:  lock.Hostname,
+			Username:  lock.Username,
+			PID:       lock.PID,
+		})
+	}
+	return locks, nil
+}
+
+// openBackend opens the backend of a repository without retries
+func openBackend(ctx context.Context, uri string, extraConfig any) (backend.Backend, error) {
+	logger := logctx.From(ctx)
+	backends := newBackendRegistry()
+
+	var env map[string]string
+	envCfg, fromEnv := extraConfig.(EnvConfig)
+	if fromEnv {
+		env, extraConfig = envCfg.Env, envCfg.Config
+	}
+
+	logger.Debug("Parsing repository location")
+	loc, err := location.Parse(backends, uri)
+	if err != nil {
+		return nil, repoerr.Scrub(err)
+	}
+	logger.Debug("Parsed repository location", zap.String("scheme", loc.Scheme))
+
+	// Basically an http.DefaultTransport with some shorthand
+	// configuration. Sticking with this version since it'll deviate from
+	// API expectations less. Although http.DefaultTransport should really
+	// be just fine.
+	logger.Debug("Setting up HTTP transport")
+	rt, err := backend.Transport(backend.TransportOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only really needed because factory.Open expects it. It should in
+	// theory be safe to pass nil there but it's less fragile to just setup
+	// an unlimited Limiter instead.
+	lim := limiter.NewStaticLimiter(limiter.Limits{
+		UploadKb:   0,
+		DownloadKb: 0,
+	})
+	rt = lim.Transport(rt)
+
+	factory := backends.Lookup(loc.Scheme)
+	if factory == nil {
+		return nil, fmt.Errorf("No such backend type")
+	}
+
+	// rest-server tokens can only be given to restic as a header
+	if restCfg, ok := extraConfig.(RESTConfig); ok && loc.Scheme == "rest" {
+		rt = restCfg.withToken(rt)
+	}
+
+	// The credentials of GCS repos can only be given to restic in the
+	// environment, see withGoogleCredentials
+	googleCredentials := env[googleCredentialsEnv]
+	if gsCfg, ok := extraConfig.(GSConfig); ok && loc.Scheme == "gs" {
+		name, remove, err := writeGoogleCredentials(gsCfg)
+		if err != nil {
+			return nil, err
+		}
+		defer remove()
+		googleCredentials = name
+	}
+
+	// Like restic the settings in the environment are read first, those
+	// of the process and then those of the repo, so that the extra
+	// configuration overrides them
+	if ae, ok := loc.Config.(backend.ApplyEnvironmenter); ok && fromEnv {
+		ae.ApplyEnvironment("")
+	}
+	applyEnv(loc.Config, env)
+	applyExtraConfig(loc.Config, extraConfig)
+
+	if cfg, ok := loc.Config.(*rclone.Config); ok {
+		remove, err := rcloneWithEnv(cfg, env)
+		if err != nil {
+			return nil, err
+		}
+		defer remove()
+	}
+
+	logger.Debug("Opening backend", zap.Int("env_vars", len(env)))
+	var be backend.Backend
+	open := func() error {
+		be, err = factory.Open(ctx, loc.Config, rt, lim)
+		return err
+	}
+	if loc.Scheme == "gs" {
+		err = withGoogleCredentials(googleCredentials, open)
+	} else {
+		err = open()
+	}
+	if err != nil {
+		return nil, repoerr.Classify(err, nil)
+	}
+
+	return belogger.New(sema.NewBackend(be)), nil
+}
+
+// applyExtraConfig applies the extra backend specific config to the
+// config of a backend. This will possibly need updated to support other
+// backend types.
+func applyExtraConfig(config, extraConfig any) {
+	switch extraCfg := extraConfig.(type) {
+	case B2Config:
+		if cfg, ok := config.(*b2.Config); ok {
+			cfg.AccountID = extraCfg.AccountID
+			cfg.Key = options.NewSecretString(extraCfg.Key)
+		}
+	case S3Config:
+		if cfg, ok := config.(*s3.Config); ok {
+			cfg.KeyID = extraCfg.AccessKeyID
+			cfg.Secret = options.NewSecretString(extraCfg.SecretAccessKey)
+		}
+	case AzureConfig:
+		if cfg, ok := config.(*azure.Config); ok {
+			cfg.AccountName = extraCfg.AccountName
+			cfg.AccountKey = options.NewSecretString(extraCfg.AccountKey)
+			cfg.AccountSAS = options.NewSecretString(extraCfg.AccountSAS)
+		}
+	case RcloneConfig:
+		if cfg, ok := config.(*rclone.Config); ok {
+			if extraCfg.Program != "" {
+				cfg.Program = extraCfg.Program
+			}
+			if extraCfg.ConfigFile != "" {
+				cfg.Args += ` --config "` + extraCfg.ConfigFile + `"`
+			}
+		}
+	case RESTConfig:
+		if cfg, ok := config.(*rest.Config); ok {
+			cfg.URL = extraCfg.withUser(cfg.URL)
+		}
+	case SwiftConfig:
+		if cfg, ok := config.(*swift.Config); ok {
+			cfg.AuthURL = extraCfg.AuthURL
+			cfg.Region = extraCfg.Region
+			cfg.Tenant = extraCfg.Tenant
+			cfg.Domain = extraCfg.Domain
+			cfg.TenantDomain = extraCfg.Domain
+			cfg.UserName = extraCfg.UserName
+			cfg.APIKey = options.NewSecretString(extraCfg.Key)
+		}
+	case SFTPConfig:
+		if cfg, ok := config.(*sftp.Config); ok {
+			cfg.Args = extraCfg.args()
+		}
+	}
+}
+
+// statConfig stats the repo config file to make sure that this is a
+// valid repository target. Checks to make sure the repo size isn't zero
+// as a double check. This should also fail if the backend is
+// misconfigured.
+func statConfig(ctx context.Context, be backend.Backend) error {
+	logger := logctx.From(ctx)
+
+	logger.Debug("Checking repository config file")
+	fi, err := be.Stat(ctx, backend.Handle{Type: restic.ConfigFile})
+	if err != nil {
+		return repoerr.Classify(err, nil)
+	}
+
+	if fi.Size == 0 {
+		return fmt.Errorf("Invalid repo size 0")
+	}
+	logger.Debug("Found repository config file", zap.Int64("size", fi.Size))
+	return nil
+}
+
+// Snapshots creates a snapshots.Collection from all snapshots in the
+// repository that filter doesn't ignore, grouped by groupBy. It really
+// exists to limit the scope of what things in the exporter know about
+// the internals of restic.
+func (r *Repo) Snapshots(ctx context.Context, groupBy snapshots.GroupBy, filter snapshots.Filter) (snapshots.Collection, error) {
+	col := snapshots.Collection{}
+	var all []*restic.Snapshot
+	err := restic.ForAllSnapshots(ctx, r.repo, r.repo, restic.IDSet{}, func(id restic.ID, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			return err
+		}
+		all = append(all, sn)
+
+		snap := snapshots.Snapshot{
+			ID:       id.String(),
+			Username: sn.Username,
+			Hostname: sn.Hostname,
+			Time:     sn.Time,
+			Tags:     sn.Tags,
+			Paths:    sn.Paths,
+			Summary:  snapshotSummary(sn),
+		}
+		if snap.Summary != nil {
+			snap.Duration = snap.Summary.Duration()
+			snap.Size = snap.Summary.BytesProcessed
+		}
+		if !filter.Ignored(snap) {
+			col.AddSnapshot(groupBy, snap)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, repoerr.Classify(err, nil)
+	}
+	r.snapshots = all
+	return col, nil
+}
+
+// IndexStats are the totals of the index of a repository
+type IndexStats struct {
+	// RawBytes is the size of all blobs as stored, after compression
+	// and encryption, which is what restic stats reports in raw-data
+	// mode for all snapshots if nothing needs pruning
+	RawBytes int64 `json:"raw_bytes"`
+
+	// Blobs and Packs are the number of blobs and pack files
+	Blobs int64 `json:"blobs"`
+	Packs int64 `json:"packs"`
+}
+
+// Stats loads the index of the repository and totals it. This reads
+// every index file and holds the index in memory, which grows with the
+// number of blobs, so it's much slower than listing snapshots.
+func (r *Repo) Stats(ctx context.Context) (IndexStats, error) {
+	var stats IndexStats
+	if err := r.loadIndex(ctx); err != nil {
+		return stats, err
+	}
+
+	packs := map[restic.ID]struct{}{}
+	err := listBlobs(ctx, r.repo, func(pb restic.PackedBlob) {
+		stats.RawBytes += int64(pb.Length)
+		stats.Blobs++
+		packs[pb.PackID] = struct{}{}
+	})
+	stats.Packs = int64(len(packs))
+	return stats, repoerr.Classify(err, nil)
+}
+
+// loadIndex loads the index of the repository unless it's already
+// loaded, which is needed to read anything other than snapshots
+func (r *Repo) loadIndex(ctx context.Context) error {
+	if r.indexLoaded {
+		return nil
+	}
+	logctx.From(ctx).Debug("Loading repository index")
+	if err := r.repo.LoadIndex(ctx, nil); err != nil {
+		return repoerr.Classify(err, nil)
+	}
+	r.indexLoaded = true
+	return nil
+}
+
+// RestoreSize returns the total size of the files in a snapshot, which
+// is what restoring it writes and what restic stats reports in
+// restore-size mode. Hard linked files are only counted once. This
+// loads the index and reads every tree of the snapshot, so it's slow for
+// snapshots with many files.
+func (r *Repo) RestoreSize(ctx context.Context, snapshotID string) (int64, error) {
+	id, err := restic.ParseID(snapshotID)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.loadIndex(ctx); err != nil {
+		return 0, err
+	}
+
+	sn, err := restic.LoadSnapshot(ctx, r.repo, id)
+	if err != nil {
+		return 0, repoerr.Classify(err, nil)
+	}
+	if sn.Tree == nil {
+		return 0, fmt.Errorf("Snapshot %s has no tree", snapshotID)
+	}
+
+	type inode struct{ device, inode uint64 }
+	links := map[inode]bool{}
+
+	var size int64
+	var walk func(id restic.ID) error
+	walk = func(id restic.ID) error {
+		tree, err := restic.LoadTree(ctx, r.repo, id)
+		if err != nil {
+			return err
+		}
+		for _, node := range tree.Nodes {
+			switch {
+			case node.Type == "dir" && node.Subtree != nil:
+				if err := walk(*node.Subtree); err != nil {
+					return err
+				}
+			case node.Type == "file":
+				if node.Links > 1 {
+					key := inode{node.DeviceID, node.Inode}
+					if links[key] {
+						continue
+					}
+					links[key] = true
+				}
+				size += int64(node.Size)
+			}
+		}
+		return nil
+	}
+
+	return size, repoerr.Classify(walk(*sn.Tree), nil)
+}
+
+// IndexFiles returns the IDs of the index files of the repository,
+// which prune replaces. This lists the index files without reading them.
+func (r *Repo) IndexFiles(ctx context.Context) ([]string, error) {
+	var ids []string
+	err := r.repo.List(ctx, restic.IndexFile, func(id restic.ID, _ int64) error {
+		ids = append(ids, id.String())
+		return nil
+	})
+	return ids, repoerr.Classify(err, nil)
+}
+
+// Version returns the format version of the repository. Version 1
+// repositories can't be compressed, restic migrate upgrade_repo_v2
+// upgrades them.
+func (r *Repo) Version() uint {
+	return r.repo.Config().Version
+}
+
+// Keys returns the number of key files of the repository, each of which
+// is a password that opens it. Open tries up to 20 keys, so too many
+// slow opening the repository down.
+func (r *Repo) Keys(ctx context.Context) (int, error) {
+	var n int
+	err := r.repo.List(ctx, restic.KeyFile, func(restic.ID, int64) error {
+		n++
+		return nil
+	})
+	return n, repoerr.Classify(err, nil)
+}
+
+// Size returns the total size in bytes of the pack files in the
+// repository, which is the space used by the data of all snapshots. This
+// lists every pack file so it's slower than listing snapshots.
+func (r *Repo) Size(ctx context.Context) (int64, error) {
+	var size int64
+	err := r.repo.List(ctx, restic.PackFile, func(_ restic.ID, n int64) error {
+		size += n
+		return nil
+	})
+	return size, repoerr.Classify(err, nil)
+}
@@ -0,0 +1,82 @@
+package resticrepo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+const testPassword = "correct horse battery staple"
+
+// closeCounter counts how many times the backend is closed. Backends
+// such as SFTP and rclone run a program that's only stopped by Close.
+type closeCounter struct {
+	backend.Backend
+	closed int
+}
+
+func (b *closeCounter) Close() error {
+	b.closed++
+	return b.Backend.Close()
+}
+
+// newTestBackend returns an in-memory backend with a repository
+// initialized with testPassword
+func newTestBackend(t *testing.T) backend.Backend {
+	t.Helper()
+
+	be := mem.New()
+	repo, err := repository.New(be, repository.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Init(context.Background(), restic.StableRepoVersion, testPassword, nil); err != nil {
+		t.Fatal(err)
+	}
+	return be
+}
+
+func TestOpenClosesBackend(t *testing.T) {
+	be := &closeCounter{Backend: newTestBackend(t)}
+
+	repo, _, err := open(context.Background(), be, testPassword)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if be.closed != 0 {
+		t.Fatalf("backend closed %d times while the repo is open", be.closed)
+	}
+
+	repo.Close()
+	if be.closed != 1 {
+		t.Errorf("backend closed %d times by Close, want 1", be.closed)
+	}
+}
+
+func TestOpenClosesBackendOnError(t *testing.T) {
+	tests := []struct {
+		name     string
+		backend  backend.Backend
+		password string
+	}{
+		{"no repo", mem.New(), testPassword},
+		{"wrong password", newTestBackend(t), "wrong"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			be := &closeCounter{Backend: tt.backend}
+
+			if _, _, err := open(context.Background(), be, tt.password); err == nil {
+				t.Fatal("open succeeded, want an error")
+			}
+			if be.closed != 1 {
+				t.Errorf("backend closed %d times, want 1", be.closed)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package resticrepo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/reporter/pkg/repoerr"
+)
+
+// RestoreOptions selects the file restored by Repo.RestoreFile
+type RestoreOptions struct {
+	// Host limits the snapshot to the newest of a host, otherwise the
+	// newest snapshot of the repository is used
+	Host string
+
+	// Path is the absolute path of the file in the snapshot, otherwise
+	// a random non-empty file of at most MaxSize bytes is restored
+	Path    string
+	MaxSize int64
+
+	// Dir is the directory the file is restored to, the default temp
+	// directory if empty. The restored file is always removed.
+	Dir string
+}
+
+// RestoreResult describes the file restored by Repo.RestoreFile
+type RestoreResult struct {
+	Snapshot string
+	Path     string
+	Bytes    int64
+}
+
+// RestoreFile restores a file from the newest snapshot to a temporary
+// file like restic restore and verifies it: every blob of the file must
+// match its hash, and the file read back from disk must match the
+// blobs. This loads the index and reads the trees leading to the file,
+// and for a random file also the trees searched to find it.
+func (r *Repo) RestoreFile(ctx context.Context, opts RestoreOptions) (RestoreResult, error) {
+	var res RestoreResult
+	if err := r.loadIndex(ctx); err != nil {
+		return res, err
+	}
+
+	sn, err := r.newestSnapshot(ctx, opts.Host)
+	if err != nil {
+		return res, err
+	}
+	if sn == nil {
+		return res, fmt.Errorf("No snapshots to restore from")
+	}
+	res.Snapshot = sn.ID().String()
+	if sn.Tree == nil {
+		return res, fmt.Errorf("Snapshot %s has no tree", res.Snapshot)
+	}
+
+	var node *restic.Node
+	if opts.Path != "" {
+		res.Path = path.Clean("/" + opts.Path)
+		node, err = r.findFile(ctx, *sn.Tree, res.Path)
+	} else {
+		res.Path, node, err = r.randomFile(ctx, *sn.Tree, "/", opts.MaxSize)
+		if err == nil && node == nil {
+			err = fmt.Errorf("Snapshot %s has no files of at most %d bytes", res.Snapshot, opts.MaxSize)
+		}
+	}
+	if err != nil {
+		return res, repoerr.Classify(err, nil)
+	}
+
+	res.Bytes, err = r.restoreNode(ctx, node, opts.Dir)
+	if err != nil {
+		return res, fmt.Errorf("Error restoring %s: %w", res.Path, repoerr.Classify(err, nil))
+	}
+	return res, nil
+}
+
+// newestSnapshot returns the newest snapshot of host, or of the
+// repository if host is empty, nil if there are none. The snapshots
+// listed by Snapshots are reused if it was called.
+func (r *Repo) newestSnapshot(ctx context.Context, host string) (*restic.Snapshot, error) {
+	var newest *restic.Snapshot
+	consider := func(sn *restic.Snapshot) {
+		if (host == "" || sn.Hostname == host) && (newest == nil || sn.Time.After(newest.Time)) {
+			newest = sn
+		}
+	}
+
+	if r.snapshots != nil {
+		for _, sn := range r.snapshots {
+			consider(sn)
+		}
+		return newest, nil
+	}
+
+	err := restic.ForAllSnapshots(ctx, r.repo, r.repo, restic.IDSet{}, func(id restic.ID, sn *restic.Snapshot, err error) error {
+		if err != nil {
+			return err
+		}
+		consider(sn)
+		return nil
+	})
+	return newest, repoerr.Classify(err, nil)
+}
+
+// findFile follows the absolute path p from the root tree of a snapshot
+func (r *Repo) findFile(ctx context.Context, root restic.ID, p string) (*restic.Node, error) {
+	id := root
+	parts := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	for i, name := range parts {
+		tree, err := restic.LoadTree(ctx, r.repo, id)
+		if err != nil {
+			return nil, err
+		}
+
+		var next *restic.Node
+		for _, node := range tree.Nodes {
+			if node.Name == name {
+				next = node
+				break
+			}
+		}
+
+		switch {
+		case next == nil:
+			return nil, fmt.Errorf("No %s in the snapshot", p)
+		case i == len(parts)-1:
+			if next.Type != "file" {
+				return nil, fmt.Errorf("%s isn't a file", p)
+			}
+			return next, nil
+		case next.Type != "dir" || next.Subtree == nil:
+			return nil, fmt.Errorf("No %s in the snapshot", p)
+		}
+		id = *next.Subtree
+	}
+	return nil, fmt.Errorf("No %s in the snapshot", p)
+}
+
+// randomFile searches the trees below id in a random order for a
+// non-empty file of at most maxSize bytes and returns the first found,
+// so only the whole snapshot is read if it has no such file
+func (r *Repo) randomFile(ctx context.Context, id restic.ID, dir string, maxSize int64) (string, *restic.Node, error) {
+	tree, err := restic.LoadTree(ctx, r.repo, id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	nodes := append([]*restic.Node(nil), tree.Nodes...)
+	rand.Shuffle(len(nodes), func(i, j int) { nodes[i], nodes[j] = nodes[j], nodes[i] })
+
+	for _, node := range nodes {
+		switch {
+		case node.Type == "file" && node.Size > 0 && int64(node.Size) <= maxSize:
+			return path.Join(dir, node.Name), node, nil
+		case node.Type == "dir" && node.Subtree != nil:
+			p, found, err := r.randomFile(ctx, *node.Subtree, path.Join(dir, node.Name), maxSize)
+			if err != nil || found != nil {
+				return p, found, err
+			}
+		}
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+	}
+	return "", nil, nil
+}
+
+// restoreNode writes the blobs of a file to a temporary file in dir,
+// checking the hash of each, then reads it back to check that what was
+// written is what was restored. It returns the size of the file.
+func (r *Repo) restoreNode(ctx context.Context, node *restic.Node, dir string) (int64, error) {
+	fd, err := os.CreateTemp(dir, "restic-reporter-restore-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(fd.Name())
+	defer fd.Close()
+
+	restored := sha256.New()
+	var size int64
+	var buf []byte
+	for _, id := range node.Content {
+		buf, err = r.repo.LoadBlob(ctx, restic.DataBlob, id, buf)
+		if err != nil {
+			return size, err
+		}
+		if restic.ID(sha256.Sum256(buf)) != id {
+			return size, fmt.Errorf("Blob %s doesn't match its hash", id.Str())
+		}
+		if _, err := fd.Write(buf); err != nil {
+			return size, err
+		}
+		restored.Write(buf)
+		size += int64(len(buf))
+	}
+	if size != int64(node.Size) {
+		return size, fmt.Errorf("Restored %d bytes but the file has %d", size, node.Size)
+	}
+
+	if err := fd.Sync(); err != nil {
+		return size, err
+	}
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		return size, err
+	}
+	written := sha256.New()
+	if _, err := io.Copy(written, fd); err != nil {
+		return size, err
+	}
+	if !bytes.Equal(written.Sum(nil), restored.Sum(nil)) {
+		return size, fmt.Errorf("Restored file doesn't match what was read from the repository")
+	}
+	return size, nil
+}
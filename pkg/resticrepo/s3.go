@@ -0,0 +1,116 @@
+package resticrepo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/s3"
+	"github.com/restic/restic/reporter/pkg/repoerr"
+)
+
+// DefaultS3StorageClass is the storage class of objects that S3 lists
+// without one, which some S3 compatible services do for every object
+const DefaultS3StorageClass = "STANDARD"
+
+// S3StorageClass is what S3 stores in a storage class under the path of
+// a repo
+type S3StorageClass struct {
+	Bytes   int64 `json:"bytes"`
+	Objects int64 `json:"objects"`
+}
+
+// S3StorageClasses lists every object of an S3 repo and returns what's
+// stored by storage class, such as STANDARD or GLACIER. Pack files that
+// were moved to a cold storage class by the lifecycle rules of the
+// bucket are slow and expensive to restore, and restic can't tell. This
+// is as slow as listing the repo. The credentials are found like Open
+// finds them, see s3Credentials.
+func S3StorageClasses(ctx context.Context, uri string, extraConfig any) (map[string]S3StorageClass, error) {
+	var env map[string]string
+	envCfg, fromEnv := extraConfig.(EnvConfig)
+	if fromEnv {
+		env, extraConfig = envCfg.Env, envCfg.Config
+	}
+
+	loc, err := location.Parse(newBackendRegistry(), uri)
+	if err != nil {
+		return nil, repoerr.Scrub(err)
+	}
+	cfg, ok := loc.Config.(*s3.Config)
+	if !ok {
+		return nil, fmt.Errorf("Not an S3 repo")
+	}
+
+	rt, err := backend.Transport(backend.TransportOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Like openBackend the settings in the environment are read first so
+	// that the extra configuration overrides them
+	if fromEnv {
+		cfg.ApplyEnvironment("")
+	}
+	applyEnv(cfg, env)
+	applyExtraConfig(cfg, extraConfig)
+
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:     s3Credentials(cfg, rt),
+		Secure:    !cfg.UseHTTP,
+		Region:    cfg.Region,
+		Transport: rt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	classes := map[string]S3StorageClass{}
+	for obj := range client.ListObjects(ctx, cfg.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, repoerr.Classify(obj.Err, nil)
+		}
+
+		class := obj.StorageClass
+		if class == "" {
+			class = DefaultS3StorageClass
+		}
+		c := classes[class]
+		c.Bytes += obj.Size
+		c.Objects++
+		classes[class] = c
+	}
+	return classes, nil
+}
+
+// s3Credentials returns the credentials that restic's S3 backend would
+// use for cfg: the keys of cfg, the AWS and MinIO environment variables,
+// the AWS shared credentials file with AWS_PROFILE, the MinIO client
+// configuration and finally the IAM role of the instance, in that order.
+// Unlike restic the keys of cfg come before the AWS environment variables
+// so that the keys configured for a repo aren't overridden.
+func s3Credentials(cfg *s3.Config, rt http.RoundTripper) *credentials.Credentials {
+	static := &credentials.Static{Value: credentials.Value{AccessKeyID: cfg.KeyID}}
+	if cfg.KeyID != "" {
+		static.SecretAccessKey = cfg.Secret.Unwrap()
+	}
+
+	return credentials.NewChainCredentials([]credentials.Provider{
+		static,
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{},
+		&credentials.FileMinioClient{},
+		&credentials.IAM{Client: &http.Client{Transport: rt}},
+	})
+}
@@ -0,0 +1,267 @@
+package schedule
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Blackout is a calendar of days and events during which scheduled jobs
+// are skipped, such as the maintenance windows of a storage provider.
+// Days are in time.Local.
+type Blackout struct {
+	dates    map[string]bool // formatted as time.DateOnly
+	weekdays map[time.Weekday]bool
+	urls     []string
+
+	mu     sync.Mutex
+	events map[string][]Event // by URL, see Refresh
+}
+
+// Event is a single blackout period read from an iCal calendar
+type Event struct {
+	Summary string
+	Start   time.Time
+	End     time.Time
+}
+
+// ParseBlackout parses a list of dates such as 2024-12-25, weekdays such
+// as saturday or sat, and http or https URLs of iCal calendars. Events
+// aren't read from the calendars until Refresh is called.
+func ParseBlackout(values []string) (*Blackout, error) {
+	b := &Blackout{dates: map[string]bool{}, weekdays: map[time.Weekday]bool{}, events: map[string][]Event{}}
+
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://") {
+			b.urls = append(b.urls, v)
+			continue
+		}
+		if day, ok := parseWeekday(v); ok {
+			b.weekdays[day] = true
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, v); err != nil {
+			return nil, fmt.Errorf("Invalid blackout %q, must be a date, weekday or iCal URL", v)
+		}
+		b.dates[v] = true
+	}
+
+	return b, nil
+}
+
+// parseWeekday parses the English name of a weekday or its first three
+// letters
+func parseWeekday(v string) (time.Weekday, bool) {
+	v = strings.ToLower(v)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if v == name || v == name[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// Active returns whether t is in the blackout and why, which is the
+// date, the weekday or the summary of the event
+func (b *Blackout) Active(t time.Time) (string, bool) {
+	t = t.In(time.Local)
+	if date := t.Format(time.DateOnly); b.dates[date] {
+		return date, true
+	}
+	if b.weekdays[t.Weekday()] {
+		return strings.ToLower(t.Weekday().String()), true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, events := range b.events {
+		for _, ev := range events {
+			if !t.Before(ev.Start) && t.Before(ev.End) {
+				if ev.Summary == "" {
+					return "calendar event", true
+				}
+				return ev.Summary, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Refresh reads the events of every calendar. The events of a calendar
+// that can't be read are kept from the previous refresh.
+func (b *Blackout) Refresh(ctx context.Context) error {
+	var errs []error
+	for _, url := range b.urls {
+		events, err := fetchICal(ctx, url)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error reading blackout calendar %s: %w", url, err))
+			continue
+		}
+
+		b.mu.Lock()
+		b.events[url] = events
+		b.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Calendars returns whether the blackout reads any iCal calendars, which
+// need to be refreshed
+func (b *Blackout) Calendars() bool {
+	return len(b.urls) > 0
+}
+
+func fetchICal(ctx context.Context, url string) ([]Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected response: %s", res.Status)
+	}
+	return ParseICal(res.Body)
+}
+
+// ParseICal reads the events of an iCal calendar. Events that last all
+// day are in time.Local, as are times without a time zone. Recurring
+// events only have their first occurrence since recurrence rules aren't
+// expanded.
+func ParseICal(r io.Reader) ([]Event, error) {
+	lines, err := unfoldICal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var ev *Event
+	var allDay bool
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(name, ";")
+
+		switch strings.ToUpper(name) {
+		case "BEGIN":
+			if strings.EqualFold(value, "VEVENT") {
+				ev, allDay = &Event{}, false
+			}
+		case "END":
+			if ev == nil || !strings.EqualFold(value, "VEVENT") {
+				continue
+			}
+			if ev.Start.IsZero() {
+				return nil, errors.New("Event without DTSTART")
+			}
+			if ev.End.IsZero() && allDay {
+				ev.End = ev.Start.AddDate(0, 0, 1)
+			}
+			events = append(events, *ev)
+			ev = nil
+		case "SUMMARY":
+			if ev != nil {
+				ev.Summary = value
+			}
+		case "DTSTART", "DTEND":
+			if ev == nil {
+				continue
+			}
+			t, date, err := parseICalTime(params, value)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s %q: %w", name, value, err)
+			}
+			if strings.EqualFold(name, "DTSTART") {
+				ev.Start, allDay = t, date
+			} else {
+				ev.End = t
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// unfoldICal splits an iCal calendar into lines, joining the lines that
+// continue the previous line with a leading space or tab
+func unfoldICal(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseICalTime parses a DATE or DATE-TIME value with the parameters of
+// its property and returns whether it's a date
+func parseICalTime(params, value string) (time.Time, bool, error) {
+	loc := time.Local
+	for _, param := range strings.Split(params, ";") {
+		k, v, _ := strings.Cut(param, "=")
+		if strings.EqualFold(k, "TZID") {
+			if l, err := time.LoadLocation(strings.Trim(v, `"`)); err == nil {
+				loc = l
+			}
+		}
+	}
+
+	switch {
+	case len(value) == len("20060102"):
+		t, err := time.ParseInLocation("20060102", value, time.Local)
+		return t, true, err
+	case strings.HasSuffix(value, "Z"):
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	default:
+		t, err := time.ParseInLocation("20060102T150405", value, loc)
+		return t, false, err
+	}
+}
+
+// SkipDuring returns a scheduler that adds jobs to s which do nothing
+// while b is active, other than calling skipped with the name of the job
+// and the reason for the blackout. Jobs that are run directly rather
+// than by the scheduler aren't affected.
+func SkipDuring(s Scheduler, b *Blackout, skipped func(name, reason string)) Scheduler {
+	return &blackoutScheduler{Scheduler: s, blackout: b, skipped: skipped}
+}
+
+type blackoutScheduler struct {
+	Scheduler
+	blackout *Blackout
+	skipped  func(name, reason string)
+}
+
+func (s *blackoutScheduler) Add(name string, spec Spec, fn func()) error {
+	return s.Scheduler.Add(name, spec, func() {
+		if reason, ok := s.blackout.Active(time.Now()); ok {
+			s.skipped(name, reason)
+			return
+		}
+		fn()
+	})
+}
@@ -0,0 +1,48 @@
+package schedule_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/schedule"
+	"github.com/restic/restic/reporter/pkg/schedule/scheduletest"
+)
+
+func TestSkipDuring(t *testing.T) {
+	today := strings.ToLower(time.Now().Weekday().String())
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(time.DateOnly)
+
+	tests := []struct {
+		name     string
+		blackout []string
+		runs     bool
+	}{
+		{"no blackout", nil, true},
+		{"blackout tomorrow", []string{tomorrow}, true},
+		{"blackout today", []string{today}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := schedule.ParseBlackout(tt.blackout)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ran, skipped bool
+			fake := scheduletest.New()
+			s := schedule.SkipDuring(fake, b, func(name, reason string) { skipped = true })
+			if err := s.Add("job", schedule.Spec{}, func() { ran = true }); err != nil {
+				t.Fatal(err)
+			}
+			if err := fake.Run("job"); err != nil {
+				t.Fatal(err)
+			}
+
+			if ran != tt.runs || skipped == tt.runs {
+				t.Errorf("job ran %t and was skipped %t, want it to run %t", ran, skipped, tt.runs)
+			}
+		})
+	}
+}
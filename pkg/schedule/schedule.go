@@ -0,0 +1,195 @@
+// Package schedule decides when collections run. A Scheduler runs named
+// jobs according to a Spec, which is a cron expression, a fixed
+// interval or manual. Manual jobs are never run by the scheduler, only
+// by an external trigger such as the HTTP API or a signal.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+)
+
+// Kind is the type of a schedule
+type Kind int
+
+const (
+	Cron Kind = iota
+	Interval
+	Manual
+)
+
+const (
+	everyPrefix = "@every "
+	manualSpec  = "@manual"
+)
+
+// Spec is a parsed schedule
+type Spec struct {
+	Kind  Kind
+	Cron  string        // cron expression for Cron schedules
+	Every time.Duration // interval for Interval schedules
+}
+
+// Parse parses a schedule which is either "@every <duration>" (for
+// example "@every 6h"), "@manual" or a cron expression. Cron expressions
+// are only validated when added to a Scheduler.
+func Parse(v string) (Spec, error) {
+	v = strings.TrimSpace(v)
+
+	switch {
+	case v == "":
+		return Spec{}, errors.New("schedule is empty")
+	case v == manualSpec:
+		return Spec{Kind: Manual}, nil
+	case strings.HasPrefix(v, everyPrefix):
+		every, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(v, everyPrefix)))
+		if err != nil {
+			return Spec{}, fmt.Errorf("invalid interval: %w", err)
+		}
+		if every <= 0 {
+			return Spec{}, errors.New("interval must be positive")
+		}
+		return Spec{Kind: Interval, Every: every}, nil
+	default:
+		return Spec{Kind: Cron, Cron: v}, nil
+	}
+}
+
+// String returns the schedule in the format accepted by Parse
+func (s Spec) String() string {
+	switch s.Kind {
+	case Manual:
+		return manualSpec
+	case Interval:
+		return everyPrefix + s.Every.String()
+	default:
+		return s.Cron
+	}
+}
+
+// Scheduler runs named jobs on a schedule. Implementations must not run
+// a job again while a previous run of it is still going.
+type Scheduler interface {
+	// Add adds a job, replacing any existing job with the same name
+	Add(name string, spec Spec, fn func()) error
+
+	// Remove removes a job, it's not an error if the job doesn't exist
+	Remove(name string) error
+
+	// NextRun returns when a job will next run. Manual jobs return the
+	// zero time.
+	NextRun(name string) (time.Time, error)
+
+	// LastRun returns when the scheduler last ran any job, or when it
+	// was started if it hasn't run a job yet. It's the zero time until
+	// the scheduler is started.
+	LastRun() time.Time
+
+	Start()
+	Shutdown() error
+}
+
+// GocronScheduler is the Scheduler used by the server. It uses time.Local
+// as time zone, which considers the TZ environment variable override.
+type GocronScheduler struct {
+	sched gocron.Scheduler
+
+	mu   sync.Mutex
+	jobs map[string]gocron.Job // nil for manual jobs
+
+	lastRun atomic.Int64 // unix nanoseconds
+}
+
+var _ Scheduler = (*GocronScheduler)(nil)
+
+// New creates a scheduler, which doesn't run any jobs until started
+func New() (*GocronScheduler, error) {
+	sched, err := gocron.NewScheduler()
+	if err != nil {
+		return nil, err
+	}
+	return &GocronScheduler{sched: sched, jobs: map[string]gocron.Job{}}, nil
+}
+
+func (s *GocronScheduler) Add(name string, spec Spec, fn func()) error {
+	var def gocron.JobDefinition
+	switch spec.Kind {
+	case Cron:
+		def = gocron.CronJob(spec.Cron, true)
+	case Interval:
+		def = gocron.DurationJob(spec.Every)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sched.RemoveByTags(name)
+	delete(s.jobs, name)
+
+	if def == nil {
+		s.jobs[name] = nil
+		return nil
+	}
+
+	job, err := s.sched.NewJob(
+		def,
+		gocron.NewTask(func() {
+			s.lastRun.Store(time.Now().UnixNano())
+			fn()
+		}),
+		gocron.WithName(name),
+		gocron.WithTags(name),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		return fmt.Errorf("Error adding job %s: %w", name, err)
+	}
+
+	s.jobs[name] = job
+	return nil
+}
+
+func (s *GocronScheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sched.RemoveByTags(name)
+	delete(s.jobs, name)
+	return nil
+}
+
+func (s *GocronScheduler) NextRun(name string) (time.Time, error) {
+	s.mu.Lock()
+	job, ok := s.jobs[name]
+	s.mu.Unlock()
+
+	if !ok {
+		return time.Time{}, fmt.Errorf("No job named %s", name)
+	}
+	if job == nil {
+		return time.Time{}, nil
+	}
+	return job.NextRun()
+}
+
+func (s *GocronScheduler) LastRun() time.Time {
+	if ns := s.lastRun.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+func (s *GocronScheduler) Start() {
+	s.lastRun.Store(time.Now().UnixNano())
+	s.sched.Start()
+}
+
+func (s *GocronScheduler) Shutdown() error {
+	return s.sched.Shutdown()
+}
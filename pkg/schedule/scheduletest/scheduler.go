@@ -0,0 +1,118 @@
+// Package scheduletest provides a schedule.Scheduler that only runs jobs
+// when told to so that scheduled code can be exercised deterministically.
+package scheduletest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/reporter/pkg/schedule"
+)
+
+// Scheduler is a schedule.Scheduler that never runs jobs by itself, jobs
+// are run with Run regardless of their schedule
+type Scheduler struct {
+	mu    sync.Mutex
+	jobs  map[string]job
+	start bool
+	last  time.Time
+}
+
+type job struct {
+	spec schedule.Spec
+	fn   func()
+}
+
+var _ schedule.Scheduler = (*Scheduler)(nil)
+
+// New creates a scheduler with no jobs
+func New() *Scheduler {
+	return &Scheduler{jobs: map[string]job{}}
+}
+
+func (s *Scheduler) Add(name string, spec schedule.Spec, fn func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[name] = job{spec: spec, fn: fn}
+	return nil
+}
+
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, name)
+	return nil
+}
+
+// NextRun always returns the zero time for existing jobs
+func (s *Scheduler) NextRun(name string) (time.Time, error) {
+	if _, ok := s.Spec(name); !ok {
+		return time.Time{}, fmt.Errorf("No job named %s", name)
+	}
+	return time.Time{}, nil
+}
+
+// LastRun returns when Run or Start was last called
+func (s *Scheduler) LastRun() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start = true
+	s.last = time.Now()
+}
+
+func (s *Scheduler) Shutdown() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start = false
+	return nil
+}
+
+// Started returns true if the scheduler has been started and not shut
+// down
+func (s *Scheduler) Started() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.start
+}
+
+// Spec returns the schedule of a job and whether it exists
+func (s *Scheduler) Spec(name string) (schedule.Spec, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[name]
+	return j.spec, ok
+}
+
+// Names returns the names of all jobs in no particular order
+func (s *Scheduler) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.jobs))
+	for name := range s.jobs {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Run synchronously runs a job, it's an error if the job doesn't exist
+func (s *Scheduler) Run(name string) error {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	if ok {
+		s.last = time.Now()
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("No job named %s", name)
+	}
+	j.fn()
+	return nil
+}
@@ -0,0 +1,44 @@
+package snapshots
+
+import (
+	"slices"
+	"time"
+)
+
+// Cadence is how regularly the snapshots of a backup set are taken,
+// from the intervals between consecutive snapshots. A schedule that
+// drifts or skips runs has a max interval well above the mean.
+type Cadence struct {
+	Intervals int           `json:"intervals"`
+	Mean      time.Duration `json:"mean"`
+	Max       time.Duration `json:"max"`
+}
+
+// CheckCadence records in Info.Cadence the intervals between the
+// snapshots of every backup set. Snapshots taken at the same time, such
+// as one snapshot of several paths, are a single run. Sets with fewer
+// than two runs have no cadence. This must be called before
+// CheckCoverage releases the times of the snapshots.
+func (c Collection) CheckCadence() {
+	for _, set := range c {
+		set.Cadence = cadence(set.times)
+	}
+}
+
+// cadence returns the cadence of the snapshots taken at times, nil if
+// there are fewer than two distinct times
+func cadence(times []time.Time) *Cadence {
+	times = slices.Clone(times)
+	slices.SortFunc(times, time.Time.Compare)
+	times = slices.CompactFunc(times, time.Time.Equal)
+	if len(times) < 2 {
+		return nil
+	}
+
+	out := &Cadence{Intervals: len(times) - 1}
+	for i := 1; i < len(times); i++ {
+		out.Max = max(out.Max, times[i].Sub(times[i-1]))
+	}
+	out.Mean = times[len(times)-1].Sub(times[0]) / time.Duration(out.Intervals)
+	return out
+}
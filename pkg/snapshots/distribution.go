@@ -0,0 +1,136 @@
+package snapshots
+
+import (
+	"math"
+	"time"
+)
+
+// NativeSchema is the resolution of the exponential buckets of a
+// Distribution, as defined by Prometheus native histograms. Each bucket
+// is about 9% wider than the one before it.
+const NativeSchema = 3
+
+// AgeBuckets are the upper bounds in seconds of the classic buckets of
+// the ages of snapshots, from an hour to two years
+var AgeBuckets = []float64{
+	3600, 6 * 3600, 86400, 2 * 86400, 7 * 86400, 30 * 86400,
+	90 * 86400, 180 * 86400, 365 * 86400, 730 * 86400,
+}
+
+// SizeBuckets are the upper bounds in bytes of the classic buckets of
+// the sizes of snapshots, from a megabyte to ten terabytes
+var SizeBuckets = []float64{1e6, 1e7, 1e8, 1e9, 1e10, 1e11, 1e12, 1e13}
+
+// Distribution is a histogram of positive values with both classic
+// buckets, the upper bounds of which are given when observing, and the
+// exponential buckets of a Prometheus native histogram with
+// NativeSchema. Buckets holds the non-cumulative count of each classic
+// bucket, the count of values above the last bound is only in Count.
+// Native holds the count of each exponential bucket by its index, values
+// of zero or less are counted in Zero.
+type Distribution struct {
+	Buckets []uint64      `json:"buckets"`
+	Native  map[int]int64 `json:"native,omitempty"`
+	Zero    uint64        `json:"zero,omitempty"`
+	Sum     float64       `json:"sum"`
+	Count   uint64        `json:"count"`
+}
+
+// Observe adds a value with the classic buckets of bounds, which must be
+// the same for every value
+func (d *Distribution) Observe(v float64, bounds []float64) {
+	if d.Buckets == nil {
+		d.Buckets = make([]uint64, len(bounds))
+	}
+
+	for i, le := range bounds {
+		if v <= le {
+			d.Buckets[i]++
+			break
+		}
+	}
+
+	if v <= 0 {
+		d.Zero++
+	} else {
+		if d.Native == nil {
+			d.Native = map[int]int64{}
+		}
+		d.Native[nativeIndex(v)]++
+	}
+
+	d.Sum += v
+	d.Count++
+}
+
+// nativeIndex returns the index of the exponential bucket of v, which is
+// the bucket whose upper bound is the smallest power of 2^(2^-schema)
+// that is at least v
+func nativeIndex(v float64) int {
+	return int(math.Ceil(math.Log2(v) * (1 << NativeSchema)))
+}
+
+// Merge adds the values of another distribution with the same bounds
+func (d *Distribution) Merge(o *Distribution) {
+	if o == nil {
+		return
+	}
+	if d.Buckets == nil {
+		d.Buckets = make([]uint64, len(o.Buckets))
+	}
+
+	for i := range d.Buckets {
+		if i < len(o.Buckets) {
+			d.Buckets[i] += o.Buckets[i]
+		}
+	}
+	for i, n := range o.Native {
+		if d.Native == nil {
+			d.Native = map[int]int64{}
+		}
+		d.Native[i] += n
+	}
+	d.Zero += o.Zero
+	d.Sum += o.Sum
+	d.Count += o.Count
+}
+
+// Cumulative returns the cumulative count of each classic bucket keyed
+// by its upper bound, as used by Prometheus histograms
+func (d *Distribution) Cumulative(bounds []float64) map[float64]uint64 {
+	out := make(map[float64]uint64, len(bounds))
+	var total uint64
+	for i, le := range bounds {
+		if i < len(d.Buckets) {
+			total += d.Buckets[i]
+		}
+		out[le] = total
+	}
+	return out
+}
+
+// Ages returns the distribution of the ages in seconds at now of all of
+// the snapshots in the collection, snapshots in the future have an age
+// of zero. The times of the snapshots are only kept until CheckCoverage
+// is called so this must be called before.
+func (c Collection) Ages(now time.Time) *Distribution {
+	d := &Distribution{}
+	for _, set := range c {
+		for _, t := range set.times {
+			d.Observe(max(now.Sub(t).Seconds(), 0), AgeBuckets)
+		}
+	}
+	return d
+}
+
+// SetAges returns the distribution of the ages in seconds at now of the
+// newest snapshot of every backup set in the collection, which shows the
+// freshness of all of the sets at once. Sets dated in the future have an
+// age of zero.
+func (c Collection) SetAges(now time.Time) *Distribution {
+	d := &Distribution{}
+	for _, set := range c {
+		d.Observe(max(now.Sub(set.Time).Seconds(), 0), AgeBuckets)
+	}
+	return d
+}
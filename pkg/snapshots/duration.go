@@ -0,0 +1,66 @@
+package snapshots
+
+import "time"
+
+// DurationBuckets are the upper bounds in seconds of the buckets of
+// backup durations, from a minute to a day
+var DurationBuckets = []float64{60, 300, 900, 1800, 3600, 2 * 3600, 4 * 3600, 8 * 3600, 24 * 3600}
+
+// Durations is a histogram of the durations of backups with
+// DurationBuckets. Buckets holds the non-cumulative count of each
+// bucket, the count of backups longer than the last bucket is only in
+// Count.
+type Durations struct {
+	Buckets []uint64 `json:"buckets"`
+	Sum     float64  `json:"sum"`
+	Count   uint64   `json:"count"`
+}
+
+// Observe adds the duration of a backup
+func (d *Durations) Observe(v time.Duration) {
+	if d.Buckets == nil {
+		d.Buckets = make([]uint64, len(DurationBuckets))
+	}
+
+	secs := v.Seconds()
+	for i, le := range DurationBuckets {
+		if secs <= le {
+			d.Buckets[i]++
+			break
+		}
+	}
+	d.Sum += secs
+	d.Count++
+}
+
+// Merge adds the backups of another histogram
+func (d *Durations) Merge(o *Durations) {
+	if o == nil {
+		return
+	}
+	if d.Buckets == nil {
+		d.Buckets = make([]uint64, len(DurationBuckets))
+	}
+
+	for i := range d.Buckets {
+		if i < len(o.Buckets) {
+			d.Buckets[i] += o.Buckets[i]
+		}
+	}
+	d.Sum += o.Sum
+	d.Count += o.Count
+}
+
+// Cumulative returns the cumulative count of each bucket keyed by its
+// upper bound, as used by Prometheus histograms
+func (d *Durations) Cumulative() map[float64]uint64 {
+	out := make(map[float64]uint64, len(DurationBuckets))
+	var total uint64
+	for i, le := range DurationBuckets {
+		if i < len(d.Buckets) {
+			total += d.Buckets[i]
+		}
+		out[le] = total
+	}
+	return out
+}
@@ -0,0 +1,80 @@
+package snapshots
+
+import (
+	"regexp"
+	"slices"
+)
+
+// Filter selects the snapshots of a repo that are exported. Snapshots
+// with any of IgnoreTags are ignored. Hosts and users that match the
+// Exclude patterns are ignored, and if there are Include patterns only
+// the hosts and users that match them are kept. Nil patterns match
+// nothing.
+type Filter struct {
+	IgnoreTags []string
+
+	IncludeHosts *regexp.Regexp
+	ExcludeHosts *regexp.Regexp
+	IncludeUsers *regexp.Regexp
+	ExcludeUsers *regexp.Regexp
+}
+
+// Ignored returns true if the filter ignores the snapshot
+func (f Filter) Ignored(sn Snapshot) bool {
+	for _, tag := range sn.Tags {
+		if slices.Contains(f.IgnoreTags, tag) {
+			return true
+		}
+	}
+	return !selected(sn.Hostname, f.IncludeHosts, f.ExcludeHosts) ||
+		!selected(sn.Username, f.IncludeUsers, f.ExcludeUsers)
+}
+
+// IgnoredSet returns true if the filter ignores the host or user of a
+// backup set, which are only known if the set is grouped by them
+func (f Filter) IgnoredSet(i *Info) bool {
+	return i.Host != "" && !selected(i.Host, f.IncludeHosts, f.ExcludeHosts) ||
+		i.Username != "" && !selected(i.Username, f.IncludeUsers, f.ExcludeUsers)
+}
+
+// DropIgnored returns the backup sets whose host and user the filter
+// doesn't ignore, such as to forget the sets of hosts that are excluded
+// instead of them becoming missing. The collection isn't modified since
+// it may be in use.
+func (c Collection) DropIgnored(f Filter) Collection {
+	out := make(Collection, len(c))
+	for key, set := range c {
+		if !f.IgnoredSet(set) {
+			out[key] = set
+		}
+	}
+	return out
+}
+
+// selected returns true if v matches include, if set, and doesn't match
+// exclude
+func selected(v string, include, exclude *regexp.Regexp) bool {
+	if include != nil && !include.MatchString(v) {
+		return false
+	}
+	return exclude == nil || !exclude.MatchString(v)
+}
+
+// MatchAny compiles patterns into a regular expression that matches
+// strings that any of the patterns matches in full, or nil if there are
+// no patterns
+func MatchAny(patterns []string) (*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, err
+		}
+	}
+	all := "^(?:(?:" + patterns[0]
+	for _, p := range patterns[1:] {
+		all += ")|(?:" + p
+	}
+	return regexp.Compile(all + "))$")
+}
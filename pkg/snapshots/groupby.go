@@ -0,0 +1,145 @@
+package snapshots
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Snapshot is the summary of a restic snapshot used to group it into a
+// backup set
+type Snapshot struct {
+	// ID is the ID of the snapshot, empty if unknown
+	ID string
+
+	Username string
+	Hostname string
+	Time     time.Time
+	Tags     []string
+	Paths    []string
+
+	// Duration is how long the backup took, zero if unknown
+	Duration time.Duration
+
+	// Size is the size of the files that were backed up, zero if
+	// unknown
+	Size int64
+
+	// Summary is what the backup did, nil if unknown
+	Summary *Summary
+}
+
+// GroupBy selects the fields of snapshots that identify the backup set
+// they belong to, like restic's --group-by. Snapshots are grouped by
+// the exact list of tags or paths, not by each tag or path.
+type GroupBy struct {
+	Host  bool
+	User  bool
+	Tags  bool
+	Paths bool
+
+	// EachPath makes each path its own backup set, so a snapshot of
+	// several paths is in several sets. This takes precedence over
+	// Paths.
+	EachPath bool
+
+	// EachTag makes each tag that starts with TagPrefix its own backup
+	// set, so a snapshot with several of them is in several sets and
+	// one with none of them is in a set without tags. This takes
+	// precedence over Tags.
+	EachTag   bool
+	TagPrefix string
+}
+
+// DefaultGroupBy is the grouping that has always been used, by host and
+// user
+var DefaultGroupBy = GroupBy{Host: true, User: true}
+
+// ParseGroupBy parses a comma separated list of host, user, tags and
+// paths. The singular tag and path are also accepted. An empty list
+// groups all snapshots of a repo into one set.
+func ParseGroupBy(v string) (GroupBy, error) {
+	var g GroupBy
+	for _, field := range strings.Split(v, ",") {
+		switch strings.TrimSpace(field) {
+		case "":
+		case "host":
+			g.Host = true
+		case "user":
+			g.User = true
+		case "tag", "tags":
+			g.Tags = true
+		case "path", "paths":
+			g.Paths = true
+		default:
+			return GroupBy{}, fmt.Errorf("Invalid group by field %q, must be host, user, tags or paths", field)
+		}
+	}
+	return g, nil
+}
+
+// String returns the grouping in the format accepted by ParseGroupBy,
+// which doesn't include EachPath or EachTag
+func (g GroupBy) String() string {
+	g.EachPath = false
+	g.EachTag = false
+	return strings.Join(g.Labels(), ",")
+}
+
+// Labels returns the names of the metric labels that identify a backup
+// set, in the same order as LabelValues
+func (g GroupBy) Labels() []string {
+	var out []string
+	if g.Host {
+		out = append(out, "host")
+	}
+	if g.User {
+		out = append(out, "user")
+	}
+	if g.Tags || g.EachTag {
+		out = append(out, "tags")
+	}
+	if g.Paths || g.EachPath {
+		out = append(out, "paths")
+	}
+	return out
+}
+
+// LabelValues returns the values of the labels returned by Labels for a
+// backup set
+func (g GroupBy) LabelValues(i *Info) []string {
+	var out []string
+	if g.Host {
+		out = append(out, i.Host)
+	}
+	if g.User {
+		out = append(out, i.Username)
+	}
+	if g.Tags || g.EachTag {
+		out = append(out, i.Tags)
+	}
+	if g.Paths || g.EachPath {
+		out = append(out, i.Paths)
+	}
+	return out
+}
+
+// key is the key of a backup set in a Collection. The default grouping
+// uses the key that has always been used.
+func (g GroupBy) key(i Info) string {
+	key := fmt.Sprintf("%s-%s", i.Host, i.Username)
+	if g.Tags || g.EachTag {
+		key += "-" + i.Tags
+	}
+	if g.Paths || g.EachPath {
+		key += "-" + i.Paths
+	}
+	return key
+}
+
+func joinSorted(v []string) string {
+	v = slices.Clone(v)
+	slices.Sort(v)
+	return strings.Join(v, ",")
+}
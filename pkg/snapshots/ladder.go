@@ -0,0 +1,122 @@
+package snapshots
+
+import (
+	"errors"
+	"time"
+)
+
+// Ladder is the number of recent days, weeks, months and years that
+// should each have at least one snapshot, like the keep options of
+// restic forget. A backup set covers the ladder if it could be restored
+// to a point in each of those periods.
+type Ladder struct {
+	Daily   int `json:"daily,omitempty"`
+	Weekly  int `json:"weekly,omitempty"`
+	Monthly int `json:"monthly,omitempty"`
+	Yearly  int `json:"yearly,omitempty"`
+}
+
+// Validate checks that no rung of the ladder is negative
+func (l Ladder) Validate() error {
+	if l.Daily < 0 || l.Weekly < 0 || l.Monthly < 0 || l.Yearly < 0 {
+		return errors.New("retention_ladder periods must not be negative")
+	}
+	return nil
+}
+
+// rungs returns the rungs of the ladder that have any periods, in order
+// of increasing length, with a function returning the start of the
+// period i periods before the one ending at now
+func (l Ladder) rungs() []rung {
+	all := []rung{
+		{"daily", l.Daily, func(now time.Time, i int) time.Time { return now.AddDate(0, 0, -i) }},
+		{"weekly", l.Weekly, func(now time.Time, i int) time.Time { return now.AddDate(0, 0, -7*i) }},
+		{"monthly", l.Monthly, func(now time.Time, i int) time.Time { return now.AddDate(0, -i, 0) }},
+		{"yearly", l.Yearly, func(now time.Time, i int) time.Time { return now.AddDate(-i, 0, 0) }},
+	}
+
+	var out []rung
+	for _, r := range all {
+		if r.periods > 0 {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+type rung struct {
+	name    string
+	periods int
+	before  func(now time.Time, i int) time.Time
+}
+
+// coverage returns how many of the periods of the rung before now have
+// at least one of times
+func (r rung) coverage(now time.Time, times []time.Time) Coverage {
+	cov := Coverage{Period: r.name, Periods: r.periods}
+	for i := 0; i < r.periods; i++ {
+		end, start := r.before(now, i), r.before(now, i+1)
+		for _, t := range times {
+			if t.After(start) && !t.After(end) {
+				cov.Covered++
+				break
+			}
+		}
+	}
+	return cov
+}
+
+// Coverage is how many of the recent periods of one rung of a Ladder
+// have at least one snapshot
+type Coverage struct {
+	Period  string `json:"period"`
+	Periods int    `json:"periods"`
+	Covered int    `json:"covered"`
+}
+
+// Complete returns true if every period has a snapshot
+func (c Coverage) Complete() bool {
+	return c.Covered >= c.Periods
+}
+
+// Ratio returns the fraction of the periods that have a snapshot
+func (c Coverage) Ratio() float64 {
+	if c.Periods == 0 {
+		return 0
+	}
+	return float64(c.Covered) / float64(c.Periods)
+}
+
+// CheckCoverage records the coverage of the ladder by every backup set
+// at now. Periods are counted back from now rather than aligned to the
+// calendar so that the current day isn't uncovered until its backup
+// runs, so the daily periods are the last 24 hours, the 24 hours before
+// that and so on.
+//
+// The times of the snapshots in the sets are only kept until this is
+// called, so this releases them even if the ladder is empty.
+func (c Collection) CheckCoverage(now time.Time, l Ladder) {
+	rungs := l.rungs()
+	for _, set := range c {
+		set.Coverage = nil
+		for _, r := range rungs {
+			set.Coverage = append(set.Coverage, r.coverage(now, set.times))
+		}
+		set.times = nil
+	}
+}
+
+// CheckDaily records in Info.Daily how many of the last days before now
+// have a snapshot in every backup set, counted like the daily periods of
+// CheckCoverage. This must be called before CheckCoverage releases the
+// times of the snapshots.
+func (c Collection) CheckDaily(now time.Time, days int) {
+	r := Ladder{Daily: days}.rungs()
+	for _, set := range c {
+		set.Daily = nil
+		if len(r) > 0 {
+			cov := r[0].coverage(now, set.times)
+			set.Daily = &cov
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package snapshots
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// MaxRecent is the largest number of the most recent snapshots of a
+// backup set that can be kept, see KeepRecent. Every one of them is
+// exported as its own series so this keeps the series of a repo bounded.
+const MaxRecent = 20
+
+// RecentSnapshot is one of the most recent snapshots of a backup set.
+// Only snapshots with an ID are kept.
+type RecentSnapshot struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Tags []string  `json:"tags,omitempty"`
+}
+
+// addRecent adds a snapshot to recent, which is sorted newest first,
+// and drops all but the MaxRecent newest snapshots
+func addRecent(recent []RecentSnapshot, sn RecentSnapshot) []RecentSnapshot {
+	i, _ := slices.BinarySearchFunc(recent, sn, func(a, b RecentSnapshot) int {
+		return b.Time.Compare(a.Time)
+	})
+	if i >= MaxRecent {
+		return recent
+	}
+	recent = slices.Insert(recent, i, sn)
+	if len(recent) > MaxRecent {
+		recent = recent[:MaxRecent]
+	}
+	return recent
+}
+
+// mergeRecent returns the MaxRecent newest snapshots of a and b. A
+// snapshot of several paths can be in both when sets split by path are
+// merged, it's only included once.
+func mergeRecent(a, b []RecentSnapshot) []RecentSnapshot {
+	out := slices.Clone(a)
+	for _, sn := range b {
+		if !slices.ContainsFunc(out, func(o RecentSnapshot) bool { return o.ID == sn.ID }) {
+			out = addRecent(out, sn)
+		}
+	}
+	return out
+}
+
+// MeasureRestoreSizes sets the RestoreSize of every backup set to the
+// size of its newest snapshot as returned by size. Sets that share their
+// newest snapshot, such as when split by path, measure it once. Sets
+// whose snapshot can't be measured are left at zero and the errors are
+// returned. The newest snapshots are only known until KeepRecent is
+// called so this must be called before.
+func (c Collection) MeasureRestoreSizes(size func(id string) (int64, error)) error {
+	var errs []error
+	sizes := map[string]int64{}
+	for _, set := range c {
+		if len(set.recent) == 0 {
+			continue
+		}
+
+		id := set.recent[0].ID
+		n, ok := sizes[id]
+		if !ok {
+			var err error
+			if n, err = size(id); err != nil {
+				errs = append(errs, fmt.Errorf("Error measuring snapshot %s: %w", id, err))
+			}
+			sizes[id] = n
+		}
+		set.RestoreSize = n
+	}
+	return errors.Join(errs...)
+}
+
+// KeepRecent records the n most recent snapshots of every backup set in
+// Info.Recent, at most MaxRecent. The most recent snapshots are only
+// kept until this is called, so this releases them even if n is zero.
+func (c Collection) KeepRecent(n int) {
+	n = min(n, MaxRecent)
+	for _, set := range c {
+		set.Recent = nil
+		if n > 0 && len(set.recent) > 0 {
+			set.Recent = slices.Clone(set.recent[:min(n, len(set.recent))])
+		}
+		set.recent = nil
+	}
+}
@@ -0,0 +1,500 @@
+// Package snapshots aggregates restic snapshots into backup sets, one
+// per host and user, which is what the exporter reports on.
+package snapshots
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Info summarizes the snapshots in a single backup set
+type Info struct {
+	Host     string    `json:"host"`
+	Username string    `json:"user"`
+	Time     time.Time `json:"time"`
+	Count    int       `json:"count"`
+
+	// Tags and Paths are the sorted, comma separated tags and paths of
+	// the snapshots in the set when grouping by them. Paths is a single
+	// path when grouping by each path.
+	Tags  string `json:"tags,omitempty"`
+	Paths string `json:"paths,omitempty"`
+
+	// NewSnapshots is the total number of snapshots added to the
+	// backup set across collections, see Collection.CountNew
+	NewSnapshots uint64 `json:"new_snapshots,omitempty"`
+
+	// Future is the number of snapshots that were dated in the future
+	// when they were read, see FutureTolerance
+	Future int `json:"future,omitempty"`
+
+	// Missing is true for backup sets that were in a previous
+	// collection but no longer have any snapshots, see CarryMissing.
+	// Time is the time of their last snapshot. MissingSince is the
+	// time of the first collection that no longer found the set.
+	Missing      bool      `json:"missing,omitempty"`
+	MissingSince time.Time `json:"missing_since,omitempty"`
+
+	// Durations are the durations of the snapshots in the set that
+	// record them, nil if none do
+	Durations *Durations `json:"durations,omitempty"`
+
+	// Sizes are the sizes of the snapshots in the set that record them
+	// with SizeBuckets, nil if none do
+	Sizes *Distribution `json:"sizes,omitempty"`
+
+	// RestoreSize is the size of the files in the newest snapshot in the
+	// set, zero unless the repo measures it, see MeasureRestoreSizes
+	RestoreSize int64 `json:"restore_size_bytes,omitempty"`
+
+	// LatestPaths are all of the paths of the newest snapshot in the
+	// set, even when it's split by path
+	LatestPaths []string `json:"latest_paths,omitempty"`
+
+	// LatestSummary is the summary of the newest snapshot in the set,
+	// nil if it doesn't have one. Like LatestPaths it's the whole
+	// snapshot even when it's split by path.
+	LatestSummary *Summary `json:"latest_summary,omitempty"`
+
+	// PathsChecked is true if LatestPaths were compared to the expected
+	// paths of the host, see CheckPaths. MissingPaths are the expected
+	// paths that the newest snapshot doesn't include.
+	PathsChecked bool     `json:"paths_checked,omitempty"`
+	MissingPaths []string `json:"missing_paths,omitempty"`
+
+	// Coverage is the coverage of the retention ladder of the repo by
+	// the set, see CheckCoverage
+	Coverage []Coverage `json:"coverage,omitempty"`
+
+	// MaxAge is how old the newest snapshot in the set may be before
+	// the set is overdue, zero unless the repo sets it, see SetMaxAge
+	MaxAge time.Duration `json:"max_age,omitempty"`
+
+	// Daily is how many of the recent days have a snapshot in the set,
+	// nil unless the repo measures it, see CheckDaily
+	Daily *Coverage `json:"daily_coverage,omitempty"`
+
+	// Cadence is the intervals between the snapshots in the set, nil
+	// if it has fewer than two, see CheckCadence
+	Cadence *Cadence `json:"cadence,omitempty"`
+
+	// Recent are the most recent snapshots in the set, newest first, if
+	// the repo exports them, see KeepRecent
+	Recent []RecentSnapshot `json:"recent,omitempty"`
+
+	// times are the times of the snapshots in the set, which are only
+	// kept until CheckCoverage is called
+	times []time.Time
+
+	// recent are the MaxRecent most recent snapshots in the set, which
+	// are only kept until KeepRecent is called
+	recent []RecentSnapshot
+}
+
+// FutureTolerance is how far ahead of the local clock a snapshot may be
+// before it's counted as dated in the future, which allows for small
+// differences between clocks. Snapshots further ahead indicate a host
+// with a wrong clock, which keeps its backup set looking fresh.
+const FutureTolerance = 5 * time.Minute
+
+// DayAge computes the days age of the snapshot from some time now. now
+// is passed in to allow evaluating all snapshots from a static point in
+// time.
+func (i Info) DayAge(now time.Time) int {
+	return int(now.Sub(i.Time).Hours() / 24)
+}
+
+// Overdue returns true if the newest snapshot in the set is older than
+// its MaxAge at now
+func (i Info) Overdue(now time.Time) bool {
+	return i.MaxAge > 0 && now.Sub(i.Time) > i.MaxAge
+}
+
+// IsLegacy indicates if a snapshot should be considered legacy. This
+// method is itself legacy and is preserved only to prevent invalidating
+// years of original metrics.
+//
+// The original implementation of what is now this daemon added a label
+// of isLegacy to metrics once they stopped being updated for over
+// 60 days. This indicated to the alerting rules in prometheus that
+// a backup set had "aged-out" and was a way to allow upgrading or
+// deprecating devices without forever having them in alarm. It turns
+// out there's a much easier way to do that with compound comparisons
+// but since prometheus considers metrics to be unique by their labels
+// then dropping this would be problematic and invalidate years of
+// metrics. So this is preserved. It should not have existed but
+// sometimes it's hard to abandon the errors of the past.
+//
+// The threshold defaults to DefaultLegacyDays and can be changed with
+// IsLegacyAfter, although changing it moves the series of the sets that
+// flip. Stale is the replacement that doesn't.
+func (i Info) IsLegacy() bool {
+	return i.IsLegacyAfter(time.Now(), DefaultLegacyDays)
+}
+
+// DefaultLegacyDays is the age in days after which a backup set is
+// legacy, see IsLegacy
+const DefaultLegacyDays = 60
+
+// IsLegacyAfter is IsLegacy with a threshold of days at now
+func (i Info) IsLegacyAfter(now time.Time, days int) bool {
+	return i.DayAge(now) > days
+}
+
+// Stale returns true if the newest snapshot in the set is more than days
+// old at now. Unlike IsLegacy it's reported as a value instead of a
+// label so the series of a set don't change when it becomes stale.
+func (i Info) Stale(now time.Time, days int) bool {
+	return i.DayAge(now) > days
+}
+
+// Collection holds a collection of snapshots indexed by the
+// hostname and username that took them.
+type Collection map[string]*Info
+
+// Add adds a snapshot to the backup set of its hostname and username,
+// see AddSnapshot.
+func (c Collection) Add(username, hostname string, snapshotTime time.Time) {
+	c.AddSnapshot(DefaultGroupBy, Snapshot{Username: username, Hostname: hostname, Time: snapshotTime})
+}
+
+// AddSnapshot adds a snapshot from a restic repository to the backup set
+// it belongs to according to g, or to one set per tag or path if
+// g.EachTag or g.EachPath is set.
+//
+// By default the key for the backup set is the hostname and username
+// that produced the snapshot. This assumes that multiple hosts and users
+// may be packed into a single repository (but should work well even if
+// that's not true).
+//
+// Info.Time will always be the latest time of any snapshot
+// found. Count will be the total number of snapshots found for the
+// collection.
+//
+// This uses some summary info from the snapshot rather than the whole
+// snapshot to eliminate hard dependencies on the internals of restic.
+func (c Collection) AddSnapshot(g GroupBy, sn Snapshot) {
+	c.addSnapshot(g, sn, sn)
+}
+
+// addSnapshot adds a snapshot that was orig before splitting it by tag
+// or path
+func (c Collection) addSnapshot(g GroupBy, sn, orig Snapshot) {
+	// An older version of restic had a bug where on macOS in some cases
+	// it would set an empty username. This bug no longer exists but this
+	// patches over old snapshots that still have invalid data.
+	if sn.Username == "" {
+		sn.Username = "UNKNOWN"
+	}
+
+	if g.EachTag {
+		g.EachTag = false
+		g.Tags = true
+		tags := sn.Tags
+		sn.Tags = nil
+		split := false
+		for _, tag := range tags {
+			if strings.HasPrefix(tag, g.TagPrefix) {
+				sn.Tags = []string{tag}
+				c.addSnapshot(g, sn, orig)
+				split = true
+			}
+		}
+		if !split {
+			c.addSnapshot(g, sn, orig)
+		}
+		return
+	}
+
+	if g.EachPath && len(sn.Paths) > 0 {
+		g.EachPath = false
+		g.Paths = true
+		for _, path := range sn.Paths {
+			sn.Paths = []string{path}
+			c.addSnapshot(g, sn, orig)
+		}
+		return
+	}
+
+	set := Info{}
+	if g.Host {
+		set.Host = sn.Hostname
+	}
+	if g.User {
+		set.Username = sn.Username
+	}
+	if g.Tags {
+		set.Tags = joinSorted(sn.Tags)
+	}
+	if g.Paths {
+		set.Paths = joinSorted(sn.Paths)
+	}
+
+	key := g.key(set)
+
+	val := c[key]
+	if val == nil {
+		val = &set
+		c[key] = val
+	}
+
+	if val.Time.Before(sn.Time) || val.Count == 0 {
+		val.Time = sn.Time
+		val.LatestPaths = orig.Paths
+		val.LatestSummary = sn.Summary
+	}
+	if time.Until(sn.Time) > FutureTolerance {
+		val.Future += 1
+	}
+	val.times = append(val.times, sn.Time)
+	if sn.ID != "" {
+		val.recent = addRecent(val.recent, RecentSnapshot{ID: sn.ID, Time: sn.Time, Tags: orig.Tags})
+	}
+	if sn.Duration > 0 {
+		if val.Durations == nil {
+			val.Durations = &Durations{}
+		}
+		val.Durations.Observe(sn.Duration)
+	}
+	if sn.Size > 0 {
+		if val.Sizes == nil {
+			val.Sizes = &Distribution{}
+		}
+		val.Sizes.Observe(float64(sn.Size), SizeBuckets)
+	}
+
+	val.Count += 1
+}
+
+// CountNew carries NewSnapshots over from the previous collection of the
+// same repo, adding the number of snapshots that were added since. This
+// is based on the number of snapshots rather than their times so that
+// it isn't affected by the clocks of the hosts taking snapshots. If
+// snapshots were also removed since prev, such as by a prune, the added
+// snapshots are undercounted. Sets that aren't in prev start from zero
+// since it's unknown how many of their snapshots are new.
+func (c Collection) CountNew(prev Collection) {
+	for key, set := range c {
+		old, ok := prev[key]
+		if !ok {
+			continue
+		}
+
+		set.NewSnapshots = old.NewSnapshots
+		if set.Count > old.Count {
+			set.NewSnapshots += uint64(set.Count - old.Count)
+		}
+	}
+}
+
+// CarryMissing adds the backup sets of the previous collection of the
+// same repo that no longer have any snapshots, such as when all of the
+// snapshots of a host were forgotten. They're kept with a count of zero
+// and their last snapshot time so that their age keeps growing instead
+// of the set silently disappearing. Sets that weren't missing in prev
+// are missing since now.
+func (c Collection) CarryMissing(prev Collection, now time.Time) {
+	for key, old := range prev {
+		if _, ok := c[key]; ok {
+			continue
+		}
+
+		set := *old
+		set.Count = 0
+		set.Future = 0
+		set.Durations = nil
+		set.Sizes = nil
+		set.RestoreSize = 0
+		set.LatestSummary = nil
+		set.Recent = nil
+		set.PathsChecked = false
+		set.MissingPaths = nil
+		set.Coverage = slices.Clone(set.Coverage)
+		for i := range set.Coverage {
+			set.Coverage[i].Covered = 0
+		}
+		if set.Daily != nil {
+			set.Daily = &Coverage{Period: set.Daily.Period, Periods: set.Daily.Periods}
+		}
+		if !set.Missing || set.MissingSince.IsZero() {
+			set.MissingSince = now
+		}
+		set.Missing = true
+		c[key] = &set
+	}
+}
+
+// DropAgedOut returns the backup sets whose newest snapshot is at most
+// days old at now. The collection isn't modified since it may be in use.
+func (c Collection) DropAgedOut(now time.Time, days int) Collection {
+	out := make(Collection, len(c))
+	for key, set := range c {
+		if set.DayAge(now) <= days {
+			out[key] = set
+		}
+	}
+	return out
+}
+
+// DropMissing returns the backup sets except those that have been
+// missing for longer than ttl at now, see CarryMissing. The collection
+// isn't modified since it may be in use.
+func (c Collection) DropMissing(now time.Time, ttl time.Duration) Collection {
+	out := make(Collection, len(c))
+	for key, set := range c {
+		if !set.Missing || now.Sub(set.MissingSince) <= ttl {
+			out[key] = set
+		}
+	}
+	return out
+}
+
+// Relabel returns a copy of the collection with fn applied to a copy of
+// every backup set. Sets that are the same after fn are merged, such as
+// when fn clears a field.
+func (c Collection) Relabel(fn func(*Info)) Collection {
+	all := GroupBy{Host: true, User: true, Tags: true, Paths: true}
+	out := make(Collection, len(c))
+
+	for _, v := range c {
+		set := *v
+		fn(&set)
+
+		key := all.key(set)
+		existing, ok := out[key]
+		if !ok {
+			out[key] = &set
+			continue
+		}
+
+		existing.Count += set.Count
+		existing.NewSnapshots += set.NewSnapshots
+		existing.Future += set.Future
+		existing.PathsChecked = existing.PathsChecked || set.PathsChecked
+		existing.MissingPaths = joinUnique(existing.MissingPaths, set.MissingPaths)
+		existing.times = slices.Concat(existing.times, set.times)
+		existing.recent = mergeRecent(existing.recent, set.recent)
+		if set.Durations != nil {
+			merged := &Durations{}
+			merged.Merge(existing.Durations)
+			merged.Merge(set.Durations)
+			existing.Durations = merged
+		}
+		if set.Sizes != nil {
+			merged := &Distribution{}
+			merged.Merge(existing.Sizes)
+			merged.Merge(set.Sizes)
+			existing.Sizes = merged
+		}
+		if set.MaxAge > 0 && (existing.MaxAge == 0 || set.MaxAge < existing.MaxAge) {
+			existing.MaxAge = set.MaxAge
+		}
+		existing.Missing = existing.Missing && set.Missing
+		if !existing.Missing {
+			existing.MissingSince = time.Time{}
+		} else if existing.MissingSince.Before(set.MissingSince) {
+			existing.MissingSince = set.MissingSince
+		}
+		if existing.Time.Before(set.Time) {
+			existing.Time = set.Time
+			existing.LatestPaths = set.LatestPaths
+			existing.LatestSummary = set.LatestSummary
+			existing.RestoreSize = set.RestoreSize
+		}
+	}
+
+	return out
+}
+
+// Hosts returns the number of distinct hosts with snapshots in the
+// collection, which is zero unless the sets are grouped by host
+func (c Collection) Hosts() int {
+	return c.distinct(func(i *Info) string { return i.Host })
+}
+
+// Users returns the number of distinct users with snapshots in the
+// collection, which is zero unless the sets are grouped by user
+func (c Collection) Users() int {
+	return c.distinct(func(i *Info) string { return i.Username })
+}
+
+// HasHosts returns whether each of hosts has a backup set that isn't
+// missing in the collection, which is only known when the sets are
+// grouped by host
+func (c Collection) HasHosts(hosts []string) map[string]bool {
+	out := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		out[host] = false
+	}
+	for _, set := range c {
+		if _, ok := out[set.Host]; ok && !set.Missing {
+			out[set.Host] = true
+		}
+	}
+	return out
+}
+
+// distinct returns the number of distinct non-empty values of field in
+// the sets that aren't missing
+func (c Collection) distinct(field func(*Info) string) int {
+	seen := map[string]bool{}
+	for _, set := range c {
+		if v := field(set); v != "" && !set.Missing {
+			seen[v] = true
+		}
+	}
+	return len(seen)
+}
+
+// SetMaxAge sets the MaxAge of every backup set to what maxAge returns
+// for its host, which is empty unless the sets are grouped by host
+func (c Collection) SetMaxAge(maxAge func(host string) time.Duration) {
+	for _, set := range c {
+		set.MaxAge = maxAge(set.Host)
+	}
+}
+
+// CheckPaths compares the newest snapshot of every backup set with the
+// paths that its host is expected to back up, which expected returns,
+// and records the expected paths that it doesn't include. A path is
+// included if it or one of its parents was backed up. Sets whose host
+// isn't expected to back up any paths aren't checked.
+func (c Collection) CheckPaths(expected func(host string) []string) {
+	for _, set := range c {
+		want := expected(set.Host)
+		if len(want) == 0 {
+			continue
+		}
+
+		set.PathsChecked = true
+		set.MissingPaths = nil
+		for _, path := range want {
+			if !pathIncluded(path, set.LatestPaths) {
+				set.MissingPaths = append(set.MissingPaths, path)
+			}
+		}
+	}
+}
+
+// pathIncluded returns true if path or one of its parents is in paths
+func pathIncluded(path string, paths []string) bool {
+	path = strings.TrimRight(path, "/")
+	for _, p := range paths {
+		p = strings.TrimRight(p, "/")
+		if p == path || p == "" || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// joinUnique returns the sorted values that are in either a or b
+func joinUnique(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+	out := slices.Concat(a, b)
+	slices.Sort(out)
+	return slices.Compact(out)
+}
@@ -0,0 +1,30 @@
+package snapshots
+
+import (
+	"time"
+)
+
+// Summary is what the backup that took a snapshot did, which is only
+// recorded by restic 0.17 and later
+type Summary struct {
+	// DataAdded is the size of the new data that the backup added to
+	// the repo before compression
+	DataAdded int64 `json:"data_added"`
+
+	// FilesProcessed and BytesProcessed are the number and total size
+	// of the files that the backup read
+	FilesProcessed int64 `json:"files_processed"`
+	BytesProcessed int64 `json:"bytes_processed"`
+
+	BackupStart time.Time `json:"backup_start"`
+	BackupEnd   time.Time `json:"backup_end"`
+}
+
+// Duration returns how long the backup took, zero if its start isn't
+// known
+func (s *Summary) Duration() time.Duration {
+	if s.BackupStart.IsZero() {
+		return 0
+	}
+	return s.BackupEnd.Sub(s.BackupStart)
+}
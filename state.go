@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/restic/restic/reporter/pkg/collector"
+	"go.uber.org/zap"
+)
+
+// persistResults restores the results persisted in the state file, if
+// any, and persists the results of every collection to it. This keeps
+// the results and the backup sets that were seen before across
+// restarts, so sets that disappeared while the server was down are
+// still reported as missing.
+func persistResults(logger *zap.Logger, c *collector.ResticCollector, name string) {
+	metrics, err := readStateFile(name)
+	switch {
+	case err == nil:
+		logger.Info("Restored results from state file", zap.String("file", name), zap.Time("time", metrics.Time))
+		c.RestoreStatus(metrics)
+	case !os.IsNotExist(err):
+		logger.Error("Error reading state file, starting without previous results", zap.String("file", name), zap.Error(err))
+	}
+
+	c.OnCollected(func(ctx context.Context, metrics *collector.AllRepoMetrics) {
+		if err := writeStateFile(name, metrics); err != nil {
+			logger.Error("Error writing state file", zap.String("file", name), zap.Error(err))
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// syslogFacility is the daemon facility from RFC5424 section 6.2.1
+const syslogFacility = 3
+
+// syslogWriter sends RFC5424 formatted messages to a remote syslog
+// server over either UDP or TCP. TCP messages are framed using octet
+// counting as described in RFC6587 since that's the framing that most
+// modern syslog servers expect.
+//
+// The Go log/syslog package isn't used because it emits a hybrid of
+// RFC3164 and RFC5424 that not all servers parse correctly.
+type syslogWriter struct {
+	network  string
+	addr     string
+	hostname string
+	appName  string
+	conn     net.Conn
+	sync.Mutex
+}
+
+// newSyslogWriter creates a syslogWriter from a URI of the form
+// udp://host:port or tcp://host:port. The connection is established
+// lazily on first write.
+func newSyslogWriter(uri string) (*syslogWriter, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("Unsupported syslog scheme %q, must be udp or tcp", u.Scheme)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "514")
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	return &syslogWriter{
+		network:  u.Scheme,
+		addr:     addr,
+		hostname: hostname,
+		appName:  filepath.Base(os.Args[0]),
+	}, nil
+}
+
+func (w *syslogWriter) format(severity int, ts time.Time, msg []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d - - ",
+		syslogFacility*8+severity,
+		ts.Format(time.RFC3339Nano),
+		w.hostname,
+		w.appName,
+		os.Getpid(),
+	)
+	b.Write(msg)
+
+	if w.network == "tcp" {
+		return append([]byte(fmt.Sprintf("%d ", b.Len())), b.Bytes()...)
+	}
+	return b.Bytes()
+}
+
+// WriteMessage sends a single message to the server. If the write
+// fails the connection is dropped and will be re-established on the
+// next write. A failed message is not retried.
+func (w *syslogWriter) WriteMessage(severity int, ts time.Time, msg []byte) error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.network, w.addr, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+
+	if _, err := w.conn.Write(w.format(severity, ts, msg)); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+
+	return nil
+}
+
+func (w *syslogWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// syslogSeverity maps a zap level to a syslog severity from RFC5424
+// section 6.2.1
+func syslogSeverity(l zapcore.Level) int {
+	switch l {
+	case zapcore.DebugLevel:
+		return 7
+	case zapcore.InfoLevel:
+		return 6
+	case zapcore.WarnLevel:
+		return 4
+	case zapcore.ErrorLevel:
+		return 3
+	case zapcore.DPanicLevel, zapcore.PanicLevel:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// syslogCore is a zapcore.Core that encodes entries and sends them to a
+// syslog server. The syslog header carries the timestamp and severity
+// so the encoder should be configured to omit those.
+type syslogCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	w   *syslogWriter
+}
+
+func newSyslogCore(enc zapcore.Encoder, w *syslogWriter, lvl zapcore.LevelEnabler) zapcore.Core {
+	return &syslogCore{LevelEnabler: lvl, enc: enc, w: w}
+}
+
+func (c *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &syslogCore{LevelEnabler: c.LevelEnabler, enc: enc, w: c.w}
+}
+
+func (c *syslogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *syslogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	return c.w.WriteMessage(syslogSeverity(ent.Level), ent.Time, bytes.TrimRight(buf.Bytes(), "\n"))
+}
+
+func (c *syslogCore) Sync() error {
+	return nil
+}
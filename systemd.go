@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// sdNotify sends a state notification to systemd. This is a no-op if the
+// process wasn't started by systemd with a notify socket, such as when
+// the unit isn't Type=notify.
+//
+// See sd_notify(3) for the protocol and valid states.
+func sdNotify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+
+	// Abstract namespace sockets are indicated with a leading @
+	if name[0] == '@' {
+		name = "\x00" + name[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// sdWatchdogInterval returns how often a watchdog keep-alive should be
+// sent to systemd, which is half of the configured WatchdogSec. Returns
+// zero if the watchdog isn't enabled for this process.
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// runWatchdog sends watchdog keep-alives to systemd for as long as
+// healthy returns true. Once it returns false keep-alives stop and
+// systemd will restart the process after WatchdogSec. Returns when ctx
+// is done.
+func runWatchdog(ctx context.Context, logger *zap.Logger, interval time.Duration, healthy func() bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !healthy() {
+				logger.Error("Exporter is unhealthy, withholding systemd watchdog keep-alive")
+				continue
+			}
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				logger.Error("Error sending systemd watchdog keep-alive", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}